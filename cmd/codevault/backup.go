@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/chanslights/DevNexus/internal/codevault/backup"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// runBackup codevault backup [-o dir] [-incremental]
+// 服务运行时也可以备份，每个仓库的引用和对象是一致的快照
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", "./backups", "directory to write the archive to")
+	incremental := fs.Bool("incremental", false, "only store objects added since the latest backup in the output directory")
+	opts := backupFlags(fs)
+	fs.Parse(args)
+
+	path, m, err := backup.Create(*opts, *out, *incremental)
+	if err != nil {
+		log.Fatalf("Backup failed: %v", err)
+	}
+	log.Printf("💾 Wrote %s backup %s (%d repositories, %d files)", m.Kind, path, len(m.Repos), len(m.Files))
+}
+
+// runRestore codevault restore [-repo owner/name] [-force] <archive>
+// 恢复整个实例前要先停掉服务；只恢复一个仓库时服务可以继续运行
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	var opts backup.RestoreOptions
+	fs.StringVar(&opts.Repo, "repo", "", "restore only this repository (owner/name.git), leaving metadata untouched")
+	fs.BoolVar(&opts.Force, "force", false, "overwrite existing repositories and data")
+	dirs := backupFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	opts.Options = *dirs
+
+	m, err := backup.Restore(opts, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	log.Printf("✅ Restored backup %s (%s)", m.ID, m.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+}
+
+// backupFlags 仓库目录和数据目录，默认和服务一样
+func backupFlags(fs *flag.FlagSet) *backup.Options {
+	var opts backup.Options
+	fs.StringVar(&opts.RepoRoot, "repos", defaultRepoRoot, "repository root")
+	fs.StringVar(&opts.DataDir, "data", utils.GetEnv("CODEVAULT_DATA_DIR", defaultDataDir), "data directory")
+	return &opts
+}
@@ -3,29 +3,278 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/browse"
 	"github.com/chanslights/DevNexus/internal/codevault/git"
+	"github.com/chanslights/DevNexus/internal/codevault/hooks"
+	"github.com/chanslights/DevNexus/internal/codevault/lfs"
+	"github.com/chanslights/DevNexus/internal/codevault/maintenance"
+	"github.com/chanslights/DevNexus/internal/codevault/merge"
+	"github.com/chanslights/DevNexus/internal/codevault/mirror"
+	"github.com/chanslights/DevNexus/internal/codevault/protect"
+	"github.com/chanslights/DevNexus/internal/codevault/release"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/search"
+	"github.com/chanslights/DevNexus/internal/codevault/secrets"
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+	"github.com/chanslights/DevNexus/internal/codevault/sshd"
+	"github.com/chanslights/DevNexus/internal/codevault/status"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
 	"github.com/chanslights/DevNexus/pkg/utils"
 )
 
+// 仓库和元数据的默认位置，服务和备份命令共用
+const (
+	defaultRepoRoot = "./repos"
+	defaultDataDir  = "./data"
+)
+
 func main() {
+	// 子命令：codevault backup / codevault restore，不启动服务
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		}
+	}
+
 	log.Printf("DevNexus starting %s", utils.GetVersion())
 	config := git.Config{
-		RepoRoot: "./repos",
+		RepoRoot:   defaultRepoRoot,
+		AutoCreate: utils.GetEnv("CODEVAULT_AUTO_CREATE", "true") == "true",
+	}
+
+	// 元数据（投递日志等）存储
+	st, err := store.New(utils.GetEnv("CODEVAULT_DATA_DIR", defaultDataDir))
+	if err != nil {
+		log.Fatalf("Failed to init data store: %v", err)
+	}
+	// 源码归档缓存放在数据目录下，可以随时删除
+	config.ArchiveCacheDir = filepath.Join(st.Dir(), "archives")
+
+	// 用户存储：第一次启动时用环境变量初始化管理员账号
+	users, err := auth.NewUserStore(st)
+	if err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+	if users.Count() == 0 {
+		adminUser := utils.GetEnv("CODEVAULT_ADMIN_USER", "admin")
+		adminPassword := utils.GetEnv("CODEVAULT_ADMIN_PASSWORD", "")
+		if adminPassword == "" {
+			log.Printf("⚠️ No users yet, set CODEVAULT_ADMIN_PASSWORD to create the first admin")
+		} else if _, err := users.CreateUser(adminUser, adminPassword, true); err != nil {
+			log.Fatalf("Failed to create admin user: %v", err)
+		} else {
+			log.Printf("👤 Created admin user %s", adminUser)
+		}
+	}
+
+	// 仓库权限与团队
+	policy, err := access.NewPolicy(st)
+	if err != nil {
+		log.Fatalf("Failed to load permissions: %v", err)
+	}
+	// 用户名和组织名共用 /{owner}/{repo}.git 的命名空间
+	users.Reserved = policy.IsOrg
+
+	// 提交状态（由 OpsEngine 等 CI 上报）和分支保护规则
+	statuses, err := status.NewStore(st)
+	if err != nil {
+		log.Fatalf("Failed to load commit statuses: %v", err)
+	}
+	rules, err := protect.NewRules(st)
+	if err != nil {
+		log.Fatalf("Failed to load branch protections: %v", err)
+	}
+
+	// 提交和标签的签名验证：GPG 公钥单独管理，SSH 签名使用用户的 SSH 公钥
+	gpgKeys, err := signing.NewKeys(st)
+	if err != nil {
+		log.Fatalf("Failed to load GPG keys: %v", err)
+	}
+	signatures := signing.NewVerifier(gpgKeys, users)
+
+	// 服务端 pre-receive / post-receive 钩子
+	receiveHooks, err := hooks.NewManager(st)
+	if err != nil {
+		log.Fatalf("Failed to load receive hooks: %v", err)
+	}
+
+	// Webhook 订阅表 + 投递器：负责签名、扇出、重试和投递日志
+	// OpsEngine 作为系统级目标，总是接收 push 和 release 事件
+	subscriptions, err := webhook.NewRegistry(st)
+	if err != nil {
+		log.Fatalf("Failed to load webhook subscriptions: %v", err)
+	}
+	secret := utils.GetEnv("DEVNEXUS_WEBHOOK_SECRET", "")
+	if secret == "" {
+		log.Printf("⚠️ DEVNEXUS_WEBHOOK_SECRET is not set, webhooks will be sent unsigned")
+	}
+	opsEngineURL := utils.GetEnv("OPSENGINE_WEBHOOK_URL", "http://localhost:8081/webhook")
+	dispatcher, err := webhook.NewDispatcher(st, subscriptions, opsEngineURL, secret)
+	if err != nil {
+		log.Fatalf("Failed to init webhook dispatcher: %v", err)
+	}
+	// 仓库订阅默认不能投递到内网地址，Webhook 接收方部署在内网时设置 CODEVAULT_WEBHOOK_ALLOW_PRIVATE=true
+	dispatcher.AllowPrivateTargets = utils.GetEnv("CODEVAULT_WEBHOOK_ALLOW_PRIVATE", "false") == "true"
+
+	// 仓库管理：改名 / 删除时同步迁移权限、订阅、保护规则、钩子和提交状态
+	repos, err := repo.NewManager(config.RepoRoot, st, policy, dispatcher)
+	if err != nil {
+		log.Fatalf("Failed to load repositories: %v", err)
 	}
+	repos.AddListener(policy)
+	repos.AddListener(subscriptions)
+	repos.AddListener(rules)
+	repos.AddListener(receiveHooks)
+	repos.AddListener(statuses)
+
+	// Git LFS 对象存储：每个仓库一份，CODEVAULT_LFS_QUOTA_MB 限制每个仓库的用量
+	lfsStore, err := lfs.NewStore(filepath.Join(st.Dir(), "lfs"))
+	if err != nil {
+		log.Fatalf("Failed to init LFS storage: %v", err)
+	}
+	if quota, err := strconv.ParseInt(utils.GetEnv("CODEVAULT_LFS_QUOTA_MB", "0"), 10, 64); err == nil {
+		lfsStore.Quota = quota << 20
+	}
+	repos.AddListener(lfsStore)
+
+	// 合并请求：源分支有新推送时通过 post-receive 刷新，合并前要求 OpsEngine 流水线通过
+	// 合并和推送一样受分支保护的推送限制，执行 pre-receive / post-receive 钩子
+	protection := protect.NewChecker(rules, statuses, policy)
+	mergeRequests, err := merge.NewManager(st, repos, statuses, rules, protection, dispatcher, receiveHooks, signatures)
+	if err != nil {
+		log.Fatalf("Failed to load merge requests: %v", err)
+	}
+	mergeRequests.RequiredCheck = utils.GetEnv("CODEVAULT_MERGE_REQUIRED_CHECK", merge.DefaultRequiredCheck)
+	if mergeRequests.RequiredCheck == "none" {
+		mergeRequests.RequiredCheck = ""
+	}
+	receiveHooks.Use(mergeRequests)
+	repos.AddListener(mergeRequests)
+
+	// 发布：基于附注标签，说明根据合并请求和提交生成，附件可以从 OpsEngine 的流水线制品拉取
+	releases, err := release.NewManager(st, repos, mergeRequests, dispatcher)
+	if err != nil {
+		log.Fatalf("Failed to load releases: %v", err)
+	}
+	releases.Runs = release.NewRunClient(utils.GetEnv("OPSENGINE_URL", "http://localhost:8081"), secret)
+	if mb, err := strconv.ParseInt(utils.GetEnv("CODEVAULT_RELEASE_ASSET_MAX_MB", "2048"), 10, 64); err == nil && mb > 0 {
+		releases.MaxAssetSize = mb << 20
+	}
+	repos.AddListener(releases)
+
+	// 仓库密钥：加密保存镜像凭证等，CODEVAULT_SECRET_KEY 不设置时在数据目录下生成一把
+	repoSecrets, err := secrets.NewStore(st, utils.GetEnv("CODEVAULT_SECRET_KEY", ""))
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+	repos.AddListener(repoSecrets)
+
+	// 仓库镜像：拉取镜像定时同步上游，推送镜像在每次推送成功后同步
+	mirrors, err := mirror.NewManager(st, repos, repoSecrets, dispatcher, receiveHooks)
+	if err != nil {
+		log.Fatalf("Failed to load mirrors: %v", err)
+	}
+	receiveHooks.Use(mirrors)
+	repos.AddListener(mirrors)
+
+	// 仓库维护：定时按对象数量 repack / gc、定期 fsck，和推送互斥
+	// CODEVAULT_FSCK_INTERVAL_HOURS=0 时关闭定期 fsck
+	maintainer, err := maintenance.NewManager(st, repos, dispatcher)
+	if err != nil {
+		log.Fatalf("Failed to load maintenance reports: %v", err)
+	}
+	if hours, err := strconv.Atoi(utils.GetEnv("CODEVAULT_FSCK_INTERVAL_HOURS", "168")); err == nil {
+		maintainer.FsckInterval = time.Duration(hours) * time.Hour
+	}
+	repos.AddListener(maintainer)
+
+	// 代码搜索：默认分支的三元组索引，推送和合并后增量更新，其余不经过推送的变化每分钟补一次
+	searchIndex, err := search.NewManager(st, repos, policy)
+	if err != nil {
+		log.Fatalf("Failed to load search indexes: %v", err)
+	}
+	if kb, err := strconv.ParseInt(utils.GetEnv("CODEVAULT_SEARCH_MAX_FILE_KB", "1024"), 10, 64); err == nil && kb > 0 {
+		searchIndex.MaxFileSize = kb << 10
+	}
+	receiveHooks.Use(searchIndex)
+	repos.AddListener(searchIndex)
+
+	// 老版本的仓库平铺在 RepoRoot 下，迁移到 <owner>/<name>.git，旧地址会重定向
+	// 所有模块都注册成 Listener 之后再迁移，权限、Webhook 等数据跟着一起改名
+	if err := repos.MigrateFlat(utils.GetEnv("CODEVAULT_ADMIN_USER", "admin")); err != nil {
+		log.Fatalf("Failed to migrate repositories: %v", err)
+	}
+	go mirrors.Run(time.Minute)
+	go maintainer.Run(time.Hour)
+	go searchIndex.Run(time.Minute)
+
 	// 初始化Handler
-	gitHandler := git.NewHandler(config)
+	gitHandler := git.NewHandler(config, git.Services{
+		Webhooks:   dispatcher,
+		Policy:     policy,
+		Protection: protection,
+		Hooks:      receiveHooks,
+		Repos:      repos,
+		Signatures: signatures,
+	})
 
 	// 注册路由
-	// 所有路由都交给gitHandler处理
-	http.Handle("/", gitHandler)
+	// /api/ 下是管理接口，其余路由都交给gitHandler处理
+	mux := http.NewServeMux()
+	users.RegisterRoutes(mux)
+	repo.NewAPI(repos, policy).RegisterRoutes(mux)
+	browse.NewAPI(repos, policy, signatures).RegisterRoutes(mux)
+	signing.NewAPI(gpgKeys).RegisterRoutes(mux)
+	merge.NewAPI(mergeRequests, policy).RegisterRoutes(mux)
+	release.NewAPI(releases, policy).RegisterRoutes(mux)
+	lfs.NewAPI(lfsStore, repos, policy).RegisterRoutes(mux)
+	mirror.NewAPI(mirrors, policy).RegisterRoutes(mux)
+	maintenance.NewAPI(maintainer, policy).RegisterRoutes(mux)
+	search.NewAPI(searchIndex).RegisterRoutes(mux)
+	secrets.NewAPI(repoSecrets, policy).RegisterRoutes(mux)
+	access.NewAPI(policy, users).RegisterRoutes(mux)
+	webhook.NewAPI(subscriptions, dispatcher, policy).RegisterRoutes(mux)
+	status.NewAPI(statuses, policy).RegisterRoutes(mux)
+	protect.NewAPI(rules, policy).RegisterRoutes(mux)
+	hooks.NewAPI(receiveHooks, policy).RegisterRoutes(mux)
+	mux.Handle("/", gitHandler)
+
+	// SSH 传输：和 HTTP 共用同一个 gitHandler，CODEVAULT_SSH_ADDR=off 时关闭
+	if sshAddr := utils.GetEnv("CODEVAULT_SSH_ADDR", ":2222"); sshAddr != "off" {
+		sshServer, err := sshd.NewServer(sshd.Config{
+			Addr:        sshAddr,
+			HostKeyPath: filepath.Join(st.Dir(), "ssh_host_ed25519_key"),
+		}, users, gitHandler)
+		if err != nil {
+			log.Fatalf("Failed to init SSH server: %v", err)
+		}
+		go func() {
+			if err := sshServer.ListenAndServe(); err != nil {
+				log.Fatalf("Failed to start SSH server: %v", err)
+			}
+		}()
+	}
 
 	port := ":8080"
 	log.Printf("CodeVault [Git Server] running on %s", port)
 	log.Printf("Repo Storage: %s", config.RepoRoot)
 
 	// 启动HTTP服务
-	if err := http.ListenAndServe(port, nil); err != nil {
+	// 认证中间件统一解析 Basic / Bearer 凭证
+	if err := http.ListenAndServe(port, users.Middleware(mux)); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
@@ -3,28 +3,92 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/chanslights/DevNexus/internal/ai"
 	"github.com/chanslights/DevNexus/internal/opsengine/docker"
 	"github.com/chanslights/DevNexus/internal/opsengine/k8s"
+	"github.com/chanslights/DevNexus/internal/opsengine/notify"
 	"github.com/chanslights/DevNexus/internal/opsengine/pipeline"
+	"github.com/chanslights/DevNexus/internal/opsengine/runs"
+	"github.com/chanslights/DevNexus/internal/opsengine/webhook"
 	"github.com/chanslights/DevNexus/pkg/types"
 	"github.com/chanslights/DevNexus/pkg/utils"
 )
 
+// guard 校验 Webhook 的签名并拒绝重放请求
+var guard *webhook.Guard
+
+// checkout 流水线检出代码的方式
+var checkout pipeline.CheckoutOptions
+
+// reporter 把流水线结果作为提交状态回报给 CodeVault（分支保护 / 合并请求会用到）
+var reporter *notify.StatusReporter
+
+// runStore 流水线运行记录和制品，CodeVault 发布时从这里拉取制品
+var runStore *runs.Store
+
+// publicURL OpsEngine 对外的地址，提交状态的链接指向 <publicURL>/runs/<id>
+var publicURL string
+
 func main() {
 	log.Printf("DevNexus starting %s", utils.GetVersion())
 	log.Println("DevNexus OpsEngine [CI/CD Worker] is starting...")
 
+	// 没有密钥时任何能访问 OpsEngine 的人都能触发流水线，默认拒绝启动
+	// 本地调试可以设置 OPSENGINE_ALLOW_UNSIGNED_WEBHOOKS=true 放行不签名的请求
+	secret := utils.GetEnv("DEVNEXUS_WEBHOOK_SECRET", "")
+	guard = webhook.NewGuard(secret)
+	if secret == "" {
+		if utils.GetEnv("OPSENGINE_ALLOW_UNSIGNED_WEBHOOKS", "false") != "true" {
+			log.Fatalf("DEVNEXUS_WEBHOOK_SECRET is not set; set it to the secret CodeVault signs webhooks with, or set OPSENGINE_ALLOW_UNSIGNED_WEBHOOKS=true for local testing")
+		}
+		log.Printf("⚠️ DEVNEXUS_WEBHOOK_SECRET is not set, accepting unsigned webhooks (OPSENGINE_ALLOW_UNSIGNED_WEBHOOKS=true)")
+		guard.AllowUnsigned = true
+	}
+	reporter = notify.NewStatusReporter(
+		"http://"+utils.GetEnv("CODEVAULT_HOST", "localhost:8080"),
+		utils.GetEnv("CODEVAULT_USER", ""),
+		utils.GetEnv("CODEVAULT_TOKEN", ""),
+	)
+
+	// 检出方式：默认只拉取要构建的那一个提交，并在本机为每个仓库保留一份镜像缓存
+	depth, err := strconv.Atoi(utils.GetEnv("OPSENGINE_CHECKOUT_DEPTH", "1"))
+	if err != nil {
+		log.Fatalf("Invalid OPSENGINE_CHECKOUT_DEPTH: %v", err)
+	}
+	checkout = pipeline.CheckoutOptions{
+		Depth:      depth,
+		Submodules: utils.GetEnv("OPSENGINE_CHECKOUT_SUBMODULES", "false") == "true",
+		MirrorDir:  utils.GetEnv("OPSENGINE_MIRROR_DIR", "./mirrors"),
+	}
+	for _, p := range strings.Split(utils.GetEnv("OPSENGINE_CHECKOUT_SPARSE_PATHS", ""), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			checkout.SparsePaths = append(checkout.SparsePaths, p)
+		}
+	}
+
+	runStore, err = runs.NewStore(utils.GetEnv("OPSENGINE_RUN_DIR", "./runs"))
+	if err != nil {
+		log.Fatalf("Failed to init run store: %v", err)
+	}
+	publicURL = strings.TrimSuffix(utils.GetEnv("OPSENGINE_PUBLIC_URL", "http://localhost:8081"), "/")
+
 	http.HandleFunc("/webhook", handleWebHook)
+	http.HandleFunc("GET /runs/{id}", handleRun)
+	http.HandleFunc("GET /runs/{id}/artifacts/{name}", handleArtifact)
 
 	port := ":8081"
 	log.Printf("OpsEngine is listening on port %s for webhooks...", port)
 	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatal("Failed to start OpsEngine: %v", err)
+		log.Fatalf("Failed to start OpsEngine: %v", err)
 	}
 }
 
@@ -38,26 +102,93 @@ func handleWebHook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1.解析JSON数据
+	// 1.校验签名，再解析JSON数据
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Failed to read body", 400)
+		return
+	}
+	if err := guard.Verify(r, body); err != nil {
+		log.Printf("⛔ Rejected webhook: %v", err)
+		http.Error(w, "Invalid signature", 401)
+		return
+	}
 	var payload types.WebhookPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+	if err := json.Unmarshal(body, &payload); err != nil {
 		http.Error(w, "Invalid JSON", 400)
 		return
 	}
+	// 分支上有新提交、或者发布了新版本时才需要构建，删除分支、打标签等事件直接忽略
+	event := payload.Event
+	if event == "" {
+		event = types.EventPush
+	}
+	if !(event == types.EventPush && !payload.Deleted) && !(event == types.EventRelease && payload.Action == types.ReleasePublished) {
+		w.WriteHeader(200)
+		w.Write([]byte("Event ignored"))
+		return
+	}
 	// 2.打印日志（假装开始构建）
 	fmt.Println("开始出发流水线构建...")
 
 	// 2.1 构造clone地址。（目前都在本地构造，因此先拼一下地址）
-	repoURL := fmt.Sprintf("http://localhost:8080/%s", payload.RepoName)
+	// CodeVault 需要登录，OpsEngine 使用一个专门的账号 + 个人访问令牌去拉代码
+	cloneURL := &url.URL{
+		Scheme: "http",
+		Host:   utils.GetEnv("CODEVAULT_HOST", "localhost:8080"),
+		Path:   "/" + payload.RepoName,
+	}
+	if user, token := utils.GetEnv("CODEVAULT_USER", ""), utils.GetEnv("CODEVAULT_TOKEN", ""); user != "" {
+		cloneURL.User = url.UserPassword(user, token)
+	}
+	repoURL := cloneURL.String()
 
 	// 2.2 调用Pipeline模块去拉取代码并解析
 	// 这是一个耗时的操作，实际应该放入Go Channel队列里面异步执行。但当前为了演示，直接用go func跑
 	go func() {
-		config, workDir, err := pipeline.FetchAndParse(repoURL, payload.CommitID)
+		// 发布触发的流水线用单独的 context 上报，不影响合并请求要求的 push 流水线结果
+		statusContext := notify.StatusContext
+		if event == types.EventRelease {
+			statusContext = notify.ReleaseContext
+		}
+		ref := payload.Ref
+		if ref == "" && payload.Branch != "" {
+			ref = "refs/heads/" + payload.Branch
+		}
+		config, workDir, err := pipeline.FetchAndParse(repoURL, ref, payload.CommitID, checkout)
+		if event != types.EventPush && errors.Is(err, pipeline.ErrNoConfig) {
+			log.Printf("⏭️ %s 没有 .devnexus.yaml，忽略 %s 事件", payload.RepoName, event)
+			return
+		}
 		if err != nil {
 			log.Printf("❌ 流水线启动失败: %v", err)
+			reportStatus(payload, statusContext, "error", "Pipeline failed to start", "")
 			return
 		}
+		// 流水线没有订阅这个事件（默认只在 push 时触发）
+		if !config.Triggers(event) {
+			log.Printf("⏭️ %s 的流水线没有配置 on: %s，跳过", payload.RepoName, event)
+			return
+		}
+
+		// 记录这次运行，提交状态链接到它，制品也保存在它下面
+		run, err := runStore.Create(payload.RepoName, event, ref, payload.CommitID)
+		if err != nil {
+			log.Printf("❌ 运行记录创建失败: %v", err)
+			reportStatus(payload, statusContext, "error", "Pipeline failed to start", "")
+			return
+		}
+		targetURL := publicURL + "/runs/" + run.ID
+		report := func(state, description string) {
+			reportStatus(payload, statusContext, state, description, targetURL)
+		}
+		finish := func(state, description string) {
+			if err := runStore.Finish(run, state); err != nil {
+				log.Printf("⚠️ 运行记录保存失败: %v", err)
+			}
+			report(state, description)
+		}
+		report("pending", "Pipeline started")
 		// ⚠️ 重要：任务结束后清理临时目录
 		// defer os.RemoveAll(workDir)
 
@@ -65,6 +196,7 @@ func handleWebHook(w http.ResponseWriter, r *http.Request) {
 		executor, err := docker.NewExecutor()
 		if err != nil {
 			log.Printf("❌ Docker 客户端初始化失败: %v", err)
+			finish("error", "Docker is not available")
 			return
 		}
 
@@ -76,6 +208,9 @@ func handleWebHook(w http.ResponseWriter, r *http.Request) {
 		// 遍历执行每一个Stage
 		ctx := context.Background()
 		for _, stage := range config.Stages {
+			if !stage.RunsOn(event) {
+				continue
+			}
 			// 遍历定义在循环外，用来接收日志
 			var stepLogs string
 			var stepErr error
@@ -85,6 +220,7 @@ func handleWebHook(w http.ResponseWriter, r *http.Request) {
 			if stage.Type == "kubernetes" {
 				if k8sDeployer == nil {
 					log.Printf("❌ K8s 未连接，无法部署")
+					finish("error", "Kubernetes is not available")
 					return
 				}
 				// 默认发布到 default 命名空间
@@ -107,6 +243,7 @@ func handleWebHook(w http.ResponseWriter, r *http.Request) {
 			// 错误处理与AI介入
 			if stepErr != nil {
 				log.Printf("❌ 阶段 [%s] 执行失败: %v", stage.Name, stepErr)
+				finish("failure", fmt.Sprintf("Stage %s failed", stage.Name))
 				// 呼叫 AI 进行分析
 				fmt.Println("\n🚑 检测到构建失败，正在呼叫 AI 医生...")
 				// 截取最后 2000 个字符的日志发给 AI (防止 Token 超出)
@@ -126,9 +263,26 @@ func handleWebHook(w http.ResponseWriter, r *http.Request) {
 				return // 终止流水线
 			}
 		}
+		// 保留制品，发布时可以添加为附件
+		if len(config.Artifacts) > 0 {
+			if err := runStore.Collect(run, workDir, config.Artifacts); err != nil {
+				log.Printf("❌ 制品收集失败: %v", err)
+				finish("error", "Failed to collect artifacts")
+				return
+			}
+			log.Printf("📦 运行 %s 保留了 %d 个制品", run.ID, len(run.Artifacts))
+		}
 		fmt.Println("\n🎉🎉🎉 流水线全部执行成功！")
+		finish("success", "Pipeline succeeded")
 	}()
 
 	w.WriteHeader(200)
 	w.Write([]byte("Webhook received successfully"))
 }
+
+// reportStatus 上报提交状态，失败只打日志，不影响流水线本身
+func reportStatus(payload types.WebhookPayload, statusContext, state, description, targetURL string) {
+	if err := reporter.Report(payload.RepoName, payload.CommitID, statusContext, state, description, targetURL); err != nil {
+		log.Printf("⚠️ 提交状态上报失败: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/opsengine/runs"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// handleRun 查询一次运行和它的制品列表，请求要用 Webhook 的共享密钥签名
+func handleRun(w http.ResponseWriter, r *http.Request) {
+	if err := guard.VerifyRequest(r); err != nil {
+		log.Printf("⛔ Rejected run request: %v", err)
+		utils.WriteError(w, 401, "invalid signature")
+		return
+	}
+	run, err := runStore.Get(r.PathValue("id"))
+	if errors.Is(err, runs.ErrNotFound) {
+		utils.WriteError(w, 404, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, run)
+}
+
+// handleArtifact 下载制品，CodeVault 把它添加为发布的附件
+func handleArtifact(w http.ResponseWriter, r *http.Request) {
+	if err := guard.VerifyRequest(r); err != nil {
+		log.Printf("⛔ Rejected artifact request: %v", err)
+		utils.WriteError(w, 401, "invalid signature")
+		return
+	}
+	f, err := runStore.OpenArtifact(r.PathValue("id"), r.PathValue("name"))
+	if errors.Is(err, runs.ErrNotFound) {
+		utils.WriteError(w, 404, "artifact not found")
+		return
+	} else if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if info, err := f.Stat(); err == nil {
+		http.ServeContent(w, r, "", info.ModTime(), f)
+		return
+	}
+	io.Copy(w, f)
+}
@@ -0,0 +1,358 @@
+package access
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 仓库权限、团队与组织的管理接口
+type API struct {
+	policy *Policy
+	users  *auth.UserStore
+}
+
+// NewAPI 创建管理接口
+func NewAPI(policy *Policy, users *auth.UserStore) *API {
+	return &API{policy: policy, users: users}
+}
+
+// RegisterRoutes 注册路由
+// 仓库相关的接口需要仓库管理员权限，团队相关的接口需要站点管理员权限，组织成员由组织管理员维护
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/settings", a.handleGetSettings)
+	mux.HandleFunc("PATCH /api/repos/{owner}/{repo}/settings", a.handleUpdateSettings)
+	mux.HandleFunc("PUT /api/repos/{owner}/{repo}/collaborators/{username}", a.handleGrantUser)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/collaborators/{username}", a.handleRevokeUser)
+	mux.HandleFunc("PUT /api/repos/{owner}/{repo}/teams/{team}", a.handleGrantTeam)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/teams/{team}", a.handleRevokeTeam)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/permission", a.handleMyPermission)
+
+	mux.HandleFunc("GET /api/teams", a.handleListTeams)
+	mux.HandleFunc("POST /api/teams", a.handleCreateTeam)
+	mux.HandleFunc("GET /api/teams/{team}", a.handleGetTeam)
+	mux.HandleFunc("DELETE /api/teams/{team}", a.handleDeleteTeam)
+	mux.HandleFunc("PUT /api/teams/{team}/members/{username}", a.handleAddMember)
+	mux.HandleFunc("DELETE /api/teams/{team}/members/{username}", a.handleRemoveMember)
+
+	mux.HandleFunc("GET /api/orgs", a.handleListOrgs)
+	mux.HandleFunc("POST /api/orgs", a.handleCreateOrg)
+	mux.HandleFunc("GET /api/orgs/{org}", a.handleGetOrg)
+	mux.HandleFunc("PUT /api/orgs/{org}/members/{username}", a.handleSetOrgMember)
+	mux.HandleFunc("DELETE /api/orgs/{org}/members/{username}", a.handleRemoveOrgMember)
+}
+
+func (a *API) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, Admin) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.policy.Settings(repo))
+}
+
+func (a *API) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, Admin) {
+		return
+	}
+	var req struct {
+		Visibility string `json:"visibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if err := a.policy.SetVisibility(repo, req.Visibility); err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, a.policy.Settings(repo))
+}
+
+func (a *API) handleGrantUser(w http.ResponseWriter, r *http.Request) {
+	repo, username := utils.RepoFromPath(r), r.PathValue("username")
+	if !a.policy.Require(w, r, repo, Admin) {
+		return
+	}
+	level, ok := decodePermission(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := a.users.Get(username); !ok {
+		utils.WriteError(w, 404, auth.ErrUserNotFound.Error())
+		return
+	}
+	if err := a.policy.GrantUser(repo, username, level); err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, a.policy.Settings(repo))
+}
+
+func (a *API) handleRevokeUser(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, Admin) {
+		return
+	}
+	if err := a.policy.GrantUser(repo, r.PathValue("username"), None); err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *API) handleGrantTeam(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, Admin) {
+		return
+	}
+	level, ok := decodePermission(w, r)
+	if !ok {
+		return
+	}
+	if err := a.policy.GrantTeam(repo, r.PathValue("team"), level); errors.Is(err, ErrTeamNotFound) {
+		utils.WriteError(w, 404, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, a.policy.Settings(repo))
+}
+
+func (a *API) handleRevokeTeam(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, Admin) {
+		return
+	}
+	if err := a.policy.GrantTeam(repo, r.PathValue("team"), None); err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handleMyPermission 查询当前用户对仓库的权限
+func (a *API) handleMyPermission(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, Read) {
+		return
+	}
+	level := a.policy.Level(auth.UserFromContext(r.Context()), repo)
+	utils.WriteJSON(w, 200, map[string]Level{"permission": level})
+}
+
+func (a *API) handleListTeams(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	utils.WriteJSON(w, 200, a.policy.Teams())
+}
+
+func (a *API) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	t, err := a.policy.CreateTeam(req.Name)
+	if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, t)
+}
+
+func (a *API) handleGetTeam(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	t, ok := a.policy.Team(r.PathValue("team"))
+	if !ok {
+		utils.WriteError(w, 404, ErrTeamNotFound.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, t)
+}
+
+func (a *API) handleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	if err := a.policy.DeleteTeam(r.PathValue("team")); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *API) handleAddMember(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	username := r.PathValue("username")
+	if _, ok := a.users.Get(username); !ok {
+		utils.WriteError(w, 404, auth.ErrUserNotFound.Error())
+		return
+	}
+	if err := a.policy.AddMember(r.PathValue("team"), username); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	t, _ := a.policy.Team(r.PathValue("team"))
+	utils.WriteJSON(w, 200, t)
+}
+
+func (a *API) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	if err := a.policy.RemoveMember(r.PathValue("team"), r.PathValue("username")); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *API) handleListOrgs(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireUser(w, r); !ok {
+		return
+	}
+	utils.WriteJSON(w, 200, a.policy.Orgs())
+}
+
+// handleCreateOrg 任何登录用户都可以创建组织，名字不能和已有用户重复
+func (a *API) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if _, taken := a.users.Get(req.Name); taken {
+		utils.WriteError(w, 409, ErrOrgExists.Error())
+		return
+	}
+	o, err := a.policy.CreateOrg(req.Name, user.Username)
+	if errors.Is(err, ErrOrgExists) {
+		utils.WriteError(w, 409, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, o)
+}
+
+func (a *API) handleGetOrg(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireUser(w, r); !ok {
+		return
+	}
+	o, ok := a.policy.Org(r.PathValue("org"))
+	if !ok {
+		utils.WriteError(w, 404, ErrOrgNotFound.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, o)
+}
+
+// handleSetOrgMember 添加成员或修改角色，请求体 {"role": "admin|member"}，默认 member
+func (a *API) handleSetOrgMember(w http.ResponseWriter, r *http.Request) {
+	org, ok := a.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if req.Role == "" {
+		req.Role = OrgMember
+	}
+	username := r.PathValue("username")
+	if _, ok := a.users.Get(username); !ok {
+		utils.WriteError(w, 404, auth.ErrUserNotFound.Error())
+		return
+	}
+	if err := a.policy.SetOrgMember(org, username, req.Role); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+	o, _ := a.policy.Org(org)
+	utils.WriteJSON(w, 200, o)
+}
+
+func (a *API) handleRemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	org, ok := a.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+	if err := a.policy.RemoveOrgMember(org, r.PathValue("username")); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// requireOrgAdmin 检查组织存在并且当前用户是组织管理员
+func (a *API) requireOrgAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return "", false
+	}
+	org := r.PathValue("org")
+	if !a.policy.IsOrg(org) {
+		utils.WriteError(w, 404, ErrOrgNotFound.Error())
+		return "", false
+	}
+	if !a.policy.IsOrgAdmin(user, org) {
+		utils.WriteError(w, 403, "requires organization admin")
+		return "", false
+	}
+	return org, true
+}
+
+func writeOrgError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrOrgNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrLastOrgAdmin):
+		utils.WriteError(w, 409, err.Error())
+	default:
+		utils.WriteError(w, 400, err.Error())
+	}
+}
+
+// decodePermission 解析 {"permission": "read|write|admin"}
+func decodePermission(w http.ResponseWriter, r *http.Request) (Level, bool) {
+	var req struct {
+		Permission string `json:"permission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return None, false
+	}
+	level, err := ParseLevel(req.Permission)
+	if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return None, false
+	}
+	return level, true
+}
@@ -0,0 +1,188 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// 组织成员的角色
+const (
+	OrgAdmin  = "admin"  // 管理成员，对组织下所有仓库有管理员权限
+	OrgMember = "member" // 可以在组织下建仓库，对组织下所有仓库至少可读
+)
+
+var (
+	// ErrOrgNotFound 组织不存在
+	ErrOrgNotFound = errors.New("organization not found")
+	// ErrOrgExists 组织名已被占用
+	ErrOrgExists = errors.New("organization already exists")
+	// ErrLastOrgAdmin 组织至少要保留一个管理员
+	ErrLastOrgAdmin = errors.New("organization must keep at least one admin")
+)
+
+// Org 组织，和用户一样可以作为仓库的所有者：/{org}/{repo}.git
+type Org struct {
+	Name      string            `json:"name"`
+	Members   map[string]string `json:"members"` // 用户名 -> admin / member
+	CreatedBy string            `json:"created_by"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// CreateOrg 创建组织，创建者成为组织管理员
+// 用户名和组织名共用一个命名空间，调用方负责检查名字没有被用户占用
+func (p *Policy) CreateOrg(name, creator string) (*Org, error) {
+	if err := utils.ValidateOwner(name); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.orgs[name]; ok {
+		return nil, ErrOrgExists
+	}
+	o := &Org{
+		Name:      name,
+		Members:   map[string]string{creator: OrgAdmin},
+		CreatedBy: creator,
+		CreatedAt: time.Now(),
+	}
+	p.orgs[name] = o
+	return copyOrg(o), p.saveLocked()
+}
+
+// Org 查询组织
+func (p *Policy) Org(name string) (*Org, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, ok := p.orgs[name]
+	if !ok {
+		return nil, false
+	}
+	return copyOrg(o), true
+}
+
+// Orgs 列出所有组织
+func (p *Policy) Orgs() []*Org {
+	p.mu.Lock()
+	list := make([]*Org, 0, len(p.orgs))
+	for _, o := range p.orgs {
+		list = append(list, copyOrg(o))
+	}
+	p.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsOrg 判断名字是否被组织占用，注入给 auth.UserStore.Reserved
+func (p *Policy) IsOrg(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.orgs[name]
+	return ok
+}
+
+// SetOrgMember 添加组织成员或修改角色
+func (p *Policy) SetOrgMember(org, username, role string) error {
+	if role != OrgAdmin && role != OrgMember {
+		return fmt.Errorf("invalid role: %q", role)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, ok := p.orgs[org]
+	if !ok {
+		return ErrOrgNotFound
+	}
+	if o.Members[username] == OrgAdmin && role != OrgAdmin && countAdmins(o) == 1 {
+		return ErrLastOrgAdmin
+	}
+	o.Members[username] = role
+	return p.saveLocked()
+}
+
+// RemoveOrgMember 把用户移出组织
+func (p *Policy) RemoveOrgMember(org, username string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, ok := p.orgs[org]
+	if !ok {
+		return ErrOrgNotFound
+	}
+	if o.Members[username] == OrgAdmin && countAdmins(o) == 1 {
+		return ErrLastOrgAdmin
+	}
+	delete(o.Members, username)
+	return p.saveLocked()
+}
+
+// IsOrgAdmin 判断用户能否管理组织，站点管理员可以管理所有组织
+func (p *Policy) IsOrgAdmin(user *auth.User, org string) bool {
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, ok := p.orgs[org]
+	return ok && o.Members[user.Username] == OrgAdmin
+}
+
+// CanCreate 判断用户能否在 owner 名下建仓库：自己名下、所在的组织，站点管理员不受限制
+func (p *Policy) CanCreate(user *auth.User, owner string) bool {
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin || user.Username == owner {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	o, ok := p.orgs[owner]
+	return ok && o.Members[user.Username] != ""
+}
+
+// ownerLevelLocked 所有者带来的权限：用户对自己名下的仓库是管理员，组织管理员是管理员，组织成员可读
+func (p *Policy) ownerLevelLocked(username, repo string) Level {
+	owner := utils.RepoOwner(repo)
+	if owner == "" {
+		return None
+	}
+	if owner == username {
+		return Admin
+	}
+	o, ok := p.orgs[owner]
+	if !ok {
+		return None
+	}
+	switch o.Members[username] {
+	case OrgAdmin:
+		return Admin
+	case OrgMember:
+		return Read
+	}
+	return None
+}
+
+func countAdmins(o *Org) int {
+	n := 0
+	for _, role := range o.Members {
+		if role == OrgAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+func copyOrg(o *Org) *Org {
+	cp := *o
+	cp.Members = make(map[string]string, len(o.Members))
+	for k, v := range o.Members {
+		cp.Members[k] = v
+	}
+	return &cp
+}
@@ -0,0 +1,418 @@
+package access
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const accessFile = "access"
+
+// Level 仓库权限级别，高级别包含低级别的所有能力
+type Level int
+
+const (
+	None  Level = iota
+	Read        // clone / fetch（git-upload-pack）
+	Write       // push（git-receive-pack）
+	Admin       // 仓库设置、Webhook、删除
+)
+
+// 仓库可见性
+const (
+	Public  = "public"  // 匿名用户也可以 clone
+	Private = "private" // 只有被授权的用户 / 团队可以访问
+)
+
+// ErrTeamNotFound 团队不存在
+var ErrTeamNotFound = errors.New("team not found")
+
+// String 权限级别的文本形式，API 里使用
+func (l Level) String() string {
+	switch l {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	case Admin:
+		return "admin"
+	}
+	return "none"
+}
+
+// ParseLevel 把 API 里的文本转换成权限级别
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "read":
+		return Read, nil
+	case "write":
+		return Write, nil
+	case "admin":
+		return Admin, nil
+	}
+	return None, fmt.Errorf("invalid permission: %q", s)
+}
+
+// MarshalJSON 序列化成 "read" / "write" / "admin"
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON 从 "read" / "write" / "admin" 反序列化
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// Team 一组用户，可以整体授权给仓库
+type Team struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// RepoSettings 单个仓库的可见性和授权
+type RepoSettings struct {
+	Repo       string           `json:"repo"`
+	Visibility string           `json:"visibility"`
+	Users      map[string]Level `json:"users"` // 用户名 -> 权限
+	Teams      map[string]Level `json:"teams"` // 团队名 -> 权限
+}
+
+// snapshot 落盘的结构
+type snapshot struct {
+	Teams []*Team         `json:"teams"`
+	Orgs  []*Org          `json:"orgs,omitempty"`
+	Repos []*RepoSettings `json:"repos"`
+}
+
+// Policy 仓库授权策略
+type Policy struct {
+	store *store.Store
+
+	mu    sync.Mutex
+	teams map[string]*Team
+	orgs  map[string]*Org
+	repos map[string]*RepoSettings
+}
+
+// NewPolicy 创建授权策略并从 store 中加载
+func NewPolicy(st *store.Store) (*Policy, error) {
+	p := &Policy{
+		store: st,
+		teams: make(map[string]*Team),
+		orgs:  make(map[string]*Org),
+		repos: make(map[string]*RepoSettings),
+	}
+	var saved snapshot
+	if err := st.Load(accessFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, t := range saved.Teams {
+		p.teams[t.Name] = t
+	}
+	for _, o := range saved.Orgs {
+		p.orgs[o.Name] = o
+	}
+	for _, rs := range saved.Repos {
+		p.repos[rs.Repo] = rs
+	}
+	return p, nil
+}
+
+// Level 计算用户对仓库的权限，user 为 nil 表示匿名
+// 规则：站点管理员拥有所有权限；否则取所有者、用户授权和所在团队授权中的最高者；公开仓库至少可读
+func (p *Policy) Level(user *auth.User, repo string) Level {
+	if user != nil && user.IsAdmin {
+		return Admin
+	}
+	repo = utils.NormalizeRepoName(repo)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rs, ok := p.repos[repo]
+	if !ok {
+		// 没有任何设置的仓库按私有处理，只有站点管理员可以访问
+		return None
+	}
+
+	level := None
+	if rs.Visibility == Public {
+		level = Read
+	}
+	if user == nil {
+		return level
+	}
+	if l := p.ownerLevelLocked(user.Username, repo); l > level {
+		level = l
+	}
+	if l := rs.Users[user.Username]; l > level {
+		level = l
+	}
+	for name, l := range rs.Teams {
+		if l > level && p.isMemberLocked(name, user.Username) {
+			level = l
+		}
+	}
+	return level
+}
+
+// Settings 查询仓库设置
+func (p *Policy) Settings(repo string) *RepoSettings {
+	repo = utils.NormalizeRepoName(repo)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rs, ok := p.repos[repo]; ok {
+		return copySettings(rs)
+	}
+	return &RepoSettings{Repo: repo, Visibility: Private, Users: map[string]Level{}, Teams: map[string]Level{}}
+}
+
+// InitRepo 新建仓库时调用：设置可见性，并把创建者设为仓库管理员
+func (p *Policy) InitRepo(repo, creator, visibility string) error {
+	if visibility != Public {
+		visibility = Private
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rs := p.settingsLocked(utils.NormalizeRepoName(repo))
+	rs.Visibility = visibility
+	if creator != "" {
+		rs.Users[creator] = Admin
+	}
+	return p.saveLocked()
+}
+
+// SetVisibility 修改仓库可见性
+func (p *Policy) SetVisibility(repo, visibility string) error {
+	if visibility != Public && visibility != Private {
+		return fmt.Errorf("invalid visibility: %q", visibility)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.settingsLocked(utils.NormalizeRepoName(repo)).Visibility = visibility
+	return p.saveLocked()
+}
+
+// GrantUser 给用户授权，level 为 None 时撤销
+func (p *Policy) GrantUser(repo, username string, level Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rs := p.settingsLocked(utils.NormalizeRepoName(repo))
+	if level == None {
+		delete(rs.Users, username)
+	} else {
+		rs.Users[username] = level
+	}
+	return p.saveLocked()
+}
+
+// GrantTeam 给团队授权，level 为 None 时撤销
+func (p *Policy) GrantTeam(repo, team string, level Level) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.teams[team]; !ok && level != None {
+		return ErrTeamNotFound
+	}
+	rs := p.settingsLocked(utils.NormalizeRepoName(repo))
+	if level == None {
+		delete(rs.Teams, team)
+	} else {
+		rs.Teams[team] = level
+	}
+	return p.saveLocked()
+}
+
+// CreateTeam 创建团队
+func (p *Policy) CreateTeam(name string) (*Team, error) {
+	if name == "" {
+		return nil, fmt.Errorf("team name is required")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.teams[name]; ok {
+		return nil, fmt.Errorf("team %s already exists", name)
+	}
+	t := &Team{Name: name, Members: []string{}}
+	p.teams[name] = t
+	return copyTeam(t), p.saveLocked()
+}
+
+// DeleteTeam 删除团队，同时撤销它在所有仓库上的授权
+func (p *Policy) DeleteTeam(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.teams[name]; !ok {
+		return ErrTeamNotFound
+	}
+	delete(p.teams, name)
+	for _, rs := range p.repos {
+		delete(rs.Teams, name)
+	}
+	return p.saveLocked()
+}
+
+// Team 查询团队
+func (p *Policy) Team(name string) (*Team, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.teams[name]
+	if !ok {
+		return nil, false
+	}
+	return copyTeam(t), true
+}
+
+// Teams 列出所有团队
+func (p *Policy) Teams() []*Team {
+	p.mu.Lock()
+	list := make([]*Team, 0, len(p.teams))
+	for _, t := range p.teams {
+		list = append(list, copyTeam(t))
+	}
+	p.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// AddMember 把用户加入团队
+func (p *Policy) AddMember(team, username string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.teams[team]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	if p.isMemberLocked(team, username) {
+		return nil
+	}
+	t.Members = append(t.Members, username)
+	sort.Strings(t.Members)
+	return p.saveLocked()
+}
+
+// RemoveMember 把用户移出团队
+func (p *Policy) RemoveMember(team, username string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.teams[team]
+	if !ok {
+		return ErrTeamNotFound
+	}
+	for i, m := range t.Members {
+		if m == username {
+			t.Members = append(t.Members[:i], t.Members[i+1:]...)
+			break
+		}
+	}
+	return p.saveLocked()
+}
+
+// RenameRepo 仓库改名时迁移它的授权
+func (p *Policy) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rs, ok := p.repos[oldName]
+	if !ok {
+		return nil
+	}
+	delete(p.repos, oldName)
+	rs.Repo = newName
+	p.repos[newName] = rs
+	return p.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的授权
+func (p *Policy) DeleteRepo(repo string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.repos, utils.NormalizeRepoName(repo))
+	return p.saveLocked()
+}
+
+// IsMember 判断用户是否在团队中
+func (p *Policy) IsMember(team, username string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isMemberLocked(team, username)
+}
+
+func (p *Policy) isMemberLocked(team, username string) bool {
+	t, ok := p.teams[team]
+	if !ok {
+		return false
+	}
+	for _, m := range t.Members {
+		if m == username {
+			return true
+		}
+	}
+	return false
+}
+
+// settingsLocked 取出仓库设置，不存在时创建一个默认的私有设置
+func (p *Policy) settingsLocked(repo string) *RepoSettings {
+	rs, ok := p.repos[repo]
+	if !ok {
+		rs = &RepoSettings{
+			Repo:       repo,
+			Visibility: Private,
+			Users:      make(map[string]Level),
+			Teams:      make(map[string]Level),
+		}
+		p.repos[repo] = rs
+	}
+	return rs
+}
+
+// saveLocked 写回磁盘，调用方必须持有 p.mu
+func (p *Policy) saveLocked() error {
+	var snap snapshot
+	for _, t := range p.teams {
+		snap.Teams = append(snap.Teams, t)
+	}
+	for _, o := range p.orgs {
+		snap.Orgs = append(snap.Orgs, o)
+	}
+	for _, rs := range p.repos {
+		snap.Repos = append(snap.Repos, rs)
+	}
+	sort.Slice(snap.Teams, func(i, j int) bool { return snap.Teams[i].Name < snap.Teams[j].Name })
+	sort.Slice(snap.Orgs, func(i, j int) bool { return snap.Orgs[i].Name < snap.Orgs[j].Name })
+	sort.Slice(snap.Repos, func(i, j int) bool { return snap.Repos[i].Repo < snap.Repos[j].Repo })
+	return p.store.Save(accessFile, snap)
+}
+
+func copyTeam(t *Team) *Team {
+	return &Team{Name: t.Name, Members: append([]string{}, t.Members...)}
+}
+
+func copySettings(rs *RepoSettings) *RepoSettings {
+	cp := &RepoSettings{
+		Repo:       rs.Repo,
+		Visibility: rs.Visibility,
+		Users:      make(map[string]Level, len(rs.Users)),
+		Teams:      make(map[string]Level, len(rs.Teams)),
+	}
+	for k, v := range rs.Users {
+		cp.Users[k] = v
+	}
+	for k, v := range rs.Teams {
+		cp.Teams[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,27 @@
+package access
+
+import (
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// Require 检查当前请求对仓库是否至少拥有 level 权限，不满足时写回错误并返回 false
+// 匿名用户返回 401 让客户端去登录；连读权限都没有时返回 404，不暴露私有仓库是否存在
+func (p *Policy) Require(w http.ResponseWriter, r *http.Request, repo string, level Level) bool {
+	user := auth.UserFromContext(r.Context())
+	granted := p.Level(user, repo)
+	if granted >= level {
+		return true
+	}
+	switch {
+	case user == nil:
+		auth.Challenge(w)
+	case granted == None:
+		utils.WriteError(w, 404, "repository not found")
+	default:
+		utils.WriteError(w, 403, "requires "+level.String()+" permission")
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// RegisterRoutes 注册用户与令牌的管理接口
+func (s *UserStore) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/users", s.handleListUsers)
+	mux.HandleFunc("POST /api/users", s.handleCreateUser)
+	mux.HandleFunc("GET /api/user", s.handleCurrentUser)
+	mux.HandleFunc("GET /api/user/tokens", s.handleListTokens)
+	mux.HandleFunc("POST /api/user/tokens", s.handleCreateToken)
+	mux.HandleFunc("DELETE /api/user/tokens/{id}", s.handleDeleteToken)
+	mux.HandleFunc("GET /api/user/keys", s.handleListKeys)
+	mux.HandleFunc("POST /api/user/keys", s.handleAddKey)
+	mux.HandleFunc("DELETE /api/user/keys/{id}", s.handleDeleteKey)
+}
+
+func (s *UserStore) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := RequireAdmin(w, r); !ok {
+		return
+	}
+	list := s.List()
+	for _, u := range list {
+		u.Tokens = nil
+		u.SSHKeys = nil
+	}
+	utils.WriteJSON(w, 200, list)
+}
+
+// handleCreateUser 只有管理员可以创建用户
+func (s *UserStore) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	if _, ok := RequireAdmin(w, r); !ok {
+		return
+	}
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		IsAdmin  bool   `json:"is_admin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	u, err := s.CreateUser(req.Username, req.Password, req.IsAdmin)
+	if errors.Is(err, ErrUserExists) {
+		utils.WriteError(w, 409, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, u)
+}
+
+func (s *UserStore) handleCurrentUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	u.Tokens = nil
+	u.SSHKeys = nil
+	utils.WriteJSON(w, 200, u)
+}
+
+func (s *UserStore) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	current, _ := s.Get(u.Username)
+	tokens := current.Tokens
+	if tokens == nil {
+		tokens = []*Token{}
+	}
+	utils.WriteJSON(w, 200, tokens)
+}
+
+func (s *UserStore) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		utils.WriteError(w, 400, "token name is required")
+		return
+	}
+	t, plain, err := s.CreateToken(u.Username, req.Name)
+	if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, map[string]any{
+		"id":         t.ID,
+		"name":       t.Name,
+		"created_at": t.CreatedAt,
+		"token":      plain, // 明文只返回这一次
+	})
+}
+
+func (s *UserStore) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.DeleteToken(u.Username, r.PathValue("id")); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (s *UserStore) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	current, _ := s.Get(u.Username)
+	keys := current.SSHKeys
+	if keys == nil {
+		keys = []*SSHKey{}
+	}
+	utils.WriteJSON(w, 200, keys)
+}
+
+// handleAddKey 添加 SSH 公钥：{"title": "laptop", "key": "ssh-ed25519 AAAA... user@host"}
+func (s *UserStore) handleAddKey(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title string `json:"title"`
+		Key   string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	k, err := s.AddSSHKey(u.Username, req.Title, req.Key)
+	if errors.Is(err, ErrKeyExists) {
+		utils.WriteError(w, 409, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, k)
+}
+
+func (s *UserStore) handleDeleteKey(w http.ResponseWriter, r *http.Request) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.DeleteSSHKey(u.Username, r.PathValue("id")); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
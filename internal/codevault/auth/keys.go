@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+var (
+	// ErrKeyExists 公钥已经被某个用户添加过，一把公钥只能对应一个用户
+	ErrKeyExists = errors.New("key is already in use")
+	// ErrKeyNotFound 公钥不存在
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// SSHKey 用户上传的 SSH 公钥，SSH 推送 / 拉取时用它识别用户
+type SSHKey struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Key         string    `json:"key"`         // authorized_keys 格式，不含注释
+	Fingerprint string    `json:"fingerprint"` // SHA256:...
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsed    time.Time `json:"last_used,omitempty"`
+}
+
+// parseSSHKey 解析 authorized_keys 格式的公钥，拒绝 DSA 和过短的 RSA 密钥
+func parseSSHKey(authorizedKey string) (ssh.PublicKey, string, error) {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(authorizedKey)))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid public key: %v", err)
+	}
+	switch key.Type() {
+	case ssh.KeyAlgoDSA:
+		return nil, "", fmt.Errorf("DSA keys are not supported")
+	case ssh.KeyAlgoRSA:
+		if ck, ok := key.(ssh.CryptoPublicKey); ok {
+			if pub, ok := ck.CryptoPublicKey().(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+				return nil, "", fmt.Errorf("RSA keys must be at least 2048 bits")
+			}
+		}
+	}
+	return key, comment, nil
+}
+
+// AddSSHKey 为用户添加公钥，title 为空时使用公钥的注释
+func (s *UserStore) AddSSHKey(username, title, authorizedKey string) (*SSHKey, error) {
+	key, comment, err := parseSSHKey(authorizedKey)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		title = comment
+	}
+	if title == "" {
+		return nil, fmt.Errorf("key title is required")
+	}
+	k := &SSHKey{
+		ID:          utils.RandomID(6),
+		Title:       title,
+		Key:         strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		CreatedAt:   time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if _, owner := s.findKeyLocked(k.Fingerprint); owner != nil {
+		return nil, ErrKeyExists
+	}
+	u.SSHKeys = append(u.SSHKeys, k)
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	out := *k
+	return &out, nil
+}
+
+// DeleteSSHKey 删除公钥
+func (s *UserStore) DeleteSSHKey(username, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for i, k := range u.SSHKeys {
+		if k.ID == id {
+			u.SSHKeys = append(u.SSHKeys[:i], u.SSHKeys[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// AuthenticateKey 按公钥找到对应的用户（SSH 认证）
+func (s *UserStore) AuthenticateKey(key ssh.PublicKey) (*User, error) {
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, u := s.findKeyLocked(fingerprint)
+	if u == nil || k.Key != strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) {
+		return nil, ErrInvalidCredentials
+	}
+	// 和令牌一样，最近使用时间只精确到分钟
+	if time.Since(k.LastUsed) > time.Minute {
+		k.LastUsed = time.Now()
+		s.saveLocked()
+	}
+	return u.Public(), nil
+}
+
+// KeyOwner 按指纹查找 SSH 公钥的主人（验证 SSH 签名）
+func (s *UserStore) KeyOwner(fingerprint string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, u := s.findKeyLocked(fingerprint); u != nil {
+		return u.Username, true
+	}
+	return "", false
+}
+
+// findKeyLocked 按指纹查找公钥和它的主人，调用方必须持有 s.mu
+func (s *UserStore) findKeyLocked(fingerprint string) (*SSHKey, *User) {
+	for _, u := range s.users {
+		for _, k := range u.SSHKeys {
+			if k.Fingerprint == fingerprint {
+				return k, u
+			}
+		}
+	}
+	return nil, nil
+}
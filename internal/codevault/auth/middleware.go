@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// Realm WWW-Authenticate 里的 realm，git 会在提示输入密码时显示它
+const Realm = "CodeVault"
+
+type contextKey struct{}
+
+// WithUser 把已认证的用户放进 context
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// UserFromContext 取出已认证的用户，匿名请求返回 nil
+func UserFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(contextKey{}).(*User)
+	return u
+}
+
+// Middleware 解析请求里的凭证并把用户放进 context
+// 支持 Basic（用户名 + 密码 / 令牌）和 Bearer（令牌）两种方式
+// 没带凭证的请求匿名放行，由后面的 handler 决定是否需要登录；凭证错误直接返回 401
+func (s *UserStore) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user *User
+		var err error
+		if username, password, ok := r.BasicAuth(); ok {
+			user, err = s.Authenticate(username, password)
+		} else if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			user, err = s.AuthenticateToken(token)
+		}
+		if err != nil {
+			Challenge(w)
+			return
+		}
+		if user != nil {
+			r = r.WithContext(WithUser(r.Context(), user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Challenge 返回 401 并带上 WWW-Authenticate，git 客户端看到后会提示输入用户名密码
+func Challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+Realm+`", charset="UTF-8"`)
+	http.Error(w, "Authentication required", 401)
+}
+
+// RequireUser 要求请求已登录，否则写回 401
+func RequireUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	u := UserFromContext(r.Context())
+	if u == nil {
+		Challenge(w)
+		return nil, false
+	}
+	return u, true
+}
+
+// RequireAdmin 要求请求来自站点管理员
+func RequireAdmin(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	u, ok := RequireUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !u.IsAdmin {
+		utils.WriteError(w, 403, "admin privileges required")
+		return nil, false
+	}
+	return u, true
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	usersFile   = "users"
+	tokenPrefix = "dnx_" // 个人访问令牌的前缀，方便在日志和代码里识别
+)
+
+var (
+	// ErrInvalidCredentials 用户名、密码或令牌错误
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists 用户名已被占用
+	ErrUserExists = errors.New("user already exists")
+)
+
+// User CodeVault 用户
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash,omitempty"` // bcrypt
+	IsAdmin      bool      `json:"is_admin"`                // 站点管理员
+	Tokens       []*Token  `json:"tokens,omitempty"`
+	SSHKeys      []*SSHKey `json:"ssh_keys,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Token 个人访问令牌，只保存 sha256，明文只在创建时返回一次
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used,omitempty"`
+}
+
+// Public 去掉密码哈希和令牌哈希后的副本，用于 API 输出
+func (u *User) Public() *User {
+	cp := *u
+	cp.PasswordHash = ""
+	cp.Tokens = nil
+	for _, t := range u.Tokens {
+		tc := *t
+		tc.Hash = ""
+		cp.Tokens = append(cp.Tokens, &tc)
+	}
+	cp.SSHKeys = nil
+	for _, k := range u.SSHKeys {
+		kc := *k
+		cp.SSHKeys = append(cp.SSHKeys, &kc)
+	}
+	return &cp
+}
+
+// UserStore 用户与令牌的存储
+type UserStore struct {
+	store *store.Store
+
+	// Reserved 被其他所有者（组织）占用的名字，用户名和组织名共用同一个命名空间
+	Reserved func(name string) bool
+
+	mu    sync.Mutex
+	users map[string]*User
+}
+
+// NewUserStore 创建用户存储并从 store 中加载
+func NewUserStore(st *store.Store) (*UserStore, error) {
+	s := &UserStore{store: st, users: make(map[string]*User)}
+	var saved []*User
+	if err := st.Load(usersFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, u := range saved {
+		s.users[u.Username] = u
+	}
+	return s, nil
+}
+
+// Count 用户数量，启动时用来判断是否需要初始化管理员
+func (s *UserStore) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.users)
+}
+
+// CreateUser 创建用户，密码使用 bcrypt 保存
+func (s *UserStore) CreateUser(username, password string, admin bool) (*User, error) {
+	if err := utils.ValidateOwner(username); err != nil {
+		return nil, fmt.Errorf("invalid username: %q", username)
+	}
+	if len(password) < 8 {
+		return nil, fmt.Errorf("password must be at least 8 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[username]; ok || (s.Reserved != nil && s.Reserved(username)) {
+		return nil, ErrUserExists
+	}
+	u := &User{
+		Username:     username,
+		PasswordHash: string(hash),
+		IsAdmin:      admin,
+		CreatedAt:    time.Now(),
+	}
+	s.users[username] = u
+	return u.Public(), s.saveLocked()
+}
+
+// Get 查询用户
+func (s *UserStore) Get(username string) (*User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return nil, false
+	}
+	return u.Public(), true
+}
+
+// List 列出所有用户
+func (s *UserStore) List() []*User {
+	s.mu.Lock()
+	list := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u.Public())
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list
+}
+
+// Authenticate 校验用户名 + 密码，或者用户名 + 个人访问令牌
+func (s *UserStore) Authenticate(username, secret string) (*User, error) {
+	if strings.HasPrefix(secret, tokenPrefix) {
+		u, err := s.AuthenticateToken(secret)
+		if err != nil || u.Username != username {
+			return nil, ErrInvalidCredentials
+		}
+		return u, nil
+	}
+
+	// 在锁里复制一份，令牌列表可能同时被 CreateToken / DeleteToken 修改
+	s.mu.Lock()
+	var hash []byte
+	var public *User
+	if u, ok := s.users[username]; ok {
+		hash, public = []byte(u.PasswordHash), u.Public()
+	}
+	s.mu.Unlock()
+	if public == nil {
+		// 用户不存在时也算一次 bcrypt，响应时间不会暴露用户名是否存在
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(secret))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(secret)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return public, nil
+}
+
+// dummyHash 和真实密码同样代价的哈希，第一次用到时才生成
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(utils.RandomID(16)), bcrypt.DefaultCost)
+	return hash
+})
+
+// AuthenticateToken 只凭令牌找到对应的用户（Bearer 认证）
+func (s *UserStore) AuthenticateToken(token string) (*User, error) {
+	hash := hashToken(token)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		for _, t := range u.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+				// 最近使用时间只精确到分钟，避免每个 git 请求都写一次盘
+				if time.Since(t.LastUsed) > time.Minute {
+					t.LastUsed = time.Now()
+					s.saveLocked()
+				}
+				return u.Public(), nil
+			}
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// CreateToken 为用户创建一个令牌，返回的明文只有这一次机会看到
+func (s *UserStore) CreateToken(username, name string) (*Token, string, error) {
+	plain := tokenPrefix + utils.RandomID(20)
+	t := &Token{
+		ID:        utils.RandomID(6),
+		Name:      name,
+		Hash:      hashToken(plain),
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return nil, "", ErrUserNotFound
+	}
+	u.Tokens = append(u.Tokens, t)
+	if err := s.saveLocked(); err != nil {
+		return nil, "", err
+	}
+	out := *t
+	out.Hash = ""
+	return &out, plain, nil
+}
+
+// DeleteToken 吊销令牌
+func (s *UserStore) DeleteToken(username, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for i, t := range u.Tokens {
+		if t.ID == id {
+			u.Tokens = append(u.Tokens[:i], u.Tokens[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+	return fmt.Errorf("token %s not found", id)
+}
+
+// saveLocked 写回磁盘，调用方必须持有 s.mu
+func (s *UserStore) saveLocked() error {
+	list := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return s.store.Save(usersFile, list)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,462 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/lfs"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+)
+
+// Options 备份和恢复共用的目录配置
+type Options struct {
+	RepoRoot string // 裸仓库目录，<RepoRoot>/<owner>/<name>.git
+	DataDir  string // 元数据目录（用户、权限、钩子、提交状态等 json 文件，以及 LFS 对象和发布附件）
+}
+
+// Create 在 outDir 下生成一个新的备份归档，返回归档路径和清单
+// incremental 为 true 时基于 outDir 里最新的备份，只打包引用有变化的仓库的新对象；还没有备份时退回全量
+// 每个仓库的引用和对象来自同一个 git bundle，和同时进行的推送互不影响；元数据文件是原子写入的，复制的都是完整的文件
+func Create(opts Options, outDir string, incremental bool) (string, *Manifest, error) {
+	// bundle 在仓库目录里生成，相对路径要先转成绝对路径
+	outDir, err := filepath.Abs(outDir)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return "", nil, err
+	}
+	now := time.Now().UTC()
+	m := &Manifest{
+		Version:   manifestVersion,
+		ID:        now.Format("20060102T150405Z"),
+		Kind:      KindFull,
+		CreatedAt: now,
+		Repos:     []*RepoEntry{},
+	}
+	var parent *Manifest
+	if incremental {
+		latest, err := Latest(outDir)
+		switch {
+		case errors.Is(err, ErrNoBackup):
+			log.Printf("⚠️ No previous backup in %s, creating a full backup", outDir)
+		case err != nil:
+			return "", nil, err
+		default:
+			if parent, err = ReadManifest(latest); err != nil {
+				return "", nil, err
+			}
+			m.Kind = KindIncremental
+			m.Parent = filepath.Base(latest)
+		}
+	}
+	archivePath := filepath.Join(outDir, archivePrefix+m.ID+archiveExt)
+	if _, err := os.Stat(archivePath); err == nil {
+		return "", nil, fmt.Errorf("backup %s already exists", archivePath)
+	}
+
+	// 1.先把所有内容放到临时目录，算好校验和，再写归档：清单要放在归档的第一个
+	staging, err := os.MkdirTemp(outDir, ".staging-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := stageMetadata(opts.DataDir, staging); err != nil {
+		return "", nil, err
+	}
+	names, err := listRepos(opts.RepoRoot)
+	if err != nil {
+		return "", nil, err
+	}
+	lfsStore, err := lfs.NewStore(filepath.Join(opts.DataDir, "lfs"))
+	if err != nil {
+		return "", nil, err
+	}
+	for _, name := range names {
+		var prev *RepoEntry
+		if parent != nil {
+			prev = parent.repo(name)
+		}
+		entry, err := stageRepo(repoPath(opts.RepoRoot, name), name, prev, staging)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to back up %s: %v", name, err)
+		}
+		if err := stageLFS(lfsStore, entry, prev, staging); err != nil {
+			return "", nil, fmt.Errorf("failed to back up LFS objects of %s: %v", name, err)
+		}
+		if err := stageReleaseAssets(opts.DataDir, entry, prev, staging); err != nil {
+			return "", nil, fmt.Errorf("failed to back up release assets of %s: %v", name, err)
+		}
+		m.Repos = append(m.Repos, entry)
+	}
+
+	// 2.校验和，然后写归档
+	if m.Files, err = checksums(staging); err != nil {
+		return "", nil, err
+	}
+	if err := writeArchive(archivePath, m, staging); err != nil {
+		os.Remove(archivePath)
+		return "", nil, err
+	}
+	return archivePath, m, nil
+}
+
+// stageMetadata 复制数据目录下的元数据文件；LFS 对象和发布附件单独按仓库处理，归档缓存不需要备份
+func stageMetadata(dataDir, staging string) error {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read data dir: %v", err)
+	}
+	dir := filepath.Join(staging, "metadata")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		if err := copyFile(filepath.Join(dataDir, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listRepos 列出 <root>/<owner>/<name>.git
+func listRepos(root string) ([]string, error) {
+	owners, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository root: %v", err)
+	}
+	var names []string
+	for _, o := range owners {
+		if !o.IsDir() {
+			continue
+		}
+		entries, _ := os.ReadDir(filepath.Join(root, o.Name()))
+		for _, e := range entries {
+			name := o.Name() + "/" + e.Name()
+			if e.IsDir() && repo.ValidateName(name) == nil {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// stageRepo 记录仓库的引用，把相对上一次备份有变化的引用打成 bundle
+// 新的提交如果上一次备份已经有了（例如分支回退到旧提交），直接记录，不需要打包
+func stageRepo(repoPath, name string, prev *RepoEntry, staging string) (*RepoEntry, error) {
+	refs, err := listRefs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	entry := &RepoEntry{Name: name, Refs: map[string]string{}}
+	if out, err := gitOutput(repoPath, "symbolic-ref", "-q", "HEAD"); err == nil {
+		entry.Head = strings.TrimSpace(out)
+	}
+
+	known := map[string]bool{}
+	if prev != nil {
+		for _, sha := range prev.Refs {
+			known[sha] = true
+		}
+	}
+	var changed []string
+	for ref, sha := range refs {
+		if known[sha] {
+			entry.Refs[ref] = sha
+		} else {
+			changed = append(changed, ref)
+		}
+	}
+	if len(changed) == 0 {
+		return entry, nil
+	}
+	sort.Strings(changed)
+
+	// 上一次备份的提交作为前提条件排除掉，被强推丢掉、又被 gc 回收的提交不能再写进去
+	var exclude []string
+	for sha := range known {
+		if objectExists(repoPath, sha) {
+			exclude = append(exclude, "^"+sha)
+		}
+	}
+	sort.Strings(exclude)
+	revs := append(append([]string{}, changed...), exclude...)
+
+	// 分支回退到上一次备份已有的提交时没有新对象，git 拒绝创建空的 bundle，直接记录
+	count, err := gitOutput(repoPath, append([]string{"rev-list", "--count", "--objects"}, revs...)...)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(count) == "0" {
+		for _, ref := range changed {
+			entry.Refs[ref] = refs[ref]
+		}
+		return entry, nil
+	}
+
+	entry.Bundle = "repos/" + name + ".bundle"
+	bundlePath := filepath.Join(staging, filepath.FromSlash(entry.Bundle))
+	if err := os.MkdirAll(filepath.Dir(bundlePath), 0700); err != nil {
+		return nil, err
+	}
+	if _, err := gitOutput(repoPath, append([]string{"bundle", "create", "--quiet", bundlePath}, revs...)...); err != nil {
+		return nil, err
+	}
+
+	// 引用的值以 bundle 为准：列引用和打包之间可能有新的推送
+	heads, err := bundleHeads(repoPath, bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range changed {
+		if sha, ok := heads[ref]; ok {
+			entry.Refs[ref] = sha
+		}
+	}
+	return entry, nil
+}
+
+// stageLFS 复制上一次备份之后新增的 LFS 对象，对象按内容寻址，不会被修改
+func stageLFS(store *lfs.Store, entry, prev *RepoEntry, staging string) error {
+	oids, err := store.Objects(entry.Name)
+	if err != nil {
+		return err
+	}
+	entry.LFSObjects = oids
+	known := map[string]bool{}
+	if prev != nil {
+		for _, oid := range prev.LFSObjects {
+			known[oid] = true
+		}
+	}
+	for _, oid := range oids {
+		if known[oid] {
+			continue
+		}
+		src, err := store.Open(entry.Name, oid)
+		if err != nil {
+			return err
+		}
+		err = writeFile(filepath.Join(staging, "lfs", filepath.FromSlash(entry.Name), oid), src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageReleaseAssets 复制上一次备份之后新增的发布附件：<data>/releases/<repo>/<发布编号>/<附件 ID>
+func stageReleaseAssets(dataDir string, entry, prev *RepoEntry, staging string) error {
+	root := filepath.Join(dataDir, "releases", filepath.FromSlash(entry.Name))
+	known := map[string]bool{}
+	if prev != nil {
+		for _, p := range prev.ReleaseAssets {
+			known[p] = true
+		}
+	}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// 跳过上传中的临时文件
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entry.ReleaseAssets = append(entry.ReleaseAssets, rel)
+		if known[rel] {
+			return nil
+		}
+		return copyFile(path, filepath.Join(staging, "releases", filepath.FromSlash(entry.Name), filepath.FromSlash(rel)))
+	})
+	sort.Strings(entry.ReleaseAssets)
+	return err
+}
+
+// checksums 计算临时目录下每个文件的 sha256
+func checksums(staging string) ([]*FileEntry, error) {
+	var files []*FileEntry
+	err := filepath.WalkDir(staging, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(staging, path)
+		if err != nil {
+			return err
+		}
+		sum, size, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, &FileEntry{Path: filepath.ToSlash(rel), Size: size, SHA256: sum})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, err
+}
+
+// writeArchive 写 tar.gz：清单在最前面，后面按清单的顺序放文件
+func writeArchive(archivePath string, m *Manifest, staging string) error {
+	f, err := os.OpenFile(archivePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(data)), ModTime: m.CreatedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, fe := range m.Files {
+		if err := addFile(tw, filepath.Join(staging, filepath.FromSlash(fe.Path)), fe, m.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func addFile(tw *tar.Writer, path string, fe *FileEntry, modTime time.Time) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	hdr := &tar.Header{Name: fe.Path, Mode: 0600, Size: fe.Size, ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// listRefs 仓库当前的所有引用
+func listRefs(repoPath string) (map[string]string, error) {
+	out, err := gitOutput(repoPath, "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return nil, err
+	}
+	return parseRefs(out), nil
+}
+
+// bundleHeads bundle 里记录的引用
+func bundleHeads(repoPath, bundlePath string) (map[string]string, error) {
+	out, err := gitOutput(repoPath, "bundle", "list-heads", bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	return parseRefs(out), nil
+}
+
+// parseRefs 解析 "<sha> <ref>" 格式的输出
+func parseRefs(out string) map[string]string {
+	refs := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		sha, ref, ok := strings.Cut(scanner.Text(), " ")
+		if ok && strings.HasPrefix(ref, "refs/") {
+			refs[ref] = sha
+		}
+	}
+	return refs
+}
+
+func objectExists(repoPath, sha string) bool {
+	cmd := exec.Command("git", "cat-file", "-e", sha)
+	cmd.Dir = repoPath
+	return cmd.Run() == nil
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+// writeFile 写文件，上级目录不存在时创建
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
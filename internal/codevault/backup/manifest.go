@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/lfs"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+)
+
+const (
+	manifestName    = "manifest.json"
+	manifestVersion = 1
+	archivePrefix   = "codevault-"
+	archiveExt      = ".tar.gz"
+)
+
+// 备份类型
+const (
+	KindFull        = "full"        // 所有对象
+	KindIncremental = "incremental" // 只有上一次备份之后新增的对象，恢复时需要整条备份链
+)
+
+// ErrNoBackup 目录里还没有备份
+var ErrNoBackup = errors.New("no previous backup found")
+
+// Manifest 备份的清单，是归档里的第一个文件，读它不需要解压整个归档
+type Manifest struct {
+	Version   int          `json:"version"`
+	ID        string       `json:"id"`
+	Kind      string       `json:"kind"`
+	Parent    string       `json:"parent,omitempty"` // 增量备份基于的上一个归档（同一目录下的文件名）
+	CreatedAt time.Time    `json:"created_at"`
+	Repos     []*RepoEntry `json:"repos"`
+	Files     []*FileEntry `json:"files"` // 除清单以外的每个文件和它的校验和
+}
+
+// RepoEntry 仓库在备份时刻的完整引用状态
+// Refs 总是完整的，增量备份的 Bundle 只包含相对上一次备份新增的对象
+type RepoEntry struct {
+	Name       string            `json:"name"`
+	Head       string            `json:"head,omitempty"` // HEAD 指向的分支，例如 refs/heads/main
+	Refs       map[string]string `json:"refs"`
+	Bundle     string            `json:"bundle,omitempty"` // 引用没有变化时没有 bundle
+	LFSObjects []string          `json:"lfs_objects,omitempty"`
+	// ReleaseAssets 发布附件，<发布编号>/<附件 ID>，附件写入后不会被修改
+	ReleaseAssets []string `json:"release_assets,omitempty"`
+}
+
+// FileEntry 归档里的一个文件
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// repo 按名字查找仓库
+func (m *Manifest) repo(name string) *RepoEntry {
+	for _, r := range m.Repos {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// file 按路径查找文件
+func (m *Manifest) file(path string) *FileEntry {
+	for _, f := range m.Files {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+// ReadManifest 读取归档开头的清单
+func ReadManifest(archivePath string) (*Manifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a CodeVault backup: %v", archivePath, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("%s is not a CodeVault backup: manifest missing", archivePath)
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest of %s: %v", archivePath, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", m.Version)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %v", archivePath, err)
+	}
+	return &m, nil
+}
+
+// validate 清单里的名字都会拼成文件路径，不能带 ../ 或绝对路径，损坏或伪造的归档不能写到目标目录外面
+func (m *Manifest) validate() error {
+	if !isLocalPath(m.ID) || strings.Contains(m.ID, "/") {
+		return fmt.Errorf("invalid backup id %q", m.ID)
+	}
+	for _, fe := range m.Files {
+		if !isLocalPath(fe.Path) {
+			return fmt.Errorf("invalid file path %q", fe.Path)
+		}
+	}
+	for _, r := range m.Repos {
+		if err := repo.ValidateName(r.Name); err != nil {
+			return err
+		}
+		if r.Bundle != "" && !isLocalPath(r.Bundle) {
+			return fmt.Errorf("invalid bundle path %q", r.Bundle)
+		}
+		for _, oid := range r.LFSObjects {
+			if !lfs.ValidOID(oid) {
+				return fmt.Errorf("invalid LFS object %q", oid)
+			}
+		}
+	}
+	return nil
+}
+
+// isLocalPath 归档内的相对路径：用 / 分隔、已经是最简形式、不会跑到所在目录外面
+func isLocalPath(p string) bool {
+	return p != "" && !strings.Contains(p, `\`) && path.Clean(p) == p && filepath.IsLocal(filepath.FromSlash(p))
+}
+
+// Latest 目录里最新的归档，文件名里是 UTC 时间戳，按名字排序就是按时间排序
+func Latest(dir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, archivePrefix+"*"+archiveExt))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", ErrNoBackup
+	}
+	sort.Strings(matches)
+	return matches[len(matches)-1], nil
+}
+
+// Chain 从全量备份开始到 archivePath 为止的整条备份链，恢复增量备份时要按顺序应用
+func Chain(archivePath string) ([]string, []*Manifest, error) {
+	var paths []string
+	var manifests []*Manifest
+	seen := map[string]bool{}
+	for path := archivePath; ; {
+		// 父归档绕回链里已经出现过的归档时，链永远走不到全量备份
+		if abs, err := filepath.Abs(path); err == nil {
+			if seen[abs] {
+				return nil, nil, fmt.Errorf("backup chain of %s has a cycle at %s", archivePath, filepath.Base(path))
+			}
+			seen[abs] = true
+		}
+		m, err := ReadManifest(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths = append([]string{path}, paths...)
+		manifests = append([]*Manifest{m}, manifests...)
+		if m.Kind == KindFull {
+			return paths, manifests, nil
+		}
+		if m.Parent == "" || strings.ContainsAny(m.Parent, `/\`) {
+			return nil, nil, fmt.Errorf("backup %s has an invalid parent %q", m.ID, m.Parent)
+		}
+		path = filepath.Join(filepath.Dir(path), m.Parent)
+	}
+}
@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chanslights/DevNexus/internal/codevault/lfs"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+)
+
+// RestoreOptions 恢复选项
+type RestoreOptions struct {
+	Options
+	Repo  string // 只恢复这一个仓库，为空时恢复整个实例（包括元数据）
+	Force bool   // 覆盖已经存在的仓库 / 非空的数据目录
+}
+
+// Restore 从归档恢复，增量备份会从全量备份开始按顺序应用整条备份链
+// 每个归档解压时都校验清单里的 sha256，有任何文件对不上都不会动目标目录
+// 恢复整个实例时服务必须是停止状态：元数据文件只在启动时读取
+// fork 恢复后是独立的仓库，不再通过 alternates 共享父仓库的对象
+func Restore(opts RestoreOptions, archivePath string) (*Manifest, error) {
+	// bundle 在临时仓库里导入，相对路径要先转成绝对路径
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	paths, manifests, err := Chain(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	final := manifests[len(manifests)-1]
+
+	var entries []*RepoEntry
+	if opts.Repo != "" {
+		if err := repo.ValidateName(opts.Repo); err != nil {
+			return nil, err
+		}
+		entry := final.repo(opts.Repo)
+		if entry == nil {
+			return nil, fmt.Errorf("repository %s is not in backup %s", opts.Repo, final.ID)
+		}
+		entries = []*RepoEntry{entry}
+	} else {
+		entries = final.Repos
+		if !opts.Force {
+			for _, dir := range []string{opts.DataDir, opts.RepoRoot} {
+				if !isEmptyDir(dir) {
+					return nil, fmt.Errorf("%s is not empty, use -force to overwrite", dir)
+				}
+			}
+		}
+	}
+	if !opts.Force {
+		for _, entry := range entries {
+			if _, err := os.Stat(repoPath(opts.RepoRoot, entry.Name)); err == nil {
+				return nil, fmt.Errorf("repository %s already exists, use -force to overwrite", entry.Name)
+			}
+		}
+	}
+
+	// 1.解压并校验整条链
+	staging, err := os.MkdirTemp(filepath.Dir(archivePath), ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	dirs := make([]string, len(paths))
+	for i, path := range paths {
+		dirs[i] = filepath.Join(staging, manifests[i].ID)
+		if err := extract(path, manifests[i], dirs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2.仓库
+	lfsStore, err := lfs.NewStore(filepath.Join(opts.DataDir, "lfs"))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := restoreRepo(opts.RepoRoot, entry, manifests, dirs); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %v", entry.Name, err)
+		}
+		if err := restoreLFS(lfsStore, entry, dirs); err != nil {
+			return nil, fmt.Errorf("failed to restore LFS objects of %s: %v", entry.Name, err)
+		}
+		if err := restoreReleaseAssets(opts.DataDir, entry, dirs); err != nil {
+			return nil, fmt.Errorf("failed to restore release assets of %s: %v", entry.Name, err)
+		}
+		log.Printf("📦 Restored repository %s (%d refs)", entry.Name, len(entry.Refs))
+	}
+
+	// 3.整个实例恢复时才覆盖元数据，单个仓库恢复时元数据（权限、钩子等）保持现状
+	if opts.Repo == "" {
+		if err := restoreMetadata(opts.DataDir, final, dirs[len(dirs)-1]); err != nil {
+			return nil, err
+		}
+	}
+	return final, nil
+}
+
+// extract 解压归档，校验每个文件的大小和 sha256，文件只能是清单里列出的
+func extract(archivePath string, m *Manifest, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", archivePath, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	seen := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", archivePath, err)
+		}
+		if hdr.Name == manifestName {
+			continue
+		}
+		fe := m.file(hdr.Name)
+		if fe == nil || seen[fe.Path] || hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("backup %s: unexpected entry %q", m.ID, hdr.Name)
+		}
+		seen[fe.Path] = true
+
+		h := sha256.New()
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(fe.Path)), io.TeeReader(tr, h)); err != nil {
+			return fmt.Errorf("backup %s: failed to extract %s: %v", m.ID, fe.Path, err)
+		}
+		if hdr.Size != fe.Size || hex.EncodeToString(h.Sum(nil)) != fe.SHA256 {
+			return fmt.Errorf("backup %s: checksum mismatch for %s", m.ID, fe.Path)
+		}
+	}
+	for _, fe := range m.Files {
+		if !seen[fe.Path] {
+			return fmt.Errorf("backup %s: %s is missing", m.ID, fe.Path)
+		}
+	}
+	return nil
+}
+
+// restoreRepo 在临时目录里按顺序导入整条链的 bundle，把引用调整成最后一次备份的状态，再换到目标位置
+func restoreRepo(root string, entry *RepoEntry, manifests []*Manifest, dirs []string) error {
+	dest := repoPath(root, entry.Name)
+	tmp := dest + ".restoring"
+	os.RemoveAll(tmp)
+	defer os.RemoveAll(tmp)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if out, err := exec.Command("git", "init", "--bare", "--quiet", tmp).CombinedOutput(); err != nil {
+		return fmt.Errorf("git init failed: %v, output: %s", err, out)
+	}
+	for i, m := range manifests {
+		e := m.repo(entry.Name)
+		if e == nil || e.Bundle == "" {
+			continue
+		}
+		bundle := filepath.Join(dirs[i], filepath.FromSlash(e.Bundle))
+		if _, err := gitOutput(tmp, "fetch", "--quiet", "--no-tags", bundle, "+refs/*:refs/*"); err != nil {
+			return err
+		}
+	}
+
+	// 中间的备份里有、最后已经删掉的引用要去掉
+	current, err := listRefs(tmp)
+	if err != nil {
+		return err
+	}
+	var cmds []string
+	for ref := range current {
+		if _, ok := entry.Refs[ref]; !ok {
+			cmds = append(cmds, "delete "+ref)
+		}
+	}
+	for ref, sha := range entry.Refs {
+		if current[ref] != sha {
+			cmds = append(cmds, "update "+ref+" "+sha)
+		}
+	}
+	if len(cmds) > 0 {
+		sort.Strings(cmds)
+		cmd := exec.Command("git", "update-ref", "--stdin")
+		cmd.Dir = tmp
+		cmd.Stdin = strings.NewReader(strings.Join(cmds, "\n") + "\n")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git update-ref failed: %v, output: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	if entry.Head != "" {
+		if _, err := gitOutput(tmp, "symbolic-ref", "HEAD", entry.Head); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// restoreLFS 恢复最后一次备份时仓库的所有 LFS 对象，对象在链里第一次出现的那个归档里
+func restoreLFS(store *lfs.Store, entry *RepoEntry, dirs []string) error {
+	for _, oid := range entry.LFSObjects {
+		var path string
+		for i := len(dirs) - 1; i >= 0; i-- {
+			p := filepath.Join(dirs[i], "lfs", filepath.FromSlash(entry.Name), oid)
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return fmt.Errorf("object %s is missing from the backup chain", oid)
+		}
+		if err := putObject(store, entry.Name, oid, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseAssetPattern 附件在仓库目录下的路径：<发布编号>/<附件 ID>
+var releaseAssetPattern = regexp.MustCompile(`^[0-9]+/[0-9a-f]+$`)
+
+// restoreReleaseAssets 恢复仓库的发布附件，和 LFS 对象一样从链里找到第一次出现的归档
+func restoreReleaseAssets(dataDir string, entry *RepoEntry, dirs []string) error {
+	root := filepath.Join(dataDir, "releases", filepath.FromSlash(entry.Name))
+	for _, rel := range entry.ReleaseAssets {
+		if !releaseAssetPattern.MatchString(rel) {
+			return fmt.Errorf("invalid asset path %q", rel)
+		}
+		var path string
+		for i := len(dirs) - 1; i >= 0; i-- {
+			p := filepath.Join(dirs[i], "releases", filepath.FromSlash(entry.Name), filepath.FromSlash(rel))
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+		if path == "" {
+			return fmt.Errorf("asset %s is missing from the backup chain", rel)
+		}
+		if err := copyFile(path, filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putObject(store *lfs.Store, name, oid, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return store.Put(name, oid, info.Size(), f)
+}
+
+// restoreMetadata 把元数据文件放回数据目录，先写临时文件再改名
+func restoreMetadata(dataDir string, m *Manifest, dir string) error {
+	for _, fe := range m.Files {
+		name, ok := strings.CutPrefix(fe.Path, "metadata/")
+		if !ok {
+			continue
+		}
+		if !isLocalPath(name) {
+			return fmt.Errorf("invalid metadata file %q", fe.Path)
+		}
+		tmp := filepath.Join(dataDir, name+".tmp")
+		if err := copyFile(filepath.Join(dir, "metadata", name), tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, filepath.Join(dataDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func repoPath(root, name string) string {
+	return filepath.Join(root, filepath.FromSlash(name))
+}
+
+// isEmptyDir 目录不存在也算空
+func isEmptyDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err != nil || len(entries) == 0
+}
@@ -0,0 +1,300 @@
+package browse
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 浏览仓库内容的只读接口，需要仓库读权限
+type API struct {
+	repos      *repo.Manager
+	policy     *access.Policy
+	signatures *signing.Verifier
+}
+
+// NewAPI 创建浏览接口，signatures 为 nil 时提交不带签名验证结果
+func NewAPI(repos *repo.Manager, policy *access.Policy, signatures *signing.Verifier) *API {
+	return &API{repos: repos, policy: policy, signatures: signatures}
+}
+
+// RegisterRoutes 注册路由
+// ref 和 path 通过查询参数传递，因为分支名和路径里都可能带 "/"
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/refs", a.handleRefs)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/tags/{tag...}", a.handleTag)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/tree", a.handleTree)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/raw", a.handleRaw)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/commits", a.handleLog)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/commits/{sha}", a.handleCommit)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/commits/{sha}/diff", a.handleCommitDiff)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/compare/{spec...}", a.handleCompare)
+}
+
+// open 检查权限并打开仓库，失败时已经写好了响应
+func (a *API) open(w http.ResponseWriter, r *http.Request) (*Reader, bool) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return nil, false
+	}
+	if !a.repos.Exists(name) {
+		utils.WriteError(w, 404, repo.ErrNotFound.Error())
+		return nil, false
+	}
+	return Open(a.repos.Path(name)), true
+}
+
+// resolve 打开仓库并解析 ref（查询参数，默认 HEAD）
+func (a *API) resolve(w http.ResponseWriter, r *http.Request, ref string) (*Reader, string, bool) {
+	reader, ok := a.open(w, r)
+	if !ok {
+		return nil, "", false
+	}
+	sha, err := reader.Resolve(ref)
+	if err != nil {
+		writeError(w, err)
+		return nil, "", false
+	}
+	return reader, sha, true
+}
+
+func (a *API) handleRefs(w http.ResponseWriter, r *http.Request) {
+	reader, ok := a.open(w, r)
+	if !ok {
+		return
+	}
+	refs, err := reader.Refs()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, refs)
+}
+
+func (a *API) handleTree(w http.ResponseWriter, r *http.Request) {
+	reader, sha, ok := a.resolve(w, r, r.URL.Query().Get("ref"))
+	if !ok {
+		return
+	}
+	entries, err := reader.Tree(sha, r.URL.Query().Get("path"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, map[string]any{"commit": sha, "entries": entries})
+}
+
+// handleRaw 下载文件原始内容
+func (a *API) handleRaw(w http.ResponseWriter, r *http.Request) {
+	reader, sha, ok := a.resolve(w, r, r.URL.Query().Get("ref"))
+	if !ok {
+		return
+	}
+	file := r.URL.Query().Get("path")
+	size, err := reader.BlobSize(sha, file)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// 1.先按扩展名判断类型，判断不出来再看内容
+	sw := &sniffWriter{w: w, contentType: mime.TypeByExtension(path.Ext(file))}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("X-DevNexus-Commit", sha)
+
+	// 2.边读边写，大文件不进内存
+	if err := reader.WriteBlob(sw, sha, file); err != nil {
+		// 响应头可能已经发出去了，只能记日志
+		log.Printf("❌ Failed to read %s at %s: %v", file, sha, err)
+		return
+	}
+	sw.flush()
+}
+
+// handleLog 提交历史，支持 ref、path 过滤和分页，总数放在 X-Total-Count 头里
+func (a *API) handleLog(w http.ResponseWriter, r *http.Request) {
+	reader, sha, ok := a.resolve(w, r, r.URL.Query().Get("ref"))
+	if !ok {
+		return
+	}
+	file := r.URL.Query().Get("path")
+	page, perPage := utils.Pagination(r)
+
+	total, err := reader.Count(sha, file)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	commits, err := reader.Log(sha, file, (page-1)*perPage, perPage)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	a.verify(reader, commits)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	utils.WriteJSON(w, 200, commits)
+}
+
+func (a *API) handleCommit(w http.ResponseWriter, r *http.Request) {
+	reader, sha, ok := a.resolve(w, r, r.PathValue("sha"))
+	if !ok {
+		return
+	}
+	detail, err := reader.Commit(sha)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	commits := []Commit{detail.Commit}
+	a.verify(reader, commits)
+	detail.Commit = commits[0]
+	utils.WriteJSON(w, 200, detail)
+}
+
+func (a *API) handleCommitDiff(w http.ResponseWriter, r *http.Request) {
+	reader, sha, ok := a.resolve(w, r, r.PathValue("sha"))
+	if !ok {
+		return
+	}
+	diff, err := reader.CommitDiff(sha)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, diff)
+}
+
+// handleCompare 对比 base...head，分支名里可能有 "/"，所以 spec 匹配剩下的整段路径
+func (a *API) handleCompare(w http.ResponseWriter, r *http.Request) {
+	baseRef, headRef, found := strings.Cut(r.PathValue("spec"), "...")
+	if !found || baseRef == "" || headRef == "" {
+		utils.WriteError(w, 400, "compare spec must look like base...head")
+		return
+	}
+	reader, base, ok := a.resolve(w, r, baseRef)
+	if !ok {
+		return
+	}
+	head, err := reader.Resolve(headRef)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	cmp, err := reader.Compare(base, head)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	a.verify(reader, cmp.Commits)
+	utils.WriteJSON(w, 200, cmp)
+}
+
+// handleTag 标签详情，附注标签带签名验证结果
+func (a *API) handleTag(w http.ResponseWriter, r *http.Request) {
+	reader, ok := a.open(w, r)
+	if !ok {
+		return
+	}
+	tag, err := reader.Tag(r.PathValue("tag"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if tag.Annotated && a.signatures != nil {
+		results, err := a.signatures.VerifyObjects(reader.path, nil, []string{tag.SHA})
+		if err != nil {
+			log.Printf("⚠️ Failed to verify tag %s: %v", tag.SHA, err)
+		}
+		tag.Verification = results[tag.SHA]
+	}
+	utils.WriteJSON(w, 200, tag)
+}
+
+// verify 给提交填上签名验证结果，验证失败不影响接口本身
+func (a *API) verify(reader *Reader, commits []Commit) {
+	if a.signatures == nil || len(commits) == 0 {
+		return
+	}
+	shas := make([]string, len(commits))
+	for i, c := range commits {
+		shas[i] = c.SHA
+	}
+	results, err := a.signatures.VerifyObjects(reader.path, nil, shas)
+	if err != nil {
+		log.Printf("⚠️ Failed to verify commit signatures: %v", err)
+		return
+	}
+	for i := range commits {
+		commits[i].Verification = results[commits[i].SHA]
+	}
+}
+
+// sniffWriter 缓存前 512 字节用来判断内容类型，判断完再把响应头和内容一起发出去
+type sniffWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	buf         []byte
+	started     bool
+}
+
+func (s *sniffWriter) Write(p []byte) (int, error) {
+	if s.started {
+		return s.w.Write(p)
+	}
+	s.buf = append(s.buf, p...)
+	if len(s.buf) >= 512 {
+		if err := s.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush 确定内容类型并写出缓存的内容，文件不足 512 字节时由调用方在最后调用
+func (s *sniffWriter) flush() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	if s.contentType == "" {
+		s.contentType = http.DetectContentType(s.buf)
+	}
+	s.w.Header().Set("Content-Type", safeContentType(s.contentType))
+	_, err := s.w.Write(s.buf)
+	s.buf = nil
+	return err
+}
+
+// safeContentType 仓库里的 HTML、SVG、脚本按纯文本返回，避免在站点域名下被浏览器执行
+func safeContentType(ct string) string {
+	base, _, _ := strings.Cut(ct, ";")
+	switch {
+	case base == "text/html", base == "image/svg+xml", strings.Contains(base, "javascript"), strings.Contains(base, "xml"):
+		return "text/plain; charset=utf-8"
+	}
+	return ct
+}
+
+// writeError 把浏览模块的错误映射成 HTTP 状态码
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrRefNotFound), errors.Is(err, ErrPathNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrNotDirectory), errors.Is(err, ErrNotFile):
+		utils.WriteError(w, 400, err.Error())
+	default:
+		log.Printf("❌ Browse request failed: %v", err)
+		utils.WriteError(w, 500, "failed to read repository")
+	}
+}
@@ -0,0 +1,313 @@
+package browse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxDiffFiles       = 300         // 最多返回多少个文件
+	maxFilePatchBytes  = 100 * 1024  // 单个文件的 patch 超过这个大小就不返回内容
+	maxTotalPatchBytes = 1024 * 1024 // 所有 patch 加起来的上限
+	maxCompareCommits  = 250         // 对比时最多列出多少个提交
+
+	emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904" // git 的空树，根提交和它比较
+)
+
+// FileDiff 一个文件的改动统计和 unified diff
+type FileDiff struct {
+	ChangedFile
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+	Patch     string `json:"patch,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // patch 太大没有返回
+}
+
+// Diff 两个提交之间的改动
+type Diff struct {
+	Files     []FileDiff `json:"files"`
+	Additions int        `json:"additions"`
+	Deletions int        `json:"deletions"`
+	Truncated bool       `json:"truncated,omitempty"` // 文件数或总大小超过上限，部分文件没有返回或没有 patch
+}
+
+// Comparison base...head 的对比结果，和 GitHub 一样从合并基点开始比较
+type Comparison struct {
+	Base      string   `json:"base"`
+	Head      string   `json:"head"`
+	MergeBase string   `json:"merge_base,omitempty"`
+	Status    string   `json:"status"` // identical、ahead、behind、diverged
+	AheadBy   int      `json:"ahead_by"`
+	BehindBy  int      `json:"behind_by"`
+	Commits   []Commit `json:"commits"` // head 上有、base 上没有的提交，从旧到新
+	Diff
+}
+
+// CommitDiff 单个提交相对第一个父提交的改动
+type CommitDiff struct {
+	SHA    string `json:"sha"`
+	Parent string `json:"parent,omitempty"`
+	Diff
+}
+
+// Compare 对比两个已经解析好的提交
+func (r *Reader) Compare(base, head string) (*Comparison, error) {
+	c := &Comparison{Base: base, Head: head}
+
+	// 1.领先 / 落后的提交数
+	out, err := r.git("rev-list", "--left-right", "--count", base+"..."+head)
+	if err != nil {
+		return nil, err
+	}
+	counts := strings.Fields(string(out))
+	if len(counts) != 2 {
+		return nil, fmt.Errorf("unexpected rev-list output: %q", out)
+	}
+	c.BehindBy, _ = strconv.Atoi(counts[0])
+	c.AheadBy, _ = strconv.Atoi(counts[1])
+	switch {
+	case c.AheadBy == 0 && c.BehindBy == 0:
+		c.Status = "identical"
+	case c.BehindBy == 0:
+		c.Status = "ahead"
+	case c.AheadBy == 0:
+		c.Status = "behind"
+	default:
+		c.Status = "diverged"
+	}
+
+	// 2.合并基点，两个没有共同历史的提交直接比较
+	from := base
+	if out, err := r.git("merge-base", base, head); err == nil {
+		c.MergeBase = strings.TrimSpace(string(out))
+		from = c.MergeBase
+	}
+
+	// 3.提交列表
+	c.Commits = []Commit{}
+	if base != head {
+		if c.Commits, err = r.logRange(base+".."+head, maxCompareCommits); err != nil {
+			return nil, err
+		}
+	}
+
+	// 4.文件改动
+	diff, err := r.Diff(from, head)
+	if err != nil {
+		return nil, err
+	}
+	c.Diff = *diff
+	return c, nil
+}
+
+// CommitDiff 单个提交的改动，根提交和空树比较
+func (r *Reader) CommitDiff(sha string) (*CommitDiff, error) {
+	out, err := r.git("rev-list", "--parents", "-n", "1", sha)
+	if err != nil {
+		return nil, err
+	}
+	cd := &CommitDiff{SHA: sha}
+	from := emptyTree
+	if parents := strings.Fields(string(out)); len(parents) > 1 {
+		cd.Parent = parents[1]
+		from = cd.Parent
+	}
+	diff, err := r.Diff(from, sha)
+	if err != nil {
+		return nil, err
+	}
+	cd.Diff = *diff
+	return cd, nil
+}
+
+// Diff 两个提交（或树）之间的改动，带重命名检测
+func (r *Reader) Diff(from, to string) (*Diff, error) {
+	// 1.文件列表和状态
+	out, err := r.git("diff", "-M", "--name-status", "-z", from, to)
+	if err != nil {
+		return nil, err
+	}
+	changed := parseNameStatus(string(out))
+
+	// 2.增删行数，二进制文件的行数是 "-"
+	out, err = r.git("diff", "-M", "--numstat", "-z", from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats := parseNumstat(string(out))
+	if len(stats) != len(changed) {
+		return nil, fmt.Errorf("diff output mismatch: %d files, %d stats", len(changed), len(stats))
+	}
+
+	d := &Diff{Files: []FileDiff{}}
+	for i, f := range changed {
+		fd := FileDiff{ChangedFile: f, Additions: stats[i].additions, Deletions: stats[i].deletions, Binary: stats[i].binary}
+		d.Additions += fd.Additions
+		d.Deletions += fd.Deletions
+		if len(d.Files) == maxDiffFiles {
+			d.Truncated = true
+			continue
+		}
+		d.Files = append(d.Files, fd)
+	}
+
+	// 3.patch 内容，和文件列表顺序一致
+	patches, truncated, err := r.patches(from, to, len(d.Files))
+	if err != nil {
+		return nil, err
+	}
+	d.Truncated = d.Truncated || truncated
+	for i := range d.Files {
+		f := &d.Files[i]
+		if f.Binary || i >= len(patches) {
+			f.Truncated = !f.Binary
+			continue
+		}
+		if patches[i].truncated {
+			f.Truncated = true
+			continue
+		}
+		f.Patch = patches[i].text
+	}
+	return d, nil
+}
+
+// logRange 列出一个范围内的提交，从旧到新
+func (r *Reader) logRange(rangeSpec string, limit int) ([]Commit, error) {
+	out, err := r.git("log", commitFormat, "--max-count="+strconv.Itoa(limit), rangeSpec)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		if c, ok := parseCommit(rec); ok {
+			commits = append(commits, c)
+		}
+	}
+	list := make([]Commit, 0, len(commits))
+	for i := len(commits) - 1; i >= 0; i-- {
+		list = append(list, commits[i])
+	}
+	return list, nil
+}
+
+// numstat 一个文件的增删行数
+type numstat struct {
+	additions int
+	deletions int
+	binary    bool
+}
+
+// parseNumstat 解析 diff --numstat -z 的输出
+// 格式：<add> TAB <del> TAB <path> NUL，重命名时 path 为空，后面跟 <old> NUL <new> NUL
+func parseNumstat(out string) []numstat {
+	var stats []numstat
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		var s numstat
+		if parts[0] == "-" {
+			s.binary = true
+		} else {
+			s.additions, _ = strconv.Atoi(parts[0])
+			s.deletions, _ = strconv.Atoi(parts[1])
+		}
+		if parts[2] == "" {
+			i += 2 // 跳过重命名的两个路径
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// patch 一个文件的 unified diff
+type patch struct {
+	text      string
+	truncated bool
+}
+
+// patches 按顺序切出每个文件的 patch，最多 limit 个
+// 单个文件过大时只标记截断；总大小超过上限就停止读取，后面的文件都没有 patch
+func (r *Reader) patches(from, to string, limit int) ([]patch, bool, error) {
+	cmd := exec.Command("git", "diff", "-M", "--no-color", "--no-ext-diff", from, to)
+	cmd.Dir = r.path
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, false, err
+	}
+
+	var list []patch
+	var cur *strings.Builder
+	total, truncated := 0, false
+	finish := func() {
+		if cur != nil {
+			list[len(list)-1].text = cur.String()
+			cur = nil
+		}
+	}
+
+	// ReadLine 会把超长的行（比如压缩过的 JS）拆成多段返回，不会一次读进内存
+	rd := bufio.NewReaderSize(stdout, 64*1024)
+	lineStart := true
+	for {
+		frag, isPrefix, err := rd.ReadLine()
+		if err != nil {
+			break
+		}
+		if lineStart && bytes.HasPrefix(frag, []byte("diff --git ")) {
+			finish()
+			if len(list) == limit {
+				truncated = true
+				break
+			}
+			list = append(list, patch{})
+			cur = &strings.Builder{}
+		}
+		lineStart = !isPrefix
+		if cur == nil {
+			continue
+		}
+		n := len(frag)
+		if !isPrefix {
+			n++
+		}
+		if cur.Len()+n > maxFilePatchBytes {
+			list[len(list)-1].truncated = true
+			cur = nil
+			continue
+		}
+		if total+n > maxTotalPatchBytes {
+			list[len(list)-1].truncated = true
+			truncated = true
+			cur = nil
+			break
+		}
+		cur.Write(frag)
+		if !isPrefix {
+			cur.WriteByte('\n')
+		}
+		total += n
+	}
+	finish()
+
+	if truncated {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return list, true, nil
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, false, fmt.Errorf("git diff failed: %v", err)
+	}
+	return list, false, nil
+}
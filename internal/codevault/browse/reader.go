@@ -0,0 +1,382 @@
+package browse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+)
+
+var (
+	// ErrRefNotFound 分支、标签或提交不存在
+	ErrRefNotFound = errors.New("ref not found")
+	// ErrPathNotFound 路径在这个提交里不存在
+	ErrPathNotFound = errors.New("path not found")
+	// ErrNotDirectory 路径是文件，不能列目录
+	ErrNotDirectory = errors.New("path is not a directory")
+	// ErrNotFile 路径是目录，不能下载
+	ErrNotFile = errors.New("path is not a file")
+)
+
+// Ref 分支或标签
+type Ref struct {
+	Name   string `json:"name"` // 例如 main、v1.0
+	Ref    string `json:"ref"`  // 例如 refs/heads/main
+	Type   string `json:"type"` // branch 或 tag
+	Commit string `json:"commit"`
+}
+
+// TreeEntry 目录里的一项
+type TreeEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"` // blob、tree 或 commit（子模块）
+	Mode string `json:"mode"`
+	SHA  string `json:"sha"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// Signature 作者或提交者
+type Signature struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
+}
+
+// Commit 提交的基本信息
+type Commit struct {
+	SHA       string    `json:"sha"`
+	Parents   []string  `json:"parents"`
+	Author    Signature `json:"author"`
+	Committer Signature `json:"committer"`
+	Subject   string    `json:"subject"`
+	Message   string    `json:"message"`
+
+	Verification *signing.Verification `json:"verification,omitempty"` // 签名验证结果
+}
+
+// Tag 标签详情，轻量标签没有标签对象，也就没有 Tagger、Message 和签名
+type Tag struct {
+	Name      string     `json:"name"`
+	SHA       string     `json:"sha"`    // 附注标签是标签对象的 SHA，轻量标签和 Commit 相同
+	Commit    string     `json:"commit"` // 标签指向的提交
+	Annotated bool       `json:"annotated"`
+	Tagger    *Signature `json:"tagger,omitempty"`
+	Message   string     `json:"message,omitempty"`
+
+	Verification *signing.Verification `json:"verification,omitempty"`
+}
+
+// ChangedFile 提交里改动的一个文件
+type ChangedFile struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"` // 重命名或复制前的路径
+	Status  string `json:"status"`             // added、modified、deleted、renamed、copied、typechange
+}
+
+// CommitDetail 单个提交的详情，Files 是相对第一个父提交的改动
+type CommitDetail struct {
+	Commit
+	Files []ChangedFile `json:"files"`
+}
+
+// Reader 直接读取磁盘上的裸仓库
+type Reader struct {
+	path string
+}
+
+// Open 打开一个裸仓库，调用方需要先确认仓库存在
+func Open(path string) *Reader {
+	return &Reader{path: path}
+}
+
+// git 在仓库里执行 git 命令，出错时把 stderr 带上
+func (r *Reader) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.path
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Resolve 把分支名、标签名或 SHA 解析成提交 SHA，空字符串表示 HEAD
+// 后面的命令都只用解析出来的 SHA，用户输入不会被当成命令行参数
+func (r *Reader) Resolve(ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", ErrRefNotFound
+	}
+	out, err := r.git("rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", ErrRefNotFound
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Refs 列出所有分支和标签，附注标签解析到它指向的提交
+func (r *Reader) Refs() ([]Ref, error) {
+	out, err := r.git("for-each-ref", "--format=%(refname)%00%(objectname)%00%(*objectname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	refs := []Ref{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		ref := Ref{Ref: fields[0], Commit: fields[1]}
+		if fields[2] != "" {
+			ref.Commit = fields[2]
+		}
+		if name, ok := strings.CutPrefix(ref.Ref, "refs/heads/"); ok {
+			ref.Name, ref.Type = name, "branch"
+		} else {
+			ref.Name, ref.Type = strings.TrimPrefix(ref.Ref, "refs/tags/"), "tag"
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// Tag 查询单个标签，message 里去掉了签名
+func (r *Reader) Tag(name string) (*Tag, error) {
+	if name == "" || strings.HasPrefix(name, "-") {
+		return nil, ErrRefNotFound
+	}
+	out, err := r.git("for-each-ref",
+		"--format=%(refname)%1f%(objecttype)%1f%(objectname)%1f%(*objectname)%1f%(taggername)%1f%(taggeremail:trim)%1f%(taggerdate:iso-strict)%1f%(contents:subject)%0a%0a%(contents:body)%1e",
+		"refs/tags/"+name)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		fields := strings.Split(strings.TrimLeft(rec, "\n"), "\x1f")
+		if len(fields) != 8 || fields[0] != "refs/tags/"+name {
+			continue
+		}
+		t := &Tag{Name: name, SHA: fields[2], Commit: fields[2]}
+		if fields[1] == "tag" {
+			date, _ := time.Parse(time.RFC3339, fields[6])
+			t.Annotated = true
+			t.Commit = fields[3]
+			t.Tagger = &Signature{Name: fields[4], Email: fields[5], Date: date}
+			t.Message = strings.TrimSpace(fields[7])
+		}
+		return t, nil
+	}
+	return nil, ErrRefNotFound
+}
+
+// objectType 查询 sha:path 对应对象的类型
+func (r *Reader) objectType(sha, path string) (string, error) {
+	out, err := r.git("cat-file", "-t", sha+":"+path)
+	if err != nil {
+		return "", ErrPathNotFound
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Tree 列出某个提交里某个目录的内容，path 为空表示根目录
+func (r *Reader) Tree(sha, path string) ([]TreeEntry, error) {
+	path = strings.Trim(path, "/")
+	typ, err := r.objectType(sha, path)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "tree" {
+		return nil, ErrNotDirectory
+	}
+
+	out, err := r.git("ls-tree", "-l", "-z", sha+":"+path)
+	if err != nil {
+		return nil, err
+	}
+	entries := []TreeEntry{}
+	for _, rec := range strings.Split(string(out), "\x00") {
+		// 格式：<mode> SP <type> SP <sha> SP <size> TAB <name>
+		meta, name, ok := strings.Cut(rec, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 {
+			continue
+		}
+		e := TreeEntry{Name: name, Path: name, Mode: fields[0], Type: fields[1], SHA: fields[2]}
+		if path != "" {
+			e.Path = path + "/" + name
+		}
+		e.Size, _ = strconv.ParseInt(fields[3], 10, 64) // 目录和子模块的 size 是 "-"
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// TreeSHA 查询某个提交里某个目录的树对象，path 为空表示根目录
+func (r *Reader) TreeSHA(sha, path string) (string, error) {
+	path = strings.Trim(path, "/")
+	typ, err := r.objectType(sha, path)
+	if err != nil {
+		return "", err
+	}
+	if typ != "tree" {
+		return "", ErrNotDirectory
+	}
+	out, err := r.git("rev-parse", sha+":"+path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// BlobSize 查询文件大小，路径不存在或不是文件时报错
+func (r *Reader) BlobSize(sha, path string) (int64, error) {
+	path = strings.Trim(path, "/")
+	typ, err := r.objectType(sha, path)
+	if err != nil {
+		return 0, err
+	}
+	if typ != "blob" {
+		return 0, ErrNotFile
+	}
+	out, err := r.git("cat-file", "-s", sha+":"+path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// WriteBlob 把文件内容写到 w，大文件也不会整个读进内存
+func (r *Reader) WriteBlob(w io.Writer, sha, path string) error {
+	cmd := exec.Command("git", "cat-file", "blob", sha+":"+strings.Trim(path, "/"))
+	cmd.Dir = r.path
+	cmd.Stdout = w
+	return cmd.Run()
+}
+
+// 提交格式：字段之间用 0x1f 分隔，提交之间用 0x1e 分隔，提交说明里基本不会出现这两个字符
+const commitFormat = "--format=%H%x1f%P%x1f%an%x1f%ae%x1f%aI%x1f%cn%x1f%ce%x1f%cI%x1f%B%x1e"
+
+// Log 从某个提交开始按时间倒序列出提交，path 不为空时只看改动了这个路径的提交
+func (r *Reader) Log(sha, path string, skip, limit int) ([]Commit, error) {
+	args := []string{"log", commitFormat, "--skip=" + strconv.Itoa(skip), "--max-count=" + strconv.Itoa(limit), sha}
+	if path = strings.Trim(path, "/"); path != "" {
+		args = append(args, "--", path)
+	}
+	out, err := r.git(args...)
+	if err != nil {
+		return nil, err
+	}
+	commits := []Commit{}
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		if c, ok := parseCommit(rec); ok {
+			commits = append(commits, c)
+		}
+	}
+	return commits, nil
+}
+
+// Count 统计 Log 能列出的提交总数，用于分页
+func (r *Reader) Count(sha, path string) (int, error) {
+	args := []string{"rev-list", "--count", sha}
+	if path = strings.Trim(path, "/"); path != "" {
+		args = append(args, "--", path)
+	}
+	out, err := r.git(args...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// Commit 查询单个提交的详情
+func (r *Reader) Commit(sha string) (*CommitDetail, error) {
+	out, err := r.git("show", "-s", commitFormat, sha)
+	if err != nil {
+		return nil, err
+	}
+	rec, _, _ := strings.Cut(string(out), "\x1e")
+	c, ok := parseCommit(rec)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse commit %s", sha)
+	}
+
+	// 和第一个父提交比较；根提交和空树比较
+	args := []string{"diff-tree", "-r", "-M", "--name-status", "-z"}
+	if len(c.Parents) > 0 {
+		args = append(args, c.Parents[0], sha)
+	} else {
+		args = append(args, "--root", sha)
+	}
+	out, err = r.git(args...)
+	if err != nil {
+		return nil, err
+	}
+	return &CommitDetail{Commit: c, Files: parseNameStatus(string(out))}, nil
+}
+
+// parseCommit 解析一条 commitFormat 格式的记录
+func parseCommit(rec string) (Commit, bool) {
+	fields := strings.Split(strings.TrimLeft(rec, "\n"), "\x1f")
+	if len(fields) != 9 {
+		return Commit{}, false
+	}
+	author, _ := time.Parse(time.RFC3339, fields[4])
+	committer, _ := time.Parse(time.RFC3339, fields[7])
+	message := strings.TrimSpace(fields[8])
+	subject, _, _ := strings.Cut(message, "\n")
+	return Commit{
+		SHA:       fields[0],
+		Parents:   strings.Fields(fields[1]),
+		Author:    Signature{Name: fields[2], Email: fields[3], Date: author},
+		Committer: Signature{Name: fields[5], Email: fields[6], Date: committer},
+		Subject:   subject,
+		Message:   message,
+	}, true
+}
+
+// parseNameStatus 解析 diff-tree --name-status -z 的输出
+// 格式：<status> NUL <path> NUL，重命名和复制是 <status> NUL <old> NUL <new> NUL
+func parseNameStatus(out string) []ChangedFile {
+	files := []ChangedFile{}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status := fields[i]
+		if status == "" {
+			continue
+		}
+		f := ChangedFile{Path: fields[i+1]}
+		switch status[0] {
+		case 'A':
+			f.Status = "added"
+		case 'D':
+			f.Status = "deleted"
+		case 'T':
+			f.Status = "typechange"
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return files
+			}
+			f.Status = map[byte]string{'R': "renamed", 'C': "copied"}[status[0]]
+			f.OldPath, f.Path = fields[i+1], fields[i+2]
+			i++
+		default:
+			f.Status = "modified"
+		}
+		files = append(files, f)
+	}
+	return files
+}
@@ -0,0 +1,203 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/browse"
+)
+
+// DefaultArchiveCacheMaxBytes 归档缓存默认上限 1GB，超过后删除最久没被下载的文件
+const DefaultArchiveCacheMaxBytes int64 = 1 << 30
+
+// archiveFormat URL 后缀对应的 git archive 格式
+type archiveFormat struct {
+	ext         string
+	format      string
+	contentType string
+}
+
+var archiveFormats = []archiveFormat{
+	{ext: ".tar.gz", format: "tar.gz", contentType: "application/gzip"},
+	{ext: ".zip", format: "zip", contentType: "application/zip"},
+}
+
+// handleArchive 下载某个引用的源码归档：GET /<repo>/archive/<ref>.tar.gz|.zip[?path=子目录]
+// 内容只取决于树对象，所以用树的 SHA 做 ETag 和缓存文件名，同一棵树在不同分支、标签下只打包一次
+func (h *Handler) handleArchive(w http.ResponseWriter, r *http.Request, repoPath, spec string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+
+	// 1.从后缀解析格式，剩下的部分是引用，引用里可以有 /
+	var f *archiveFormat
+	for i := range archiveFormats {
+		if strings.HasSuffix(spec, archiveFormats[i].ext) {
+			f = &archiveFormats[i]
+			break
+		}
+	}
+	if f == nil {
+		http.Error(w, "Unsupported archive format", 404)
+		return
+	}
+	ref := strings.TrimSuffix(spec, f.ext)
+
+	// 2.解析引用和子目录，得到要打包的树
+	reader := browse.Open(repoPath)
+	sha, err := reader.Resolve(ref)
+	if err != nil {
+		http.Error(w, "Ref not found", 404)
+		return
+	}
+	subPath := strings.Trim(r.URL.Query().Get("path"), "/")
+	tree, err := reader.TreeSHA(sha, subPath)
+	switch {
+	case errors.Is(err, browse.ErrPathNotFound):
+		http.Error(w, "Path not found", 404)
+		return
+	case errors.Is(err, browse.ErrNotDirectory):
+		http.Error(w, "Path is not a directory", 400)
+		return
+	case err != nil:
+		log.Printf("Failed to resolve archive tree for %s: %v", repoPath, err)
+		http.Error(w, "Failed to read repository", 500)
+		return
+	}
+
+	// 3.响应头：ETag 跟着树走，客户端带 If-None-Match 时直接 304
+	repoName := h.repoName(repoPath)
+	shortName := strings.TrimSuffix(filepath.Base(repoPath), ".git")
+	name := shortName + "-" + strings.ReplaceAll(ref, "/", "-")
+	if subPath != "" {
+		name += "-" + strings.ReplaceAll(subPath, "/", "-")
+	}
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+f.ext))
+	w.Header().Set("ETag", fmt.Sprintf(`"%s.%s"`, tree, f.format))
+	w.Header().Set("X-Commit-SHA", sha)
+
+	// 4.命中磁盘缓存时交给 ServeContent，它会处理 If-None-Match 和 Range
+	cachePath := h.archiveCachePath(repoName, tree, f)
+	if cachePath != "" {
+		if file, err := os.Open(cachePath); err == nil {
+			defer file.Close()
+			now := time.Now()
+			os.Chtimes(cachePath, now, now) // 更新修改时间，清理缓存时按它判断最近有没有被下载
+			info, _ := file.Stat()
+			http.ServeContent(w, r, "", info.ModTime(), file)
+			return
+		}
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && match == w.Header().Get("ETag") {
+		w.WriteHeader(304)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	// 5.没有缓存：一边流式返回给客户端一边写临时文件，完整成功后再改名成缓存文件
+	var tmp *os.File
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			tmp, _ = os.CreateTemp(filepath.Dir(cachePath), ".tmp-*")
+		}
+	}
+	var out io.Writer = w
+	if tmp != nil {
+		out = io.MultiWriter(w, tmp)
+	}
+
+	// --prefix 让解压出来的文件放在 <仓库名>/ 目录下
+	cmd := exec.Command("git", "archive", "--format="+f.format, "--prefix="+shortName+"/", tree)
+	cmd.Dir = repoPath
+	cmd.Stdout = out
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	if tmp != nil {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		} else if renameErr := os.Rename(tmp.Name(), cachePath); renameErr != nil {
+			// 客户端已经拿到完整的文件，只是没缓存上
+			log.Printf("⚠️ Failed to cache archive of %s %s: %v", repoName, ref, renameErr)
+			os.Remove(tmp.Name())
+		} else {
+			go h.pruneArchiveCache()
+		}
+	}
+	if err != nil {
+		// 响应头可能已经发出，中断连接让客户端知道下载失败，而不是拿到一个 200 的不完整文件
+		log.Printf("Git archive failed for %s %s: %v, output: %s", repoName, ref, err, strings.TrimSpace(stderr.String()))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// archiveCachePath 缓存文件位置：<缓存目录>/<仓库>/<树>.<格式>，没有配置缓存目录时返回空
+func (h *Handler) archiveCachePath(repoName, tree string, f *archiveFormat) string {
+	if h.config.ArchiveCacheDir == "" {
+		return ""
+	}
+	return filepath.Join(h.config.ArchiveCacheDir, repoName, tree+f.ext)
+}
+
+// pruneArchiveCache 缓存超过上限时，按修改时间从旧到新删除，同一时间只跑一个
+func (h *Handler) pruneArchiveCache() {
+	if !h.pruneMu.TryLock() {
+		return
+	}
+	defer h.pruneMu.Unlock()
+
+	limit := h.config.ArchiveCacheMaxBytes
+	if limit <= 0 {
+		limit = DefaultArchiveCacheMaxBytes
+	}
+
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	var total int64
+	filepath.WalkDir(h.config.ArchiveCacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cached{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if total <= limit {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= limit {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+		}
+	}
+	log.Printf("Pruned archive cache to %d bytes", total)
+}
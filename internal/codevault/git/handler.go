@@ -1,156 +1,532 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/hooks"
+	"github.com/chanslights/DevNexus/internal/codevault/protect"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
 	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
 )
 
 // Config The configuration for the Git handler
 type Config struct {
-	RepoRoot string // The root directory of the Git repository
+	RepoRoot   string // The root directory of the Git repository
+	AutoCreate bool   // 推送到不存在的仓库时是否自动创建
+
+	ArchiveCacheDir      string // 源码归档的磁盘缓存目录，为空时不缓存
+	ArchiveCacheMaxBytes int64  // 归档缓存上限，<=0 时使用 DefaultArchiveCacheMaxBytes
+}
+
+// Services The other CodeVault modules the handler depends on
+type Services struct {
+	Webhooks   *webhook.Dispatcher // 推送后触发 Webhook
+	Policy     *access.Policy      // 仓库读写权限
+	Protection *protect.Checker    // 分支保护
+	Hooks      *hooks.Manager      // 服务端 pre-receive / post-receive 钩子
+	Repos      *repo.Manager       // 仓库元数据：创建、归档、最近推送时间
+	Signatures *signing.Verifier   // 提交签名验证，分支保护要求签名时使用
 }
 
 // Handler The handler for the Git protocol
 type Handler struct {
 	config Config
+	svc    Services
+
+	pruneMu sync.Mutex // 同一时间只清理一次归档缓存
 }
 
 // NewHandler Create a new Git handler
-func NewHandler(config Config) *Handler {
+func NewHandler(config Config, services Services) *Handler {
 	// auto
 	if err := os.MkdirAll(config.RepoRoot, 0755); err != nil {
 		log.Printf("Warning:failed to create repository root: %v", err)
 	}
-	return &Handler{config: config}
+	return &Handler{config: config, svc: services}
 }
 
 // ServeHTTP 核心入口，让Handler实现http.Handler接口
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 1. 解析URL，例如： /my-project.git/info/refs
-	// pathParts[1]是repo名字（my-project.git）
-	// pathParts[2]是动作（info或者git-receive-pack)
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 2 {
+	// 1. 解析URL，例如： /alice/my-project.git/info/refs
+	// 前两段是仓库名（alice/my-project.git），后面是动作（info或者git-receive-pack)
+	repoName, pathParts, ok := splitRepoPath(r.URL.Path)
+	if !ok {
 		http.Error(w, "Invalid path", 400)
 		return
 	}
+	actions := pathParts[0]
 
-	repoName := pathParts[0]
-	actions := pathParts[1]
+	// 改名、转移过的仓库重定向到新地址，git 只在 info/refs 上跟随重定向，之后的请求都会用新地址
+	if !h.svc.Repos.Exists(repoName) {
+		if target, found := h.svc.Repos.Resolve(repoName); found {
+			h.redirect(w, r, target, pathParts)
+			return
+		}
+	}
 
 	// 2. 拼接仓库的物理路径
-	repoPath := filepath.Join(h.config.RepoRoot, repoName)
+	repoPath, ok := h.repoPath(repoName)
+	if !ok {
+		http.Error(w, "Invalid path", 400)
+		return
+	}
+
+	// 3. 计算这次请求需要的权限：拉取（upload-pack）和下载归档需要读，推送（receive-pack）需要写
+	service := actions
+	switch actions {
+	case "archive":
+		if len(pathParts) < 2 {
+			http.Error(w, "Invalid archive request", 400)
+			return
+		}
+		service = "git-upload-pack"
+	case "info":
+		if len(pathParts) < 2 || pathParts[1] != "refs" {
+			http.Error(w, "Invalid info request", 400)
+			return
+		}
+		service = r.URL.Query().Get("service")
+	}
+	required, ok := requiredLevel(service)
+	if !ok {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
 
-	// 如果文件夹不存在，自动帮助用户初始化一个Git裸仓库
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		log.Printf("Initializing new repo: %s", repoName)
-		initCmd := exec.Command("git", "init", "--bare", repoPath)
-		if err := initCmd.Run(); err != nil {
+		// 关闭自动创建时，仓库只能通过 POST /api/repos 创建；只有推送会自动创建，
+		// clone / fetch / 下载归档一个不存在的仓库（比如地址打错了）直接返回 404
+		if !h.config.AutoCreate || service != "git-receive-pack" {
+			http.Error(w, "Repository not found", 404)
+			return
+		}
+		// 如果文件夹不存在，自动帮助登录用户初始化一个Git裸仓库，创建者成为仓库管理员
+		// 用户信息由 auth.Middleware 放进 context，没登录时返回 401 + WWW-Authenticate，git 会提示输入用户名和密码（或令牌）
+		user, ok := auth.RequireUser(w, r)
+		if !ok {
+			return
+		}
+		if !h.svc.Policy.CanCreate(user, utils.RepoOwner(repoName)) {
+			http.Error(w, "Cannot create repositories under "+utils.RepoOwner(repoName), 403)
+			return
+		}
+		if err := h.autoCreate(repoName, user); err != nil {
 			http.Error(w, "Failed to init repo", 500)
 			return
 		}
+	} else if !h.svc.Policy.Require(w, r, repoName, required) {
+		// info/refs 和 RPC 两步都会走到这里，单独请求 RPC 也绕不过权限检查
+		return
 	}
-	// 3. 根据动作分发请求
+
+	// 归档的仓库只读
+	if service == "git-receive-pack" && h.svc.Repos.IsArchived(repoName) {
+		http.Error(w, "Repository is archived", 403)
+		return
+	}
+
+	// 请求体可能被 gzip 压缩
+	if err := decodeBody(r); err != nil {
+		http.Error(w, err.Error(), 415)
+		return
+	}
+
+	// 4. 根据动作分发请求
 	switch actions {
 	case "info": // 处理 info/refs 握手
-		if len(pathParts) < 3 || pathParts[2] != "refs" {
-			http.Error(w, "Invalid info request", 400)
-		}
 		h.handleInfoRefs(w, r, repoPath)
 	case "git-receive-pack": // 处理POST推送
-		h.handleRPC(w, r, repoPath, "git-receive-pack")
+		h.handleReceivePack(w, r, repoPath)
 
 	case "git-upload-pack": // 处理POST拉取(git clone)
 		h.handleRPC(w, r, repoPath, "git-upload-pack")
+	case "archive": // 下载源码归档
+		h.handleArchive(w, r, repoPath, strings.Join(pathParts[1:], "/"))
 	default:
 		http.Error(w, "Method not allowed", 405)
 	}
 
 }
 
+// splitRepoPath 把 URL 路径拆成仓库名和后面的动作，例如 /alice/demo.git/info/refs -> alice/demo.git, [info refs]
+// 第一段以 .git 结尾的是迁移之前的老地址 /demo.git/info/refs，拆出来的仓库名只能用来查重定向
+func splitRepoPath(urlPath string) (string, []string, bool) {
+	parts := strings.Split(strings.Trim(urlPath, "/"), "/")
+	n := 2
+	if strings.HasSuffix(parts[0], ".git") {
+		n = 1
+	}
+	if len(parts) <= n {
+		return "", nil, false
+	}
+	return utils.NormalizeRepoName(strings.Join(parts[:n], "/")), parts[n:], true
+}
+
+// repoPath 把仓库名解析成物理路径，HTTP 和 SSH 共用
+// 仓库名必须是 RepoRoot 下的 owner/name.git
+func (h *Handler) repoPath(repoName string) (string, bool) {
+	if repo.ValidateName(repoName) != nil {
+		return "", false
+	}
+	return filepath.Join(h.config.RepoRoot, filepath.FromSlash(repoName)), true
+}
+
+// repoName 物理路径对应的仓库名 owner/name.git
+func (h *Handler) repoName(repoPath string) string {
+	rel, err := filepath.Rel(h.config.RepoRoot, repoPath)
+	if err != nil {
+		return filepath.Base(repoPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// redirect 旧地址重定向到新仓库，没有读权限时和仓库不存在一样处理
+// GET 用 301；推送的 POST 用 307，让客户端带着请求体重发
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, target string, pathParts []string) {
+	if !h.svc.Policy.Require(w, r, target, access.Read) {
+		return
+	}
+	u := *r.URL
+	u.Path = "/" + target + "/" + strings.Join(pathParts, "/")
+	u.RawPath = ""
+	status := 301
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = 307
+	}
+	http.Redirect(w, r, u.String(), status)
+}
+
+// requiredLevel 拉取（upload-pack）需要读，推送（receive-pack）需要写
+func requiredLevel(service string) (access.Level, bool) {
+	switch service {
+	case "git-upload-pack":
+		return access.Read, true
+	case "git-receive-pack":
+		return access.Write, true
+	}
+	return access.None, false
+}
+
+// autoCreate 自动初始化一个Git裸仓库，创建者成为仓库管理员
+func (h *Handler) autoCreate(repoName string, user *auth.User) error {
+	log.Printf("Initializing new repo: %s", repoName)
+	if _, err := h.svc.Repos.Create(repo.CreateOptions{Name: repoName}, user.Username); err != nil {
+		log.Printf("Failed to init repo %s: %v", repoName, err)
+		return err
+	}
+	return nil
+}
+
 // handleInfoRefs 处理第一步：握手
 func (h *Handler) handleInfoRefs(w http.ResponseWriter, r *http.Request, repoPath string) {
 	service := r.URL.Query().Get("service") // 例如：git-receive-pack
 
 	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	noCache(w)
+
+	// 调用系统Git命令
+	cmd := serviceCommand(service, "--stateless-rpc", "--advertise-refs", repoPath)
+	cmd.Env = protocolEnv(r, service)
+
+	// 引用列表是纯文本，标签多的仓库压缩效果很明显
+	out := newStreamWriter(w, acceptsGzip(r))
 
 	// Git 协议规定的Smart HTTP响应头
 	// 格式是：十六进制长度+字符串+换行
 	// "# service=git-receive-pack\n" 的长度是 29 (1d)，加上前缀 "001d"
-	packet := fmt.Sprintf("# service=%s\n", service)
-	length := len(packet) + 4
-	fmt.Fprintf(w, "%04x%s0000", length, packet)
+	// 协议 v2 没有这一行，直接是 git 输出的能力列表（和 git http-backend 一样）
+	if !isProtocolV2(cmd.Env) {
+		packet := fmt.Sprintf("# service=%s\n", service)
+		length := len(packet) + 4
+		out.preamble = []byte(fmt.Sprintf("%04x%s0000", length, packet))
+	}
 
-	// 调用系统Git命令
-	cmd := exec.Command("git", service[4:], "--stateless-rpc", "--advertise-refs", repoPath)
-	cmd.Stdout = w // 把git的输出直接写给HTTP响应
-	cmd.Run()
+	var stderr bytes.Buffer
+	cmd.Stdout = out // 把git的输出直接写给HTTP响应
+	cmd.Stderr = &stderr
+	out.finish(commandError(cmd.Run(), &stderr))
+}
+
+// protocolEnv 把客户端的 Git-Protocol 头（例如 version=2）通过 GIT_PROTOCOL 环境变量交给 git，
+// v2 的 ls-refs（按 ref-prefix 过滤引用）和 fetch 命令都由 upload-pack 自己处理
+// receive-pack 还没有 v2，只对 upload-pack 透传；头里只允许协议参数用到的字符，防止注入别的内容
+func protocolEnv(r *http.Request, service string) []string {
+	env := os.Environ()
+	proto := r.Header.Get("Git-Protocol")
+	if service != "git-upload-pack" || proto == "" || !validProtocol(proto) {
+		return env
+	}
+	return append(env, "GIT_PROTOCOL="+proto)
+}
+
+// validProtocol GIT_PROTOCOL 的值只能是 key=value 用 : 连起来的参数
+func validProtocol(proto string) bool {
+	for _, c := range proto {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("=:._-", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isProtocolV2 客户端是否请求了协议 v2，GIT_PROTOCOL 里可以有多个用 : 分隔的参数
+func isProtocolV2(env []string) bool {
+	for _, kv := range env {
+		if proto, ok := strings.CutPrefix(kv, "GIT_PROTOCOL="); ok {
+			for _, param := range strings.Split(proto, ":") {
+				if param == "version=2" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// serviceCommand 构造 git upload-pack / receive-pack 命令
+// 允许按 SHA 拉取分支上可达的提交，OpsEngine 浅拉取要构建的那个提交时会用到；
+// 这个能力在 info/refs 里通告，两步都要带上同样的配置
+func serviceCommand(service string, args ...string) *exec.Cmd {
+	args = append([]string{"-c", "uploadpack.allowReachableSHA1InWant=true", service[4:]}, args...)
+	return exec.Command("git", args...)
 }
 
 // handleRPC 处理第二步：数据传输
 func (h *Handler) handleRPC(w http.ResponseWriter, r *http.Request, repoPath string, service string) {
 	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", service))
+	noCache(w)
 
 	// 1.调用系统git命令处理数据流
-	cmd := exec.Command("git", service[4:], "--stateless-rpc", repoPath)
-	cmd.Stdin = r.Body // 核心，把客户端上传的数据直接塞给git命令
-	cmd.Stdout = w     // 核心，把git命令的反馈直接塞回给客户端
-	if err := cmd.Run(); err != nil {
-		log.Printf("Git command failed: %v", err)
-		return
-	}
+	cmd := serviceCommand(service, "--stateless-rpc", repoPath)
+	// 协议 v2 的 ls-refs / fetch 请求也走这里
+	cmd.Env = protocolEnv(r, service)
 
-	// 如果推送操作（git-receive-pack）成功，触发webhook
-	if service == "git-receive-pack" {
-		// 为了简单起见，我们假设推送到的是 master 分支，并获取最新的 Commit ID
-		// 在真实的工蜂里，这里需要解析 git 的输入流，但那太复杂了，我们用简单粗暴的方法：
-		// 直接去仓库里问 git：现在 master 分支最新的 ID 是多少？
-		commitID := getLastestCommitID(repoPath)
-		repoName := filepath.Base(repoPath) // 获取 /repos/demo.git里面的demo.git
+	// 只压缩 v2 的 ls-refs 响应（引用列表），fetch 返回的包已经压缩过，再压一遍只是浪费 CPU
+	body := bufio.NewReader(r.Body)
+	head, _ := body.Peek(64)
+	out := newStreamWriter(w, acceptsGzip(r) && isLsRefs(head))
 
-		// 异步发送Webhook，不要阻塞 git push的命令行
-		go sendWebhookToOpsEngine(repoName, commitID)
-	}
+	var stderr bytes.Buffer
+	cmd.Stdin = body // 核心，把客户端上传的数据直接塞给git命令
+	cmd.Stdout = out // 核心，把git命令的反馈直接塞回给客户端
+	cmd.Stderr = &stderr
+	out.finish(commandError(cmd.Run(), &stderr))
 }
 
-func getLastestCommitID(repoPath string) string {
-	cmd := exec.Command("git", "rev-parse", "main")
-	cmd.Dir = repoPath // 指定在哪个文件夹下执行
-	out, err := cmd.Output()
+// handleReceivePack 处理推送：先解析出客户端要更新哪些引用，执行分支保护，再把剩下的数据流交给git
+func (h *Handler) handleReceivePack(w http.ResponseWriter, r *http.Request, repoPath string) {
+	rr, err := parseReceiveRequest(r.Body)
 	if err != nil {
-		log.Printf("Failed to get commit ID: %v", err)
-		return "unknown"
+		http.Error(w, "Invalid receive-pack request", 400)
+		return
 	}
-	return strings.TrimSpace(string(out))
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	noCache(w)
+	resp := newStreamWriter(w, false)
+	// git 失败时返回 500 或中断连接，客户端会报错而不是以为推送成功
+	resp.finish(h.receivePack(repoPath, auth.UserFromContext(r.Context()), rr, resp))
 }
 
-func sendWebhookToOpsEngine(repoName, commitID string) {
-	payload := types.WebhookPayload{
-		RepoName: repoName,
-		Branch:   "master",
-		CommitID: commitID,
-		Pusher:   "developer",
+// receivePack 推送的核心流程，HTTP 和 SSH 共用：分支保护、pre-receive 钩子、git receive-pack，
+// 成功后触发 webhook 和 post-receive 钩子；out 是返回给客户端的数据流
+func (h *Handler) receivePack(repoPath string, user *auth.User, rr *receiveRequest, out io.Writer) error {
+	repoName := h.repoName(repoPath) // 获取 /repos/alice/demo.git里面的alice/demo.git
+	// 推送期间不允许 gc / repack 等维护任务动这个仓库的对象
+	lock := h.svc.Repos.RepoLock(repoName)
+	lock.RLock()
+	defer lock.RUnlock()
+	var pusher string
+	if user != nil {
+		pusher = user.Username
+	}
+
+	// 1.需要看提交内容时才建立隔离区，没有保护规则和钩子的仓库不会多一次 index-pack
+	var q *quarantine
+	var qErr error
+	openQuarantine := func() *quarantine {
+		if q == nil && qErr == nil {
+			var pack io.Reader
+			if rr.needsPack() {
+				pack = rr.Pack
+			}
+			q, qErr = newQuarantine(repoPath, pack)
+		}
+		return q
+	}
+	defer func() {
+		if q != nil {
+			q.Close()
+		}
+	}()
+
+	// 2.分支保护
+	rejected := h.svc.Protection.Check(protect.Push{
+		Repo:    repoName,
+		User:    user,
+		Updates: rr.Updates,
+		IsAncestor: func(old, new string) bool {
+			if openQuarantine() == nil {
+				return false
+			}
+			return q.IsAncestor(old, new)
+		},
+		NewCommits: func(new string, exclude []string) (map[string]*signing.Verification, error) {
+			if openQuarantine() == nil {
+				return nil, qErr
+			}
+			return q.VerifyNewCommits(h.svc.Signatures, new, exclude)
+		},
+		Refs: func() (map[string]string, error) {
+			if openQuarantine() == nil {
+				return nil, qErr
+			}
+			return q.Refs()
+		},
+	})
+	// 3.服务端 pre-receive 钩子：只检查没被分支保护拒绝的引用，对象已经在隔离区里
+	var messages []string
+	if pending := filterUpdates(rr.Updates, rejected); len(pending) > 0 && h.svc.Hooks.HasPreReceive(repoName) {
+		if openQuarantine() != nil {
+			report := h.svc.Hooks.PreReceive(&hooks.Push{
+				Repo:        repoName,
+				RepoPath:    q.repoPath,
+				Pusher:      pusher,
+				Updates:     pending,
+				PushOptions: rr.PushOptions,
+				Env:         q.Env(),
+			})
+			messages = append(messages, report.Messages...)
+			for ref, reason := range report.Rejected {
+				rejected[ref] = reason
+			}
+		}
+	}
+	if qErr != nil {
+		log.Printf("❌ Failed to quarantine push to %s: %v", repoName, qErr)
+		return qErr
 	}
 
-	jsonData, _ := json.Marshal(payload)
+	// atomic 推送要么全部成功要么全部失败
+	if len(rejected) > 0 && rr.hasCap("atomic") {
+		for _, u := range rr.Updates {
+			if _, ok := rejected[u.Ref]; !ok {
+				rejected[u.Ref] = "atomic push failed"
+			}
+		}
+	}
+	accepted := filterUpdates(rr.Updates, rejected)
+	rejections := sortedRejections(rejected)
+	for _, rj := range rejections {
+		messages = append(messages, fmt.Sprintf("CodeVault: %s rejected: %s", rj.Ref, rj.Reason))
+		log.Printf("⛔ Push to %s by %s: %s rejected: %s", repoName, pusher, rj.Ref, rj.Reason)
+	}
 
-	opsEngineURL := "http://localhost:8081/webhook"
+	// 提示信息走 sideband 的 2 号通道，客户端会显示成 "remote: ..."
+	writeMessages(out, rr, messages)
+	if len(rr.Updates) == 0 {
+		// 大推送前客户端会先发一个只有 flush 的探测请求确认认证，receive-pack 对它也不输出任何内容
+		return nil
+	}
+	if len(accepted) == 0 {
+		writeRejectedReport(out, rr, rejections)
+		return nil
+	}
 
-	resp, err := http.Post(opsEngineURL, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("❌ Failed to send webhook: %v", err)
-		return
+	// 4.调用系统git命令处理剩下的引用
+	pack := rr.Pack
+	if q != nil {
+		pack = q.Pack()
+	}
+	if !rr.needsPack() {
+		// 只删除引用时没有 packfile；SSH 客户端要等拿到结果才关闭连接，不能一直等着读它
+		pack = strings.NewReader("")
+	}
+	var report, stderr bytes.Buffer
+	cmd := exec.Command("git", "receive-pack", "--stateless-rpc", repoPath)
+	cmd.Stdin = rr.encode(accepted, pack)
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if len(rejections) > 0 {
+		// 部分引用被拒绝，需要改写 git 的 report-status，先缓存输出
+		cmd.Stdout = &report
+	}
+	if err := cmd.Run(); err != nil {
+		return commandError(err, &stderr)
+	}
+	if len(rejections) > 0 {
+		out.Write(injectRejections(report.Bytes(), rr, rejections))
 	}
-	defer resp.Body.Close()
 
-	log.Printf("✅ Webhook sent to OpsEngine for %s (%s)", repoName, commitID)
+	// 5.推送成功，按引用逐条触发webhook和post-receive钩子
+	applied := appliedUpdates(repoPath, accepted)
+	if len(applied) > 0 {
+		h.svc.Repos.TouchPush(repoName)
+	}
+	for _, u := range applied {
+		h.publishRefUpdate(repoName, u, pusher)
+	}
+	if len(applied) > 0 {
+		absRepo, _ := filepath.Abs(repoPath)
+		go h.svc.Hooks.PostReceive(&hooks.Push{
+			Repo:        repoName,
+			RepoPath:    absRepo,
+			Pusher:      pusher,
+			Updates:     applied,
+			PushOptions: rr.PushOptions,
+			Env:         append(os.Environ(), "GIT_DIR="+absRepo),
+		})
+	}
+	return nil
+}
+
+// filterUpdates 去掉已经被拒绝的引用
+func filterUpdates(updates []types.RefUpdate, rejected map[string]string) []types.RefUpdate {
+	var list []types.RefUpdate
+	for _, u := range updates {
+		if _, ok := rejected[u.Ref]; !ok {
+			list = append(list, u)
+		}
+	}
+	return list
+}
+
+// appliedUpdates 过滤出真正生效的引用更新
+// git 可能拒绝其中一部分（比如非快进），这里直接去仓库里确认引用的当前值
+func appliedUpdates(repoPath string, updates []types.RefUpdate) []types.RefUpdate {
+	var applied []types.RefUpdate
+	for _, u := range updates {
+		cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", u.Ref)
+		cmd.Dir = repoPath // 指定在哪个文件夹下执行
+		out, err := cmd.Output()
+		current := strings.TrimSpace(string(out))
+		if u.IsDelete() && err != nil {
+			applied = append(applied, u)
+		} else if !u.IsDelete() && current == u.NewSHA {
+			applied = append(applied, u)
+		}
+	}
+	return applied
+}
+
+// publishRefUpdate 把一条引用更新翻译成对应的事件，Dispatcher 内部异步投递，不会阻塞 git push的命令行
+func (h *Handler) publishRefUpdate(repoName string, u types.RefUpdate, pusher string) {
+	if h.svc.Webhooks == nil {
+		return
+	}
+	h.svc.Webhooks.PublishRefUpdate(repoName, u, pusher)
 }
@@ -0,0 +1,226 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+)
+
+// testServer 在临时目录里准备一个公开的裸仓库 alice/demo.git（main 分支 + v1.0 标签），
+// 用 httptest 跑真实的 Handler，返回仓库的 URL
+func testServer(t *testing.T) string {
+	t.Helper()
+	url, _ := newTestServer(t, Config{})
+	return url
+}
+
+// newTestServer 同 testServer，可以修改配置，额外返回仓库根目录
+func newTestServer(t *testing.T, config Config) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	// 不读取本机的 git 配置，避免 protocol.version 之类的设置影响结果
+	t.Setenv("HOME", dir)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+
+	st, err := store.New(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.NewPolicy(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "repos")
+	repos, err := repo.NewManager(root, st, policy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.InitRepo("alice/demo.git", "alice", access.Public); err != nil {
+		t.Fatal(err)
+	}
+
+	bare := filepath.Join(root, "alice", "demo.git")
+	work := filepath.Join(dir, "work")
+	runGit(t, "", "init", "-q", "--bare", "-b", "main", bare)
+	runGit(t, "", "init", "-q", "-b", "main", work)
+	if err := os.WriteFile(filepath.Join(work, "README.md"), []byte("# demo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "add", "README.md")
+	runGit(t, work, "-c", "user.name=alice", "-c", "user.email=alice@example.com", "commit", "-q", "-m", "init")
+	runGit(t, work, "tag", "v1.0")
+	runGit(t, work, "push", "-q", bare, "main", "v1.0")
+
+	config.RepoRoot = root
+	h := NewHandler(config, Services{Policy: policy, Repos: repos})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL + "/alice/demo.git", root
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return string(out)
+}
+
+// advertise 请求 info/refs，protocol 不为空时带上 Git-Protocol 头
+func advertise(t *testing.T, url, protocol string) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url+"/info/refs?service=git-upload-pack", nil)
+	if protocol != "" {
+		req.Header.Set("Git-Protocol", protocol)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Fatalf("info/refs returned %d: %s", resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestAdvertisementV2HasNoServicePreamble(t *testing.T) {
+	url := testServer(t)
+
+	v2 := advertise(t, url, "version=2")
+	if strings.Contains(v2, "# service=") {
+		t.Errorf("v2 advertisement must not start with the service line: %q", v2)
+	}
+	if !strings.HasPrefix(v2, "000eversion 2\n") {
+		t.Errorf("v2 advertisement should start with the version line: %q", v2)
+	}
+	for _, capability := range []string{"ls-refs", "fetch"} {
+		if !strings.Contains(v2, capability) {
+			t.Errorf("v2 advertisement is missing %s: %q", capability, v2)
+		}
+	}
+
+	v0 := advertise(t, url, "")
+	if !strings.HasPrefix(v0, "001e# service=git-upload-pack\n0000") {
+		t.Errorf("v0 advertisement should start with the service line: %q", v0)
+	}
+	if !strings.Contains(v0, "refs/heads/main") {
+		t.Errorf("v0 advertisement is missing refs/heads/main: %q", v0)
+	}
+}
+
+func TestLsRefsWithRefPrefix(t *testing.T) {
+	url := testServer(t)
+
+	// 直接发 v2 的 ls-refs 命令：command=ls-refs，分隔包，只要 refs/tags/ 下的引用
+	var body bytes.Buffer
+	writePktLine(&body, "command=ls-refs\n")
+	body.WriteString("0001")
+	writePktLine(&body, "ref-prefix refs/tags/\n")
+	body.WriteString("0000")
+	req, _ := http.NewRequest("POST", url+"/git-upload-pack", &body)
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Git-Protocol", "version=2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		t.Fatalf("ls-refs returned %d: %s", resp.StatusCode, out)
+	}
+	if !strings.Contains(string(out), "refs/tags/v1.0") {
+		t.Errorf("ls-refs should list the tag: %q", out)
+	}
+	if strings.Contains(string(out), "refs/heads/main") {
+		t.Errorf("ls-refs should only list refs under the prefix: %q", out)
+	}
+
+	// 真实客户端：ls-remote 带上模式时 git 会发 ref-prefix
+	refs := runGit(t, "", "-c", "protocol.version=2", "ls-remote", url, "refs/heads/main")
+	if !strings.Contains(refs, "refs/heads/main") || strings.Contains(refs, "refs/tags/v1.0") {
+		t.Errorf("unexpected ls-remote output: %q", refs)
+	}
+}
+
+func TestCloneAndFetch(t *testing.T) {
+	url := testServer(t)
+	dir := t.TempDir()
+
+	for _, version := range []string{"0", "2"} {
+		dest := filepath.Join(dir, "v"+version)
+		cmd := exec.Command("git", "-c", "protocol.version="+version, "clone", "-q", url, dest)
+		cmd.Env = append(os.Environ(), "GIT_TRACE_PACKET=1")
+		trace, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("protocol v%s clone failed: %v\n%s", version, err, trace)
+		}
+		// v2 的 clone 走 command=fetch，v0 不会出现 command=
+		usedFetch := strings.Contains(string(trace), "command=fetch")
+		if usedFetch != (version == "2") {
+			t.Errorf("protocol v%s clone: command=fetch used = %v", version, usedFetch)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "README.md")); err != nil {
+			t.Errorf("protocol v%s clone has no README.md: %v", version, err)
+		}
+	}
+
+	// 在 v2 的克隆里再 fetch 一次标签
+	dest := filepath.Join(dir, "v2")
+	runGit(t, dest, "-c", "protocol.version=2", "fetch", "-q", "origin", "refs/tags/v1.0:refs/tags/fetched")
+	if got := strings.TrimSpace(runGit(t, dest, "rev-parse", "fetched")); got != strings.TrimSpace(runGit(t, dest, "rev-parse", "HEAD")) {
+		t.Errorf("fetched tag points at %s, want HEAD", got)
+	}
+}
+
+func TestCloneMissingRepoDoesNotCreateIt(t *testing.T) {
+	url, root := newTestServer(t, Config{AutoCreate: true})
+	missing := strings.TrimSuffix(url, "alice/demo.git") + "alice/typo.git"
+
+	cmd := exec.Command("git", "clone", "-q", missing, filepath.Join(t.TempDir(), "typo"))
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Fatalf("cloning a missing repository should fail:\n%s", out)
+	}
+	for _, path := range []string{"/info/refs?service=git-upload-pack", "/archive/main.tar.gz"} {
+		resp, err := http.Get(missing + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 404 {
+			t.Errorf("GET %s returned %d, want 404", path, resp.StatusCode)
+		}
+	}
+	resp, err := http.Post(missing+"/git-upload-pack", "application/x-git-upload-pack-request", strings.NewReader("0000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("POST git-upload-pack returned %d, want 404", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(root, "alice", "typo.git")); !os.IsNotExist(err) {
+		t.Errorf("alice/typo.git should not have been created: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+)
+
+// quarantine 隔离区：在 git-receive-pack 更新引用之前，先把客户端推上来的对象索引到一个临时目录里
+// 这样就能在对象真正入库之前做祖先判断、检查文件大小等，检查不通过时直接删掉临时目录即可
+type quarantine struct {
+	repoPath string
+	dir      string   // 临时对象目录，位于仓库的 objects 下
+	pack     *os.File // 落盘的 packfile，后面还要再交给 git-receive-pack
+}
+
+// newQuarantine 把 pack 落盘并用 git index-pack 建立索引
+// pack 为 nil 时（只删除引用的推送）只创建空的隔离区
+func newQuarantine(repoPath string, pack io.Reader) (*quarantine, error) {
+	absRepo, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Join(absRepo, "objects"), "devnexus-incoming-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine: %v", err)
+	}
+	q := &quarantine{repoPath: absRepo, dir: dir}
+	if pack == nil {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "pack"), 0755); err != nil {
+		q.Close()
+		return nil, err
+	}
+	q.pack, err = os.CreateTemp(dir, "push-*.pack")
+	if err != nil {
+		q.Close()
+		return nil, err
+	}
+	if _, err := io.Copy(q.pack, pack); err != nil {
+		q.Close()
+		return nil, fmt.Errorf("failed to receive pack: %v", err)
+	}
+	if _, err := q.pack.Seek(0, io.SeekStart); err != nil {
+		q.Close()
+		return nil, err
+	}
+
+	// --fix-thin：客户端发来的是 thin pack，缺失的 base 对象从仓库里补
+	cmd := exec.Command("git", "index-pack", "--stdin", "--fix-thin")
+	cmd.Dir = absRepo
+	cmd.Env = q.Env()
+	cmd.Stdin = q.pack
+	if out, err := cmd.CombinedOutput(); err != nil {
+		q.Close()
+		return nil, fmt.Errorf("index-pack failed: %v, output: %s", err, out)
+	}
+	if _, err := q.pack.Seek(0, io.SeekStart); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Env 在隔离区中执行 git 命令需要的环境变量：新对象写在隔离区，老对象从仓库里读
+func (q *quarantine) Env() []string {
+	return append(os.Environ(),
+		"GIT_DIR="+q.repoPath,
+		"GIT_OBJECT_DIRECTORY="+q.dir,
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES="+filepath.Join(q.repoPath, "objects"),
+	)
+}
+
+// Git 在隔离区中执行一条 git 命令并返回标准输出
+func (q *quarantine) Git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = q.repoPath
+	cmd.Env = q.Env()
+	return cmd.Output()
+}
+
+// IsAncestor old 是否是 new 的祖先，也就是这次更新是否是快进
+func (q *quarantine) IsAncestor(old, new string) bool {
+	_, err := q.Git("merge-base", "--is-ancestor", old, new)
+	return err == nil
+}
+
+// VerifyNewCommits 验证从 new 可达、从 exclude 里的提交都不可达的提交的签名
+// exclude 为空时验证 new 的全部历史
+func (q *quarantine) VerifyNewCommits(v *signing.Verifier, new string, exclude []string) (map[string]*signing.Verification, error) {
+	if v == nil {
+		return nil, fmt.Errorf("signature verification is not configured")
+	}
+	args := append([]string{"rev-list", new, "--not"}, exclude...)
+	out, err := q.Git(args...)
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list failed: %v", err)
+	}
+	return v.VerifyObjects(q.repoPath, q.Env(), strings.Fields(string(out)))
+}
+
+// Refs 仓库现有的分支和标签 -> 指向的对象
+func (q *quarantine) Refs() (map[string]string, error) {
+	out, err := q.Git("for-each-ref", "--format=%(refname) %(objectname)", "refs/heads/", "refs/tags/")
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref failed: %v", err)
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if ref, sha, ok := strings.Cut(line, " "); ok {
+			refs[ref] = sha
+		}
+	}
+	return refs, nil
+}
+
+// Pack 返回落盘后的 packfile，可以再交给 git-receive-pack
+func (q *quarantine) Pack() io.Reader {
+	if q.pack == nil {
+		return eofReader{}
+	}
+	return q.pack
+}
+
+// Close 删除隔离区，对象最终由 git-receive-pack 写入仓库
+func (q *quarantine) Close() {
+	if q.pack != nil {
+		q.pack.Close()
+	}
+	os.RemoveAll(q.dir)
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
@@ -0,0 +1,147 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/chanslights/DevNexus/pkg/types"
+)
+
+// receiveRequest 解析后的 receive-pack 请求
+// 请求体依次是：命令列表（flush 结束）、可选的 push-options（flush 结束）、packfile
+type receiveRequest struct {
+	Updates     []types.RefUpdate
+	Caps        []string
+	PushOptions []string
+	Pack        io.Reader // 剩下的 packfile 数据，只能读一次
+}
+
+// hasCap 客户端是否声明了某个 capability
+func (rr *receiveRequest) hasCap(name string) bool {
+	for _, c := range rr.Caps {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sideband 客户端是否要求把输出复用到 sideband 通道里
+func (rr *receiveRequest) sideband() bool {
+	return rr.hasCap("side-band-64k") || rr.hasCap("side-band")
+}
+
+// reportStatus 客户端是否需要逐条引用的推送结果
+func (rr *receiveRequest) reportStatus() bool {
+	return rr.hasCap("report-status") || rr.hasCap("report-status-v2")
+}
+
+// needsPack 只删除引用的推送不会带 packfile
+func (rr *receiveRequest) needsPack() bool {
+	for _, u := range rr.Updates {
+		if !u.IsDelete() {
+			return true
+		}
+	}
+	return false
+}
+
+// encode 重新编码请求，只保留 updates 中的命令，pack 原样拼在后面
+func (rr *receiveRequest) encode(updates []types.RefUpdate, pack io.Reader) io.Reader {
+	var buf bytes.Buffer
+	for i, u := range updates {
+		line := fmt.Sprintf("%s %s %s", u.OldSHA, u.NewSHA, u.Ref)
+		if i == 0 && len(rr.Caps) > 0 {
+			line += "\x00" + strings.Join(rr.Caps, " ")
+		}
+		writePktLine(&buf, line+"\n")
+	}
+	buf.WriteString("0000")
+	if rr.hasCap("push-options") {
+		for _, opt := range rr.PushOptions {
+			writePktLine(&buf, opt+"\n")
+		}
+		buf.WriteString("0000")
+	}
+	return io.MultiReader(&buf, pack)
+}
+
+// writePktLine 写一个 pkt-line：4 位十六进制长度（包含自身）+ 数据
+func writePktLine(w io.Writer, payload string) {
+	fmt.Fprintf(w, "%04x%s", len(payload)+4, payload)
+}
+
+// readPktLine 读取一个 pkt-line，flush-pkt（0000）返回 nil
+// 返回的 raw 是原始字节（包含 4 字节长度前缀），方便原样转发给 git
+func readPktLine(r *bufio.Reader) (payload []byte, raw []byte, err error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, nil, err
+	}
+	n, err := strconv.ParseUint(string(head), 16, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pkt-line length %q", head)
+	}
+	if n == 0 {
+		return nil, head, nil
+	}
+	if n < 4 {
+		return nil, nil, fmt.Errorf("invalid pkt-line length %d", n)
+	}
+	payload = make([]byte, n-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+	return payload, append(head, payload...), nil
+}
+
+// parseReceiveRequest 解析 receive-pack 请求开头的命令列表和 push-options
+// 第一条命令的格式是 "<old> <new> <ref>\0<capabilities>"
+func parseReceiveRequest(body io.Reader) (*receiveRequest, error) {
+	br := bufio.NewReader(body)
+	rr := &receiveRequest{Pack: br}
+
+	for first := true; ; first = false {
+		payload, _, err := readPktLine(br)
+		if err == io.EOF && first {
+			// 空请求体，交给 git 自己处理
+			return rr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if payload == nil {
+			break
+		}
+
+		line := strings.TrimSuffix(string(payload), "\n")
+		if i := strings.IndexByte(line, 0); i >= 0 {
+			rr.Caps = strings.Fields(line[i+1:])
+			line = line[:i]
+		}
+		// push-cert 等扩展不在这里处理
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		rr.Updates = append(rr.Updates, types.RefUpdate{OldSHA: fields[0], NewSHA: fields[1], Ref: fields[2]})
+	}
+
+	if rr.hasCap("push-options") {
+		for {
+			payload, _, err := readPktLine(br)
+			if err != nil {
+				return nil, err
+			}
+			if payload == nil {
+				break
+			}
+			rr.PushOptions = append(rr.PushOptions, strings.TrimSuffix(string(payload), "\n"))
+		}
+	}
+	return rr, nil
+}
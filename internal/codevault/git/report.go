@@ -0,0 +1,140 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// sideband 通道编号
+const (
+	bandData     = 1 // 数据，receive-pack 的 report-status 在这里
+	bandProgress = 2 // 进度和提示信息，客户端显示为 "remote: ..."
+	bandError    = 3 // 致命错误
+)
+
+// maxSidebandPayload side-band-64k 每个包最多 65520 字节，去掉长度和通道号
+const maxSidebandPayload = 65515
+
+// rejection 被 CodeVault 拒绝的引用及原因
+type rejection struct {
+	Ref    string
+	Reason string
+}
+
+// sortedRejections 按引用名排序，保证输出稳定
+func sortedRejections(rejected map[string]string) []rejection {
+	list := make([]rejection, 0, len(rejected))
+	for ref, reason := range rejected {
+		list = append(list, rejection{Ref: ref, Reason: reason})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Ref < list[j].Ref })
+	return list
+}
+
+// ngLines 生成 report-status 里的 "ng <ref> <reason>" 行
+func ngLines(rejected []rejection) []byte {
+	var buf bytes.Buffer
+	for _, rj := range rejected {
+		writePktLine(&buf, fmt.Sprintf("ng %s %s\n", rj.Ref, rj.Reason))
+	}
+	return buf.Bytes()
+}
+
+// writeSideband 把数据切成 sideband 包写出
+func writeSideband(w io.Writer, band byte, data []byte) {
+	for len(data) > 0 {
+		n := min(len(data), maxSidebandPayload)
+		fmt.Fprintf(w, "%04x", n+5)
+		w.Write([]byte{band})
+		w.Write(data[:n])
+		data = data[n:]
+	}
+}
+
+// writeMessages 通过 sideband 的进度通道输出提示，客户端没有要求 sideband 时只能丢弃
+// sideband 是一串独立的包，所以可以在 git 的输出之前先写
+func writeMessages(w io.Writer, rr *receiveRequest, messages []string) {
+	if !rr.sideband() {
+		return
+	}
+	for _, msg := range messages {
+		writeSideband(w, bandProgress, []byte(msg+"\n"))
+	}
+}
+
+// writeRejectedReport 所有引用都被拒绝时，不调用 git，直接按协议写回结果
+func writeRejectedReport(w io.Writer, rr *receiveRequest, rejected []rejection) {
+	if !rr.reportStatus() {
+		if rr.sideband() {
+			io.WriteString(w, "0000")
+		}
+		return
+	}
+
+	var report bytes.Buffer
+	writePktLine(&report, "unpack ok\n")
+	report.Write(ngLines(rejected))
+	report.WriteString("0000")
+
+	if rr.sideband() {
+		writeSideband(w, bandData, report.Bytes())
+		io.WriteString(w, "0000")
+		return
+	}
+	w.Write(report.Bytes())
+}
+
+// injectRejections 部分引用被拒绝时，git 只处理了剩下的引用
+// 这里把 git 的输出改写一下，在 report-status 的 flush 前面补上被拒绝引用的 ng 行
+func injectRejections(out []byte, rr *receiveRequest, rejected []rejection) []byte {
+	if !rr.reportStatus() {
+		return out
+	}
+	if !rr.sideband() {
+		return insertBeforeFlush(out, ngLines(rejected))
+	}
+
+	// sideband 模式：通道 1 的数据拼起来才是完整的 report-status，其他通道原样保留
+	var result, report bytes.Buffer
+	br := bufio.NewReader(bytes.NewReader(out))
+	for {
+		payload, raw, err := readPktLine(br)
+		if err != nil || payload == nil {
+			break
+		}
+		if payload[0] == bandData {
+			report.Write(payload[1:])
+		} else {
+			result.Write(raw)
+		}
+	}
+	writeSideband(&result, bandData, insertBeforeFlush(report.Bytes(), ngLines(rejected)))
+	result.WriteString("0000")
+	return result.Bytes()
+}
+
+// insertBeforeFlush 在第一个 flush-pkt 之前插入 extra
+func insertBeforeFlush(stream, extra []byte) []byte {
+	br := bufio.NewReader(bytes.NewReader(stream))
+	var result bytes.Buffer
+	for {
+		payload, raw, err := readPktLine(br)
+		if err != nil {
+			// 没有找到 flush，补一个完整的结尾
+			result.Write(extra)
+			result.WriteString("0000")
+			return result.Bytes()
+		}
+		if payload == nil {
+			result.Write(extra)
+			result.Write(raw)
+			rest, _ := io.ReadAll(br)
+			result.Write(rest)
+			return result.Bytes()
+		}
+		result.Write(raw)
+	}
+}
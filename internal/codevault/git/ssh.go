@@ -0,0 +1,139 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// SSHSession SSH 上的一次 git 命令，例如 git-upload-pack '/demo.git'
+// 由 sshd 包完成认证后交给 Handler，仓库解析、权限检查、推送流程都和 HTTP 走同一套
+type SSHSession struct {
+	User    *auth.User
+	Command string
+	Env     map[string]string // 客户端通过 env 请求传来的变量，只用到 GIT_PROTOCOL
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// fail 把错误写到 stderr，客户端会显示成 "fatal: ..." 之前的提示
+func (s *SSHSession) fail(format string, args ...any) int {
+	fmt.Fprintf(s.Stderr, "CodeVault: "+format+"\n", args...)
+	return 1
+}
+
+// ServeSSH 执行 SSH 上的 git 命令，返回进程退出码
+func (h *Handler) ServeSSH(s *SSHSession) int {
+	// 1.解析命令：git 客户端发来的是 git-upload-pack '/alice/demo.git'，路径可能带 / 或 ~/ 前缀
+	service, arg, _ := strings.Cut(strings.TrimSpace(s.Command), " ")
+	required, ok := requiredLevel(service)
+	if !ok {
+		return s.fail("unsupported command: %s", service)
+	}
+	repoName := strings.Trim(strings.TrimSpace(arg), `'"`)
+	repoName = utils.NormalizeRepoName(strings.TrimPrefix(strings.TrimPrefix(repoName, "~/"), "/"))
+	// SSH 没有重定向，改名、转移过的仓库直接用新名字，并提示用户更新远端地址
+	if !h.svc.Repos.Exists(repoName) {
+		if target, found := h.svc.Repos.Resolve(repoName); found && h.svc.Policy.Level(s.User, target) >= access.Read {
+			fmt.Fprintf(s.Stderr, "CodeVault: %s has moved to %s, please update your remote\n", repoName, target)
+			repoName = target
+		}
+	}
+	repoPath, ok := h.repoPath(repoName)
+	if !ok {
+		return s.fail("invalid repository path: %s", arg)
+	}
+
+	// 2.仓库不存在时和 HTTP 一样按配置自动创建，只有推送会创建
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		if !h.config.AutoCreate || service != "git-receive-pack" {
+			return s.fail("repository not found")
+		}
+		if !h.svc.Policy.CanCreate(s.User, utils.RepoOwner(repoName)) {
+			return s.fail("cannot create repositories under %s", utils.RepoOwner(repoName))
+		}
+		if err := h.autoCreate(repoName, s.User); err != nil {
+			return s.fail("failed to init repository")
+		}
+	} else if granted := h.svc.Policy.Level(s.User, repoName); granted < required {
+		// 连读权限都没有时不暴露私有仓库是否存在
+		if granted == access.None {
+			return s.fail("repository not found")
+		}
+		return s.fail("requires %s permission", required)
+	}
+	if service == "git-receive-pack" && h.svc.Repos.IsArchived(repoName) {
+		return s.fail("repository is archived")
+	}
+
+	log.Printf("🔑 SSH %s by %s on %s", service, s.User.Username, repoName)
+	if service == "git-upload-pack" {
+		return h.sshUploadPack(s, repoPath)
+	}
+	return h.sshReceivePack(s, repoPath)
+}
+
+// sshUploadPack SSH 上的 upload-pack 是有状态的，直接把连接交给 git
+func (h *Handler) sshUploadPack(s *SSHSession, repoPath string) int {
+	cmd := serviceCommand("git-upload-pack", repoPath)
+	cmd.Env = os.Environ()
+	if proto := s.Env["GIT_PROTOCOL"]; proto != "" && validProtocol(proto) {
+		cmd.Env = append(cmd.Env, "GIT_PROTOCOL="+proto)
+	}
+	cmd.Stdout = s.Stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(s.Stderr, &stderr)
+
+	// 不把连接直接设成 Stdin：git 退出后客户端不一定马上关闭连接，Wait 会一直等着读
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return s.fail("failed to start git")
+	}
+	if err := cmd.Start(); err != nil {
+		return s.fail("failed to start git")
+	}
+	go func() {
+		io.Copy(stdin, s.Stdin)
+		stdin.Close()
+	}()
+	if err := cmd.Wait(); err != nil {
+		log.Printf("Git command failed: %v", commandError(err, &stderr))
+		return 1
+	}
+	return 0
+}
+
+// sshReceivePack SSH 上先发引用列表，再读客户端的命令和 packfile，
+// 之后和 HTTP 一样走 receivePack：分支保护、钩子、webhook
+func (h *Handler) sshReceivePack(s *SSHSession, repoPath string) int {
+	var stderr bytes.Buffer
+	adv := serviceCommand("git-receive-pack", "--stateless-rpc", "--advertise-refs", repoPath)
+	adv.Stdout = s.Stdout
+	adv.Stderr = &stderr
+	if err := adv.Run(); err != nil {
+		log.Printf("Git command failed: %v", commandError(err, &stderr))
+		return s.fail("failed to read repository")
+	}
+
+	rr, err := parseReceiveRequest(s.Stdin)
+	if err != nil {
+		return s.fail("invalid receive-pack request")
+	}
+	// 没有要更新的引用（例如已经是最新的），客户端只发一个 flush 就结束了
+	if len(rr.Updates) == 0 {
+		return 0
+	}
+	if err := h.receivePack(repoPath, s.User, rr, s.Stdout); err != nil {
+		log.Printf("Git command failed: %v", err)
+		return s.fail("failed to receive pack")
+	}
+	return 0
+}
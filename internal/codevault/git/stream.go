@@ -0,0 +1,141 @@
+package git
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// noCache smart HTTP 协议要求引用列表和 RPC 结果不能被代理或浏览器缓存
+func noCache(w http.ResponseWriter) {
+	w.Header().Set("Expires", "Fri, 01 Jan 1980 00:00:00 GMT")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
+}
+
+// decodeBody 协商数据较大时 git 客户端会用 gzip 压缩请求体（Content-Encoding: gzip），
+// 解压后再交给 git；不认识的编码返回错误
+func decodeBody(r *http.Request) error {
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return fmt.Errorf("invalid gzip body: %v", err)
+		}
+		// 原始的 Body 由 http.Server 负责关闭
+		r.Body = io.NopCloser(zr)
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		return nil
+	default:
+		return fmt.Errorf("unsupported content encoding: %s", r.Header.Get("Content-Encoding"))
+	}
+}
+
+// acceptsGzip 客户端是否接受 gzip 响应（git 通过 libcurl 会带上 Accept-Encoding）
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		// gzip;q=0 表示明确不接受
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			v, err := strconv.ParseFloat(q, 64)
+			return err == nil && v > 0
+		}
+		return true
+	}
+	return false
+}
+
+// isLsRefs 协议 v2 的 ls-refs 请求，响应是引用列表，压缩效果好；fetch 返回的包已经是 zlib 压缩过的
+func isLsRefs(head []byte) bool {
+	return bytes.Contains(head, []byte("command=ls-refs"))
+}
+
+// streamWriter 把 git 的输出流式写给客户端
+// 第一次有输出时才发送响应头：git 还没输出就失败时还能返回 500；compress 时用 gzip 压缩
+type streamWriter struct {
+	w        http.ResponseWriter
+	compress bool
+	preamble []byte // 响应开头要先写的内容，例如 v0 的 "# service=" 行
+	zw       *gzip.Writer
+	started  bool
+}
+
+func newStreamWriter(w http.ResponseWriter, compress bool) *streamWriter {
+	return &streamWriter{w: w, compress: compress}
+}
+
+func (s *streamWriter) start() error {
+	s.started = true
+	if s.compress {
+		s.w.Header().Set("Content-Encoding", "gzip")
+		s.w.Header().Add("Vary", "Accept-Encoding")
+		s.zw = gzip.NewWriter(s.w)
+	}
+	if len(s.preamble) > 0 {
+		_, err := s.write(s.preamble)
+		return err
+	}
+	return nil
+}
+
+func (s *streamWriter) write(p []byte) (int, error) {
+	if s.zw != nil {
+		return s.zw.Write(p)
+	}
+	n, err := s.w.Write(p)
+	// 不压缩时立即发出去，推送 / 拉取的进度信息才能实时显示
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return 0, err
+		}
+	}
+	return s.write(p)
+}
+
+// finish git 退出后收尾
+// 成功时结束压缩流；失败时如果还没有输出就返回 500，
+// 已经输出了一部分就中断连接，避免客户端把不完整的响应当成正常结束
+func (s *streamWriter) finish(err error) {
+	if err == nil {
+		if !s.started {
+			s.start()
+		}
+		if s.zw != nil {
+			s.zw.Close()
+		}
+		return
+	}
+	log.Printf("Git command failed: %v", err)
+	if !s.started {
+		s.w.Header().Del("Content-Type")
+		http.Error(s.w, "Git command failed", 500)
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// commandError 把 git 的 stderr 带进错误信息
+func commandError(err error, stderr *bytes.Buffer) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%v, output: %s", err, strings.TrimSpace(stderr.String()))
+}
@@ -0,0 +1,79 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 服务端钩子的管理接口
+// Go 插件由仓库管理员启用；可执行钩子会在服务器上跑任意程序，只有站点管理员可以配置
+type API struct {
+	manager *Manager
+	policy  *access.Policy
+}
+
+// NewAPI 创建管理接口
+func NewAPI(manager *Manager, policy *access.Policy) *API {
+	return &API{manager: manager, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/receive-hooks/plugins", a.handleListPlugins)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/receive-hooks", a.handleGetConfig)
+	mux.HandleFunc("PUT /api/repos/{owner}/{repo}/receive-hooks/plugins", a.handleSetPlugins)
+	mux.HandleFunc("PUT /api/repos/{owner}/{repo}/receive-hooks/executables", a.handleSetExecutables)
+}
+
+func (a *API) handleListPlugins(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireUser(w, r); !ok {
+		return
+	}
+	utils.WriteJSON(w, 200, PluginNames())
+}
+
+func (a *API) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.manager.Config(repo))
+}
+
+func (a *API) handleSetPlugins(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	var plugins []PluginConfig
+	if err := json.NewDecoder(r.Body).Decode(&plugins); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if err := a.manager.SetPlugins(repo, plugins); err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, a.manager.Config(repo))
+}
+
+func (a *API) handleSetExecutables(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	repo := utils.RepoFromPath(r)
+	var executables []Executable
+	if err := json.NewDecoder(r.Body).Decode(&executables); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if err := a.manager.SetExecutables(repo, executables); err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, a.manager.Config(repo))
+}
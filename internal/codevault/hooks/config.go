@@ -0,0 +1,123 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const configFile = "receive_hooks"
+
+// 可执行钩子的阶段
+const (
+	StagePreReceive  = "pre-receive"
+	StagePostReceive = "post-receive"
+)
+
+// RepoConfig 单个仓库的服务端钩子配置
+type RepoConfig struct {
+	Repo        string         `json:"repo"`
+	Plugins     []PluginConfig `json:"plugins"`
+	Executables []Executable   `json:"executables"`
+}
+
+// PluginConfig 启用一个 Go 插件，Params 是插件自己的参数
+type PluginConfig struct {
+	Name    string            `json:"name"`
+	Enabled bool              `json:"enabled"`
+	Params  map[string]string `json:"params,omitempty"`
+}
+
+// Config 查询仓库的钩子配置
+func (m *Manager) Config(repo string) *RepoConfig {
+	repo = utils.NormalizeRepoName(repo)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg := &RepoConfig{Repo: repo, Plugins: []PluginConfig{}, Executables: []Executable{}}
+	if saved, ok := m.configs[repo]; ok {
+		cfg.Plugins = append(cfg.Plugins, saved.Plugins...)
+		cfg.Executables = append(cfg.Executables, saved.Executables...)
+	}
+	return cfg
+}
+
+// SetPlugins 替换仓库启用的插件，参数不合法时直接报错
+func (m *Manager) SetPlugins(repo string, plugins []PluginConfig) error {
+	for _, pc := range plugins {
+		if _, err := NewPlugin(pc.Name, pc.Params); err != nil {
+			return fmt.Errorf("plugin %s: %v", pc.Name, err)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configLocked(repo).Plugins = plugins
+	return m.saveLocked()
+}
+
+// SetExecutables 替换仓库的可执行钩子，只有站点管理员可以调用
+func (m *Manager) SetExecutables(repo string, executables []Executable) error {
+	for i := range executables {
+		e := &executables[i]
+		if e.Stage != StagePreReceive && e.Stage != StagePostReceive {
+			return fmt.Errorf("hook %s: invalid stage %q", e.Name, e.Stage)
+		}
+		info, err := os.Stat(e.Path)
+		if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			return fmt.Errorf("hook %s: %s is not an executable file", e.Name, e.Path)
+		}
+		if e.Timeout <= 0 {
+			e.Timeout = Duration(30 * time.Second)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configLocked(repo).Executables = executables
+	return m.saveLocked()
+}
+
+// RenameRepo 仓库改名时迁移它的钩子配置
+func (m *Manager) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg, ok := m.configs[oldName]
+	if !ok {
+		return nil
+	}
+	delete(m.configs, oldName)
+	cfg.Repo = newName
+	m.configs[newName] = cfg
+	return m.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的钩子配置
+func (m *Manager) DeleteRepo(repo string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.configs, utils.NormalizeRepoName(repo))
+	return m.saveLocked()
+}
+
+// configLocked 取出仓库配置，不存在时创建，调用方必须持有 m.mu
+func (m *Manager) configLocked(repo string) *RepoConfig {
+	repo = utils.NormalizeRepoName(repo)
+	cfg, ok := m.configs[repo]
+	if !ok {
+		cfg = &RepoConfig{Repo: repo}
+		m.configs[repo] = cfg
+	}
+	return cfg
+}
+
+// saveLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveLocked() error {
+	list := make([]*RepoConfig, 0, len(m.configs))
+	for _, cfg := range m.configs {
+		list = append(list, cfg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Repo < list[j].Repo })
+	return m.store.Save(configFile, list)
+}
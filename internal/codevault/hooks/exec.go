@@ -0,0 +1,113 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Duration 可以用 "30s" 这样的字符串写在 JSON 里的时长
+type Duration time.Duration
+
+// MarshalJSON 序列化成 "30s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON 从 "30s" 反序列化
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Executable 管理员配置的可执行钩子，调用方式和 git 原生的 pre-receive / post-receive 一致：
+// 标准输入每行一条 "<old> <new> <ref>"，非 0 退出码表示拒绝整个推送
+// 另外支持在标准输出里写 "ng <ref> <reason>" 只拒绝某一个引用，其余输出都会显示在客户端的 remote: 里
+type Executable struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Stage   string   `json:"stage"` // pre-receive / post-receive
+	Timeout Duration `json:"timeout"`
+}
+
+// execHook 让 Executable 实现 PreReceiveHook / PostReceiveHook
+type execHook struct {
+	Executable
+}
+
+func (e execHook) Name() string { return "exec:" + e.Executable.Name }
+
+// PreReceive 执行可执行钩子并解析输出
+func (e execHook) PreReceive(p *Push, r *Report) {
+	stdout, stderr, err := e.run(p)
+	for _, line := range splitLines(stdout) {
+		if rest, ok := strings.CutPrefix(line, "ng "); ok {
+			ref, reason, _ := strings.Cut(rest, " ")
+			if reason == "" {
+				reason = "rejected by " + e.Name()
+			}
+			r.Reject(ref, reason)
+			continue
+		}
+		r.Message("%s", line)
+	}
+	for _, line := range splitLines(stderr) {
+		r.Message("%s", line)
+	}
+	if err != nil {
+		log.Printf("⛔ Hook %s declined push to %s: %v", e.Name(), p.Repo, err)
+		for _, u := range p.Updates {
+			r.Reject(u.Ref, fmt.Sprintf("pre-receive hook %s declined", e.Executable.Name))
+		}
+	}
+}
+
+// PostReceive 引用已经更新，输出只记录到服务端日志
+func (e execHook) PostReceive(p *Push) {
+	stdout, stderr, err := e.run(p)
+	if err != nil {
+		log.Printf("⚠️ Hook %s failed for %s: %v, output: %s%s", e.Name(), p.Repo, err, stdout, stderr)
+	}
+}
+
+func (e execHook) run(p *Push) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.Timeout))
+	defer cancel()
+
+	var stdin bytes.Buffer
+	for _, u := range p.Updates {
+		fmt.Fprintf(&stdin, "%s %s %s\n", u.OldSHA, u.NewSHA, u.Ref)
+	}
+	cmd := exec.CommandContext(ctx, e.Path)
+	cmd.Dir = p.RepoPath
+	cmd.Env = append(append([]string(nil), p.Env...),
+		"DEVNEXUS_REPO="+p.Repo,
+		"DEVNEXUS_PUSHER="+p.Pusher,
+		fmt.Sprintf("GIT_PUSH_OPTION_COUNT=%d", len(p.PushOptions)),
+	)
+	for i, opt := range p.PushOptions {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_PUSH_OPTION_%d=%s", i, opt))
+	}
+	cmd.Stdin = &stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		err = fmt.Errorf("timed out after %s", time.Duration(e.Timeout))
+	}
+	return stdout.String(), stderr.String(), err
+}
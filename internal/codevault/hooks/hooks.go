@@ -0,0 +1,204 @@
+package hooks
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"sync"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// Push 传给服务端钩子的推送信息
+type Push struct {
+	Repo        string
+	RepoPath    string
+	Pusher      string
+	Updates     []types.RefUpdate
+	PushOptions []string // git push -o 传上来的参数
+	// Env 执行 git 命令需要的环境变量
+	// pre-receive 阶段指向隔离区，能读到客户端刚推上来、还没入库的对象
+	Env []string
+}
+
+// Git 在推送对应的对象库里执行 git 命令
+func (p *Push) Git(args ...string) ([]byte, error) {
+	return gitCommand(p, args...).Output()
+}
+
+func gitCommand(p *Push, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = p.RepoPath
+	cmd.Env = p.Env
+	return cmd
+}
+
+// NewCommits 这次更新引入的、仓库里原本没有的提交
+func (p *Push) NewCommits(u types.RefUpdate) ([]string, error) {
+	if u.IsDelete() {
+		return nil, nil
+	}
+	out, err := p.Git("rev-list", u.NewSHA, "--not", "--all")
+	if err != nil {
+		return nil, fmt.Errorf("rev-list failed: %v", err)
+	}
+	return splitLines(string(out)), nil
+}
+
+// Report pre-receive 钩子的结果：被拒绝的引用和要显示给客户端的提示
+type Report struct {
+	mu       sync.Mutex
+	Rejected map[string]string // ref -> 原因
+	Messages []string          // 通过 sideband 显示为 "remote: ..."
+}
+
+// Reject 拒绝某个引用，同一个引用只记录第一个原因
+func (r *Report) Reject(ref, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Rejected == nil {
+		r.Rejected = make(map[string]string)
+	}
+	if _, ok := r.Rejected[ref]; !ok {
+		r.Rejected[ref] = reason
+	}
+}
+
+// Message 给客户端输出一行提示
+func (r *Report) Message(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Messages = append(r.Messages, fmt.Sprintf(format, args...))
+}
+
+// PreReceiveHook 在引用更新前执行，可以逐条拒绝引用
+type PreReceiveHook interface {
+	Name() string
+	PreReceive(p *Push, r *Report)
+}
+
+// PostReceiveHook 在引用更新后执行，只能做通知类的事情
+type PostReceiveHook interface {
+	Name() string
+	PostReceive(p *Push)
+}
+
+// Manager 管理全局插件以及每个仓库配置的插件和可执行钩子
+type Manager struct {
+	store *store.Store
+
+	mu      sync.Mutex
+	configs map[string]*RepoConfig
+	pre     []PreReceiveHook  // 对所有仓库生效的 Go 插件
+	post    []PostReceiveHook // 对所有仓库生效的 Go 插件
+}
+
+// NewManager 创建钩子管理器并从 store 中加载每个仓库的配置
+func NewManager(st *store.Store) (*Manager, error) {
+	m := &Manager{store: st, configs: make(map[string]*RepoConfig)}
+	var saved []*RepoConfig
+	if err := st.Load(configFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, cfg := range saved {
+		m.configs[cfg.Repo] = cfg
+	}
+	return m, nil
+}
+
+// Use 注册一个对所有仓库生效的 Go 插件，h 可以实现 PreReceiveHook 和 / 或 PostReceiveHook
+func (m *Manager) Use(h any) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pre, ok := h.(PreReceiveHook); ok {
+		m.pre = append(m.pre, pre)
+	}
+	if post, ok := h.(PostReceiveHook); ok {
+		m.post = append(m.post, post)
+	}
+}
+
+// HasPreReceive 仓库是否配置了 pre-receive 钩子，没有的话推送时不需要建立隔离区
+func (m *Manager) HasPreReceive(repo string) bool {
+	return len(m.preHooks(repo)) > 0
+}
+
+// PreReceive 依次执行所有 pre-receive 钩子
+func (m *Manager) PreReceive(p *Push) *Report {
+	report := &Report{}
+	for _, h := range m.preHooks(p.Repo) {
+		h.PreReceive(p, report)
+	}
+	return report
+}
+
+// PostReceive 依次执行所有 post-receive 钩子
+func (m *Manager) PostReceive(p *Push) {
+	for _, h := range m.postHooks(p.Repo) {
+		h.PostReceive(p)
+	}
+}
+
+func (m *Manager) preHooks(repo string) []PreReceiveHook {
+	m.mu.Lock()
+	hooks := append([]PreReceiveHook(nil), m.pre...)
+	cfg := m.configs[utils.NormalizeRepoName(repo)]
+	var plugins []PluginConfig
+	var executables []Executable
+	if cfg != nil {
+		plugins = append(plugins, cfg.Plugins...)
+		executables = append(executables, cfg.Executables...)
+	}
+	m.mu.Unlock()
+
+	for _, pc := range plugins {
+		if !pc.Enabled {
+			continue
+		}
+		h, err := NewPlugin(pc.Name, pc.Params)
+		if err != nil {
+			log.Printf("⚠️ Skipping hook plugin %s for %s: %v", pc.Name, repo, err)
+			continue
+		}
+		hooks = append(hooks, h)
+	}
+	for _, e := range executables {
+		if e.Stage == StagePreReceive {
+			hooks = append(hooks, execHook{e})
+		}
+	}
+	return hooks
+}
+
+func (m *Manager) postHooks(repo string) []PostReceiveHook {
+	m.mu.Lock()
+	hooks := append([]PostReceiveHook(nil), m.post...)
+	if cfg := m.configs[utils.NormalizeRepoName(repo)]; cfg != nil {
+		for _, e := range cfg.Executables {
+			if e.Stage == StagePostReceive {
+				hooks = append(hooks, execHook{e})
+			}
+		}
+	}
+	m.mu.Unlock()
+	return hooks
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			if i > start {
+				lines = append(lines, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		lines = append(lines, s[start:])
+	}
+	return lines
+}
@@ -0,0 +1,236 @@
+package hooks
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Factory 根据参数创建一个插件
+type Factory func(params map[string]string) (PreReceiveHook, error)
+
+// factories 内置的 Go 插件，可以按仓库启用
+var factories = map[string]Factory{
+	"max-file-size":  newMaxFileSize,
+	"commit-message": newCommitMessage,
+	"secret-scan":    newSecretScan,
+}
+
+// RegisterPlugin 注册一个新的插件类型，用于扩展内置插件
+func RegisterPlugin(name string, f Factory) {
+	factories[name] = f
+}
+
+// PluginNames 列出可用的插件
+func PluginNames() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPlugin 按名字创建插件
+func NewPlugin(name string, params map[string]string) (PreReceiveHook, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown plugin %q", name)
+	}
+	return f(params)
+}
+
+// maxFileSize 拒绝包含超大文件的推送
+type maxFileSize struct {
+	limit int64
+}
+
+// newMaxFileSize 参数 max_bytes，默认 50 MB
+func newMaxFileSize(params map[string]string) (PreReceiveHook, error) {
+	limit := int64(50 << 20)
+	if v, ok := params["max_bytes"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid max_bytes %q", v)
+		}
+		limit = n
+	}
+	return &maxFileSize{limit: limit}, nil
+}
+
+func (h *maxFileSize) Name() string { return "max-file-size" }
+
+func (h *maxFileSize) PreReceive(p *Push, r *Report) {
+	for _, u := range p.Updates {
+		if u.IsDelete() {
+			continue
+		}
+		// 列出新引入的所有对象，再批量查询类型和大小
+		out, err := p.Git("rev-list", "--objects", u.NewSHA, "--not", "--all")
+		if err != nil {
+			r.Reject(u.Ref, "max-file-size: failed to list objects")
+			continue
+		}
+		paths := make(map[string]string)
+		var input strings.Builder
+		for _, line := range splitLines(string(out)) {
+			sha, path, _ := strings.Cut(line, " ")
+			paths[sha] = path
+			input.WriteString(sha + "\n")
+		}
+		if input.Len() == 0 {
+			continue
+		}
+
+		cmd := gitCommand(p, "cat-file", "--batch-check=%(objecttype) %(objectname) %(objectsize)")
+		cmd.Stdin = strings.NewReader(input.String())
+		out, err = cmd.Output()
+		if err != nil {
+			r.Reject(u.Ref, "max-file-size: failed to inspect objects")
+			continue
+		}
+		sc := bufio.NewScanner(strings.NewReader(string(out)))
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) != 3 || fields[0] != "blob" {
+				continue
+			}
+			size, _ := strconv.ParseInt(fields[2], 10, 64)
+			if size > h.limit {
+				r.Message("%s is %d bytes, larger than the %d bytes limit", paths[fields[1]], size, h.limit)
+				r.Reject(u.Ref, fmt.Sprintf("file %s exceeds %d bytes", paths[fields[1]], h.limit))
+				break
+			}
+		}
+	}
+}
+
+// commitMessage 要求每个新提交的说明都匹配某个正则，比如必须带上工单号
+type commitMessage struct {
+	pattern *regexp.Regexp
+}
+
+// newCommitMessage 参数 pattern，默认要求形如 ABC-123 的工单号
+func newCommitMessage(params map[string]string) (PreReceiveHook, error) {
+	expr := params["pattern"]
+	if expr == "" {
+		expr = `[A-Z][A-Z0-9]+-[0-9]+`
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	return &commitMessage{pattern: re}, nil
+}
+
+func (h *commitMessage) Name() string { return "commit-message" }
+
+func (h *commitMessage) PreReceive(p *Push, r *Report) {
+	for _, u := range p.Updates {
+		if !u.IsBranch() {
+			continue
+		}
+		commits, err := p.NewCommits(u)
+		if err != nil {
+			r.Reject(u.Ref, "commit-message: failed to list commits")
+			continue
+		}
+		for _, sha := range commits {
+			msg, err := p.Git("log", "-1", "--format=%B", sha)
+			if err != nil {
+				continue
+			}
+			if !h.pattern.Match(msg) {
+				subject, _, _ := strings.Cut(strings.TrimSpace(string(msg)), "\n")
+				r.Message("commit %.7s %q does not match %s", sha, subject, h.pattern)
+				r.Reject(u.Ref, fmt.Sprintf("commit %.7s message must match %s", sha, h.pattern))
+				break
+			}
+		}
+	}
+}
+
+// secretScan 在新增的代码行里查找常见的密钥格式
+type secretScan struct {
+	patterns map[string]*regexp.Regexp
+}
+
+// defaultSecretPatterns 内置规则，参数 extra 可以再加一条自定义正则
+var defaultSecretPatterns = map[string]string{
+	"AWS access key":      `AKIA[0-9A-Z]{16}`,
+	"private key":         `-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`,
+	"GitHub token":        `gh[pousr]_[A-Za-z0-9]{36}`,
+	"DevNexus token":      `dnx_[0-9a-f]{40}`,
+	"Slack token":         `xox[baprs]-[0-9A-Za-z-]{10,}`,
+	"hardcoded password":  `(?i)(password|passwd|secret)\s*[:=]\s*["'][^"']{8,}["']`,
+	"generic API key":     `(?i)api[_-]?key\s*[:=]\s*["'][0-9a-zA-Z]{16,}["']`,
+	"Google API key":      `AIza[0-9A-Za-z_-]{35}`,
+	"Stripe live API key": `sk_live_[0-9a-zA-Z]{24,}`,
+}
+
+func newSecretScan(params map[string]string) (PreReceiveHook, error) {
+	h := &secretScan{patterns: make(map[string]*regexp.Regexp)}
+	for name, expr := range defaultSecretPatterns {
+		h.patterns[name] = regexp.MustCompile(expr)
+	}
+	if expr := params["extra"]; expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra pattern: %v", err)
+		}
+		h.patterns["custom pattern"] = re
+	}
+	return h, nil
+}
+
+func (h *secretScan) Name() string { return "secret-scan" }
+
+func (h *secretScan) PreReceive(p *Push, r *Report) {
+	for _, u := range p.Updates {
+		if !u.IsBranch() {
+			continue
+		}
+		commits, err := p.NewCommits(u)
+		if err != nil {
+			r.Reject(u.Ref, "secret-scan: failed to list commits")
+			continue
+		}
+		for _, sha := range commits {
+			if name, file := h.scan(p, sha); name != "" {
+				r.Message("possible %s found in %s (commit %.7s)", name, file, sha)
+				r.Reject(u.Ref, fmt.Sprintf("possible %s in commit %.7s", name, sha))
+				break
+			}
+		}
+	}
+}
+
+// scan 只看 diff 里新增的行，返回命中的规则名和文件
+func (h *secretScan) scan(p *Push, sha string) (string, string) {
+	out, err := p.Git("show", "--format=", "--no-color", "--unified=0", sha)
+	if err != nil {
+		return "", ""
+	}
+	var file string
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	sc.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if name, ok := strings.CutPrefix(line, "+++ b/"); ok {
+			file = name
+			continue
+		}
+		if !strings.HasPrefix(line, "+") || strings.HasPrefix(line, "+++") {
+			continue
+		}
+		for name, re := range h.patterns {
+			if re.MatchString(line) {
+				return name, file
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,302 @@
+package lfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	mediaType  = "application/vnd.git-lfs+json"
+	maxObjects = 1000 // 一次 batch 请求最多多少个对象，git-lfs 默认每批 100 个
+)
+
+// API Git LFS 接口，权限跟着仓库走：下载需要读，上传需要写
+// 客户端根据远端地址推出 <remote>/info/lfs，例如 http://host/alice/demo.git/info/lfs
+type API struct {
+	store  *Store
+	repos  *repo.Manager
+	policy *access.Policy
+}
+
+// NewAPI 创建接口
+func NewAPI(store *Store, repos *repo.Manager, policy *access.Policy) *API {
+	return &API{store: store, repos: repos, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+// /{owner}/{repo}/info/lfs/... 比 git handler 的 "/" 更具体，会优先匹配
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /{owner}/{repo}/info/lfs/objects/batch", a.handleBatch)
+	mux.HandleFunc("PUT /{owner}/{repo}/info/lfs/objects/{oid}", a.handleUpload)
+	mux.HandleFunc("GET /{owner}/{repo}/info/lfs/objects/{oid}", a.handleDownload)
+	mux.HandleFunc("POST /{owner}/{repo}/info/lfs/verify", a.handleVerify)
+
+	// 管理接口：用量和回收
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/lfs", a.handleUsage)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/lfs/gc", a.handleGC)
+}
+
+// Pointer batch 请求里的对象
+type Pointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type batchRequest struct {
+	Operation string    `json:"operation"` // download 或 upload
+	Transfers []string  `json:"transfers"`
+	Objects   []Pointer `json:"objects"`
+	HashAlgo  string    `json:"hash_algo"`
+}
+
+type action struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+type objectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type batchObject struct {
+	Pointer
+	Authenticated bool               `json:"authenticated,omitempty"`
+	Actions       map[string]*action `json:"actions,omitempty"`
+	Error         *objectError       `json:"error,omitempty"`
+}
+
+// require 检查仓库存在和权限，失败时已经写好了响应
+func (a *API) require(w http.ResponseWriter, r *http.Request, level access.Level) (string, bool) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, level) {
+		return "", false
+	}
+	if !a.repos.Exists(name) {
+		writeError(w, 404, repo.ErrNotFound.Error())
+		return "", false
+	}
+	if level >= access.Write && a.repos.IsArchived(name) {
+		writeError(w, 403, repo.ErrArchived.Error())
+		return "", false
+	}
+	return name, true
+}
+
+// handleBatch 批量 API：客户端告诉服务端要上传 / 下载哪些对象，服务端返回每个对象的地址
+func (a *API) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 10<<20)).Decode(&req); err != nil {
+		writeError(w, 422, "invalid JSON")
+		return
+	}
+	level := access.Read
+	switch req.Operation {
+	case "download":
+	case "upload":
+		level = access.Write
+	default:
+		writeError(w, 422, "operation must be download or upload")
+		return
+	}
+	name, ok := a.require(w, r, level)
+	if !ok {
+		return
+	}
+	if req.HashAlgo != "" && req.HashAlgo != "sha256" {
+		writeError(w, 409, "unsupported hash algorithm: "+req.HashAlgo)
+		return
+	}
+	if len(req.Objects) > maxObjects {
+		writeError(w, 422, "too many objects in one batch")
+		return
+	}
+
+	// 地址指回当前服务，带上同样的认证头，客户端不用再问一次密码
+	base := baseURL(r) + "/" + name + "/info/lfs/objects/"
+	var header map[string]string
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		header = map[string]string{"Authorization": auth}
+	}
+
+	var newBytes int64
+	objects := make([]batchObject, 0, len(req.Objects))
+	for _, p := range req.Objects {
+		obj := batchObject{Pointer: p, Authenticated: true}
+		size, err := a.store.Stat(name, p.OID)
+		switch {
+		case !ValidOID(p.OID) || p.Size < 0:
+			obj.Error = &objectError{Code: 422, Message: "invalid object"}
+		case req.Operation == "download" && errors.Is(err, ErrNotFound):
+			obj.Error = &objectError{Code: 404, Message: ErrNotFound.Error()}
+		case req.Operation == "download" && err == nil:
+			obj.Actions = map[string]*action{"download": {Href: base + p.OID, Header: header}}
+		case req.Operation == "upload" && err == nil && size == p.Size:
+			// 已经有了，不返回 actions，客户端就不会再上传
+		case req.Operation == "upload" && (err == nil || errors.Is(err, ErrNotFound)):
+			newBytes += p.Size
+			obj.Actions = map[string]*action{
+				"upload": {Href: base + p.OID, Header: header},
+				"verify": {Href: baseURL(r) + "/" + name + "/info/lfs/verify", Header: header},
+			}
+		default:
+			log.Printf("❌ LFS stat %s %s failed: %v", name, p.OID, err)
+			obj.Error = &objectError{Code: 500, Message: "failed to read object"}
+		}
+		objects = append(objects, obj)
+	}
+	if newBytes > 0 {
+		if err := a.store.CheckQuota(name, newBytes); err != nil {
+			writeError(w, 507, err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	json.NewEncoder(w).Encode(map[string]any{
+		"transfer":  "basic", // 只支持 basic 传输
+		"objects":   objects,
+		"hash_algo": "sha256",
+	})
+}
+
+// handleUpload basic 传输的上传：请求体就是对象内容
+func (a *API) handleUpload(w http.ResponseWriter, r *http.Request) {
+	name, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	if r.ContentLength < 0 {
+		writeError(w, 411, "Content-Length is required")
+		return
+	}
+	err := a.store.Put(name, r.PathValue("oid"), r.ContentLength, r.Body)
+	switch {
+	case errors.Is(err, ErrInvalidOID), errors.Is(err, ErrMismatch):
+		writeError(w, 422, err.Error())
+	case errors.Is(err, ErrQuotaExceeded):
+		writeError(w, 507, err.Error())
+	case err != nil:
+		log.Printf("❌ LFS upload to %s failed: %v", name, err)
+		writeError(w, 500, "failed to store object")
+	default:
+		w.WriteHeader(200)
+	}
+}
+
+// handleDownload basic 传输的下载，支持 Range 断点续传
+func (a *API) handleDownload(w http.ResponseWriter, r *http.Request) {
+	name, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	oid := r.PathValue("oid")
+	f, err := a.store.Open(name, oid)
+	switch {
+	case errors.Is(err, ErrInvalidOID):
+		writeError(w, 422, err.Error())
+		return
+	case errors.Is(err, ErrNotFound):
+		writeError(w, 404, err.Error())
+		return
+	case err != nil:
+		log.Printf("❌ LFS download from %s failed: %v", name, err)
+		writeError(w, 500, "failed to read object")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, 500, "failed to read object")
+		return
+	}
+	// 内容寻址，对象不会变，ETag 就用 oid
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", `"`+oid+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// handleVerify 上传完成后客户端确认对象确实已经存好
+func (a *API) handleVerify(w http.ResponseWriter, r *http.Request) {
+	name, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	var p Pointer
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeError(w, 422, "invalid JSON")
+		return
+	}
+	size, err := a.store.Stat(name, p.OID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, 404, err.Error())
+	case err != nil:
+		writeError(w, 422, err.Error())
+	case size != p.Size:
+		writeError(w, 422, ErrMismatch.Error())
+	default:
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(200)
+	}
+}
+
+// handleUsage 仓库的 LFS 用量，需要读权限
+func (a *API) handleUsage(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	if !a.repos.Exists(name) {
+		utils.WriteError(w, 404, repo.ErrNotFound.Error())
+		return
+	}
+	u, err := a.store.Usage(name)
+	if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, u)
+}
+
+// handleGC 回收不再被引用的对象，需要管理员权限
+func (a *API) handleGC(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	if !a.repos.Exists(name) {
+		utils.WriteError(w, 404, repo.ErrNotFound.Error())
+		return
+	}
+	result, err := a.store.GC(name, a.repos.Path(name), DefaultGCGrace)
+	if err != nil {
+		log.Printf("❌ LFS GC on %s failed: %v", name, err)
+		utils.WriteError(w, 500, "LFS garbage collection failed")
+		return
+	}
+	utils.WriteJSON(w, 200, result)
+}
+
+// baseURL 客户端访问本服务用的地址，反向代理后面通过 X-Forwarded-Proto 判断协议
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// writeError LFS 客户端读取的是 message 字段
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
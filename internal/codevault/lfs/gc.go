@@ -0,0 +1,162 @@
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	// maxPointerSize 按 LFS 规范，指针文件不会超过 1024 字节
+	maxPointerSize = 1024
+	pointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+	// DefaultGCGrace 刚上传的对象要等一段时间才能回收：客户端先上传对象，再推送引用它的提交
+	DefaultGCGrace = 24 * time.Hour
+)
+
+// GCResult 一次回收的结果
+type GCResult struct {
+	Repo       string `json:"repo"`
+	Scanned    int    `json:"scanned"`    // 存储里的对象数
+	Referenced int    `json:"referenced"` // 仓库里的指针文件引用到的对象数
+	Removed    int    `json:"removed"`
+	FreedBytes int64  `json:"freed_bytes"`
+}
+
+// GC 删除仓库里任何一个可达提交都不再引用的 LFS 对象，比 grace 新的对象保留
+func (s *Store) GC(repo, repoPath string, grace time.Duration) (*GCResult, error) {
+	referenced, err := referencedOIDs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GCResult{Repo: utils.NormalizeRepoName(repo)}
+	cutoff := time.Now().Add(-grace)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.walk(repo, func(oid, path string, info fs.FileInfo) {
+		result.Scanned++
+		if referenced[oid] {
+			result.Referenced++
+			return
+		}
+		if info.ModTime().After(cutoff) {
+			return
+		}
+		if err := os.Remove(path); err == nil {
+			result.Removed++
+			result.FreedBytes += info.Size()
+		}
+	})
+	// 下次查询用量时重新扫描
+	delete(s.usage, result.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if result.Removed > 0 {
+		log.Printf("🧹 LFS GC on %s removed %d objects (%d bytes)", result.Repo, result.Removed, result.FreedBytes)
+	}
+	return result, nil
+}
+
+// referencedOIDs 找出所有引用里可达的 LFS 指针文件指向的对象
+func referencedOIDs(repoPath string) (map[string]bool, error) {
+	// 1.列出所有可达对象，筛出可能是指针文件的小 blob
+	objects, err := git(repoPath, nil, "rev-list", "--objects", "--all")
+	if err != nil {
+		return nil, err
+	}
+	// 有 %(rest) 时 cat-file 只把第一个空格前的部分当作对象名，rev-list 输出的路径会被忽略
+	checked, err := git(repoPath, bytes.NewReader(objects), "cat-file", "--batch-check=%(objecttype) %(objectsize) %(objectname) %(rest)")
+	if err != nil {
+		return nil, err
+	}
+	var candidates bytes.Buffer
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(checked), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "blob" || seen[fields[2]] {
+			continue
+		}
+		if size, err := strconv.Atoi(fields[1]); err != nil || size > maxPointerSize {
+			continue
+		}
+		seen[fields[2]] = true
+		candidates.WriteString(fields[2] + "\n")
+	}
+
+	// 2.读出这些 blob 的内容，解析指针文件
+	referenced := map[string]bool{}
+	if candidates.Len() == 0 {
+		return referenced, nil
+	}
+	contents, err := git(repoPath, &candidates, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(bytes.NewReader(contents))
+	for {
+		// 每个对象：<sha> <type> <size>\n<内容>\n
+		header, err := br.ReadString('\n')
+		if err != nil {
+			break
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			break
+		}
+		size, _ := strconv.Atoi(fields[2])
+		body := make([]byte, size+1)
+		if _, err := io.ReadFull(br, body); err != nil {
+			break
+		}
+		if oid, ok := parsePointer(body[:size]); ok {
+			referenced[oid] = true
+		}
+	}
+	return referenced, nil
+}
+
+// parsePointer 解析 LFS 指针文件，返回它指向的 oid
+//
+//	version https://git-lfs.github.com/spec/v1
+//	oid sha256:4d7a21...
+//	size 12345
+func parsePointer(data []byte) (string, bool) {
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 3 || lines[0] != pointerVersion {
+		return "", false
+	}
+	for _, line := range lines[1:] {
+		if oid, ok := strings.CutPrefix(line, "oid sha256:"); ok && ValidOID(oid) {
+			return oid, true
+		}
+	}
+	return "", false
+}
+
+// git 在仓库里执行 git 命令，返回标准输出
+func git(repoPath string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,288 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+var (
+	// ErrNotFound LFS 对象不存在
+	ErrNotFound = errors.New("object does not exist")
+	// ErrInvalidOID oid 不是 64 位小写十六进制的 sha256
+	ErrInvalidOID = errors.New("invalid object id")
+	// ErrMismatch 上传的内容和 oid / size 对不上
+	ErrMismatch = errors.New("object content does not match oid or size")
+	// ErrQuotaExceeded 仓库的 LFS 存储超过配额
+	ErrQuotaExceeded = errors.New("LFS storage quota exceeded")
+
+	oidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Usage 仓库的 LFS 存储用量
+type Usage struct {
+	Objects    int   `json:"objects"`
+	SizeBytes  int64 `json:"size_bytes"`
+	QuotaBytes int64 `json:"quota_bytes,omitempty"` // 0 表示不限制
+}
+
+// Store 按内容寻址的 LFS 对象存储：<root>/<repo>/<oid[0:2]>/<oid[2:4]>/<oid>
+// 每个仓库一份，对象只能通过有权限的仓库访问，仓库删除时整个目录一起删掉
+type Store struct {
+	root  string
+	Quota int64 // 每个仓库的存储上限（字节），0 表示不限制
+
+	mu    sync.Mutex
+	usage map[string]*Usage // 第一次用到时扫描磁盘，之后随上传 / 回收更新
+}
+
+// NewStore 创建对象存储
+func NewStore(root string) (*Store, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create LFS storage: %v", err)
+	}
+	return &Store{root: root, usage: make(map[string]*Usage)}, nil
+}
+
+// ValidOID oid 是否是合法的 sha256
+func ValidOID(oid string) bool {
+	return oidPattern.MatchString(oid)
+}
+
+func (s *Store) repoDir(repo string) string {
+	return filepath.Join(s.root, utils.NormalizeRepoName(repo))
+}
+
+func (s *Store) path(repo, oid string) string {
+	return filepath.Join(s.repoDir(repo), oid[0:2], oid[2:4], oid)
+}
+
+// Stat 查询对象大小，不存在时返回 ErrNotFound
+func (s *Store) Stat(repo, oid string) (int64, error) {
+	if !ValidOID(oid) {
+		return 0, ErrInvalidOID
+	}
+	info, err := os.Stat(s.path(repo, oid))
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Open 打开对象用于下载，调用方负责关闭
+func (s *Store) Open(repo, oid string) (*os.File, error) {
+	if !ValidOID(oid) {
+		return nil, ErrInvalidOID
+	}
+	f, err := os.Open(s.path(repo, oid))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// CheckQuota 再写入 size 字节是否会超过配额
+func (s *Store) CheckQuota(repo string, size int64) error {
+	if s.Quota <= 0 {
+		return nil
+	}
+	u, err := s.Usage(repo)
+	if err != nil {
+		return err
+	}
+	if u.SizeBytes+size > s.Quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// Put 上传对象：一边写临时文件一边计算 sha256，内容和 oid、size 都对上才放进存储
+func (s *Store) Put(repo, oid string, size int64, r io.Reader) error {
+	if !ValidOID(oid) {
+		return ErrInvalidOID
+	}
+	if existing, err := s.Stat(repo, oid); err == nil && existing == size {
+		// 内容寻址，已经有了就不用再写，但要把请求体读完
+		io.Copy(io.Discard, r)
+		return nil
+	}
+	if err := s.CheckQuota(repo, size); err != nil {
+		return err
+	}
+
+	dest := s.path(repo, oid)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	// 多读一个字节，用来发现比声明的 size 更长的内容
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, size+1))
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to receive object: %v", err)
+	}
+	if n != size || hex.EncodeToString(h.Sum(nil)) != oid {
+		return ErrMismatch
+	}
+
+	// 同一个对象可能被并发上传，加锁后再确认一次，用量只记一次
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return err
+	}
+	if u, ok := s.usage[utils.NormalizeRepoName(repo)]; ok {
+		u.Objects++
+		u.SizeBytes += size
+	}
+	return nil
+}
+
+// Usage 统计仓库的 LFS 用量
+func (s *Store) Usage(repo string) (Usage, error) {
+	repo = utils.NormalizeRepoName(repo)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.usage[repo]; ok {
+		out := *u
+		out.QuotaBytes = s.Quota
+		return out, nil
+	}
+
+	u := &Usage{}
+	err := s.walk(repo, func(oid, path string, info fs.FileInfo) {
+		u.Objects++
+		u.SizeBytes += info.Size()
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	s.usage[repo] = u
+	out := *u
+	out.QuotaBytes = s.Quota
+	return out, nil
+}
+
+// Objects 列出仓库的所有对象，备份时使用
+func (s *Store) Objects(repo string) ([]string, error) {
+	var oids []string
+	err := s.walk(repo, func(oid, _ string, _ fs.FileInfo) {
+		oids = append(oids, oid)
+	})
+	sort.Strings(oids)
+	return oids, err
+}
+
+// walk 遍历仓库的所有对象，跳过上传中的临时文件
+func (s *Store) walk(repo string, fn func(oid, path string, info fs.FileInfo)) error {
+	err := filepath.WalkDir(s.repoDir(repo), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !ValidOID(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fn(d.Name(), path, info)
+		return nil
+	})
+	return err
+}
+
+// RenameRepo 仓库改名时移动它的 LFS 对象
+func (s *Store) RenameRepo(oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.usage, utils.NormalizeRepoName(oldName))
+	delete(s.usage, utils.NormalizeRepoName(newName))
+	if _, err := os.Stat(s.repoDir(oldName)); os.IsNotExist(err) {
+		return nil
+	}
+	// 转移到别的所有者名下时新的上级目录可能还不存在
+	if err := os.MkdirAll(filepath.Dir(s.repoDir(newName)), 0755); err != nil {
+		return err
+	}
+	return os.Rename(s.repoDir(oldName), s.repoDir(newName))
+}
+
+// ForkRepo fork 时把父仓库的 LFS 对象硬链接过来，继承的指针文件在 fork 里也能下载
+// 每个仓库有自己的一份链接，父仓库回收或删除对象不影响 fork；不能硬链接时（比如跨文件系统）复制
+func (s *Store) ForkRepo(parent, fork string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.usage, utils.NormalizeRepoName(fork))
+	var linkErr error
+	err := s.walk(parent, func(oid, path string, _ fs.FileInfo) {
+		if linkErr == nil {
+			linkErr = linkObject(path, s.path(fork, oid))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return linkErr
+}
+
+// linkObject 硬链接一个对象，失败时先复制到临时文件再改名，不会留下写了一半的对象
+func linkObject(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	err := os.Link(src, dest)
+	if err == nil || os.IsExist(err) {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy LFS object: %v", err)
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// DeleteRepo 仓库被删除时删除它的 LFS 对象
+func (s *Store) DeleteRepo(repo string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.usage, utils.NormalizeRepoName(repo))
+	return os.RemoveAll(s.repoDir(repo))
+}
@@ -0,0 +1,103 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 仓库维护接口：查看大小和维护结果需要读权限，手动触发需要仓库管理员权限
+type API struct {
+	manager *Manager
+	policy  *access.Policy
+}
+
+// NewAPI 创建接口
+func NewAPI(manager *Manager, policy *access.Policy) *API {
+	return &API{manager: manager, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/maintenance", a.handleGet)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/maintenance", a.handleRun)
+
+	// 站点管理员查看所有仓库的占用
+	mux.HandleFunc("GET /api/maintenance", a.handleList)
+}
+
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	report, err := a.manager.Report(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, report)
+}
+
+// handleRun 立即执行一次维护，请求体 {"task": "auto|repack|gc|fsck"}，默认 auto
+// 等维护结束后返回报告；执行失败时返回 500，响应体里有 last_error
+func (a *API) handleRun(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	var req struct {
+		Task string `json:"task"`
+	}
+	// 请求体可以为空
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if req.Task == "" {
+		req.Task = TaskAuto
+	}
+	report, err := a.manager.Maintain(name, req.Task)
+	switch {
+	case err == nil:
+		utils.WriteJSON(w, 200, report)
+	case report != nil:
+		utils.WriteJSON(w, 500, report)
+	default:
+		writeError(w, err)
+	}
+}
+
+// handleList 所有仓库的大小和维护状态，按占用从大到小排列，总量放在 X-Total-Size 头里
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	reports := a.manager.Reports()
+	var total int64
+	for _, report := range reports {
+		total += report.SizeBytes
+	}
+	w.Header().Set("X-Total-Size", strconv.FormatInt(total, 10))
+	utils.WriteJSON(w, 200, reports)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repo.ErrNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrBusy):
+		utils.WriteError(w, 409, err.Error())
+	case errors.Is(err, ErrInvalidTask):
+		utils.WriteError(w, 400, err.Error())
+	default:
+		utils.WriteError(w, 500, err.Error())
+	}
+}
@@ -0,0 +1,102 @@
+package maintenance
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// objectStats git count-objects -v 的结果
+type objectStats struct {
+	LooseObjects  int64
+	LooseBytes    int64
+	PackedObjects int64
+	Packs         int64
+	PackBytes     int64
+	GarbageBytes  int64
+}
+
+// countObjects 统计松散对象和包文件，只读，不需要仓库锁
+func countObjects(repoPath string) (*objectStats, error) {
+	cmd := exec.Command("git", "count-objects", "-v")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git count-objects failed: %v", err)
+	}
+	var st objectStats
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		switch key {
+		case "count":
+			st.LooseObjects = n
+		case "size":
+			st.LooseBytes = n << 10 // 单位是 KiB
+		case "in-pack":
+			st.PackedObjects = n
+		case "packs":
+			st.Packs = n
+		case "size-pack":
+			st.PackBytes = n << 10
+		case "size-garbage":
+			st.GarbageBytes = n << 10
+		}
+	}
+	return &st, nil
+}
+
+// gc 完整回收：所有对象重新打成一个包，写 bitmap 和 commit-graph
+// keepUnreachable 为 true 时不删除不可达对象：fork 通过 alternates 还在用父仓库里的对象，
+// 父仓库删掉分支后这些对象在父仓库里不可达，但对 fork 来说仍然需要
+// isFork 为 true 时不写 bitmap，对象有一部分在父仓库里，bitmap 写不完整
+func gc(repoPath string, keepUnreachable, isFork bool) error {
+	args := []string{
+		"-c", "gc.writeCommitGraph=true",
+		"-c", "repack.writeBitmaps=" + strconv.FormatBool(!isFork),
+		"gc", "--quiet",
+	}
+	if keepUnreachable {
+		args = append(args, "--prune=never")
+	}
+	return run(repoPath, args...)
+}
+
+// repack 增量打包：只把松散对象打成一个新包，不重写已有的包，比 gc 便宜很多
+// 之后用 multi-pack-index 把多个包的 bitmap 合在一起，再增量更新 commit-graph
+func repack(repoPath string, isFork bool) error {
+	if err := run(repoPath, "repack", "-d", "-l", "-q"); err != nil {
+		return err
+	}
+	// 空仓库没有包，也没有提交
+	if st, err := countObjects(repoPath); err != nil || st.Packs == 0 {
+		return err
+	}
+	if !isFork {
+		if err := run(repoPath, "multi-pack-index", "write", "--bitmap", "--no-progress"); err != nil {
+			return err
+		}
+	}
+	return run(repoPath, "commit-graph", "write", "--reachable", "--split", "--no-progress")
+}
+
+// fsck 检查对象库的完整性，返回 git 报出来的问题
+func fsck(repoPath string) error {
+	return run(repoPath, "fsck", "--no-progress", "--no-dangling")
+}
+
+func run(repoPath string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s failed: %v, output: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+package maintenance
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	maintenanceFile = "maintenance"
+
+	// DefaultLooseThreshold 松散对象超过这么多时做一次增量打包
+	DefaultLooseThreshold = 1000
+	// DefaultPackThreshold 包文件超过这么多时做一次完整 gc，把它们合成一个
+	DefaultPackThreshold = 20
+	// DefaultFsckInterval 默认每周 fsck 一次
+	DefaultFsckInterval = 7 * 24 * time.Hour
+)
+
+// 维护任务
+const (
+	TaskAuto   = "auto"   // 按对象数量决定要不要 repack / gc，到期了再 fsck
+	TaskRepack = "repack" // 增量打包松散对象
+	TaskGC     = "gc"     // 完整回收，重新打包
+	TaskFsck   = "fsck"   // 完整性检查
+)
+
+var (
+	// ErrBusy 仓库正在维护
+	ErrBusy = errors.New("maintenance is already running on this repository")
+	// ErrInvalidTask 不认识的任务
+	ErrInvalidTask = errors.New("invalid maintenance task")
+)
+
+// Report 仓库的大小和最近一次维护的结果
+type Report struct {
+	Repo          string     `json:"repo"`
+	SizeBytes     int64      `json:"size_bytes"` // 仓库目录占用的总字节数
+	LooseObjects  int64      `json:"loose_objects"`
+	LooseBytes    int64      `json:"loose_bytes"`
+	PackedObjects int64      `json:"packed_objects"`
+	Packs         int64      `json:"packs"`
+	PackBytes     int64      `json:"pack_bytes"`
+	GarbageBytes  int64      `json:"garbage_bytes,omitempty"`
+	Running       bool       `json:"running"`
+	LastTask      string     `json:"last_task,omitempty"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastDuration  string     `json:"last_duration,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastRepackAt  *time.Time `json:"last_repack_at,omitempty"`
+	LastGCAt      *time.Time `json:"last_gc_at,omitempty"`
+	LastFsckAt    *time.Time `json:"last_fsck_at,omitempty"`
+	Corrupt       bool       `json:"corrupt"`              // 最近一次 fsck 发现了问题
+	FsckError     string     `json:"fsck_error,omitempty"` // 最近一次 fsck 报出来的问题
+	MeasuredAt    time.Time  `json:"measured_at"`
+}
+
+// Alert fsck 发现仓库损坏时发出的 repo_corrupt 事件
+type Alert struct {
+	Event     string    `json:"event"`
+	RepoName  string    `json:"repo_name"`
+	Error     string    `json:"error"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Manager 后台维护所有仓库：按松散对象和包的数量做 repack / gc，定期 fsck
+// 维护时拿仓库的写锁，不会和推送同时进行
+type Manager struct {
+	store    *store.Store
+	repos    *repo.Manager
+	webhooks *webhook.Dispatcher
+
+	LooseThreshold int           // <=0 时使用 DefaultLooseThreshold
+	PackThreshold  int           // <=0 时使用 DefaultPackThreshold
+	FsckInterval   time.Duration // <=0 时不做定期 fsck
+
+	mu      sync.Mutex
+	reports map[string]*Report
+	running map[string]bool
+}
+
+// NewManager 创建维护管理器并从 store 中加载历史结果
+func NewManager(st *store.Store, repos *repo.Manager, webhooks *webhook.Dispatcher) (*Manager, error) {
+	m := &Manager{
+		store:        st,
+		repos:        repos,
+		webhooks:     webhooks,
+		FsckInterval: DefaultFsckInterval,
+		reports:      make(map[string]*Report),
+		running:      make(map[string]bool),
+	}
+	var saved []*Report
+	if err := st.Load(maintenanceFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, r := range saved {
+		m.reports[r.Repo] = r
+	}
+	return m, nil
+}
+
+// Run 定时维护所有仓库，一次只处理一个仓库，避免同时压满磁盘
+func (m *Manager) Run(tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		for _, r := range m.repos.List() {
+			if _, err := m.Maintain(r.Name, TaskAuto); err != nil && !errors.Is(err, ErrBusy) {
+				log.Printf("❌ Maintenance on %s failed: %v", r.Name, err)
+			}
+		}
+	}
+}
+
+// Maintain 在仓库上执行一次维护任务并返回之后的报告
+// 任务失败时也返回报告，last_error 里是失败原因
+func (m *Manager) Maintain(name, task string) (*Report, error) {
+	name = utils.NormalizeRepoName(name)
+	switch task {
+	case TaskAuto, TaskRepack, TaskGC, TaskFsck:
+	default:
+		return nil, ErrInvalidTask
+	}
+	if !m.repos.Exists(name) {
+		return nil, repo.ErrNotFound
+	}
+
+	m.mu.Lock()
+	if m.running[name] {
+		m.mu.Unlock()
+		return nil, ErrBusy
+	}
+	m.running[name] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, name)
+		m.mu.Unlock()
+	}()
+
+	// 推送拿的是读锁，这里等正在进行的推送结束，之后的推送等维护结束
+	lock := m.repos.RepoLock(name)
+	lock.Lock()
+	tasks, err := m.plan(name, task)
+	start := time.Now()
+	if err == nil {
+		err = m.execute(name, tasks)
+	}
+	lock.Unlock()
+
+	report, measureErr := m.Report(name)
+	if measureErr != nil {
+		return nil, measureErr
+	}
+	if len(tasks) == 0 && err == nil {
+		// 没有需要做的事情，只更新了大小
+		return report, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.reportLocked(name)
+	now := time.Now()
+	r.LastTask = task
+	r.LastRunAt = &now
+	r.LastDuration = now.Sub(start).Round(time.Millisecond).String()
+	r.LastError = ""
+	if err != nil {
+		r.LastError = err.Error()
+	}
+	if saveErr := m.saveLocked(); saveErr != nil {
+		log.Printf("❌ Failed to save maintenance reports: %v", saveErr)
+	}
+	cp := *r
+	return &cp, err
+}
+
+// plan 根据任务和仓库当前的对象统计决定要执行的步骤
+func (m *Manager) plan(name, task string) ([]string, error) {
+	if task != TaskAuto {
+		return []string{task}, nil
+	}
+	st, err := countObjects(m.repos.Path(name))
+	if err != nil {
+		return nil, err
+	}
+	var tasks []string
+	switch {
+	case st.Packs >= int64(threshold(m.PackThreshold, DefaultPackThreshold)):
+		tasks = append(tasks, TaskGC)
+	case st.LooseObjects >= int64(threshold(m.LooseThreshold, DefaultLooseThreshold)):
+		tasks = append(tasks, TaskRepack)
+	}
+	if m.FsckInterval > 0 {
+		m.mu.Lock()
+		last := m.reportLocked(name).LastFsckAt
+		m.mu.Unlock()
+		if last == nil || time.Since(*last) >= m.FsckInterval {
+			tasks = append(tasks, TaskFsck)
+		}
+	}
+	return tasks, nil
+}
+
+// execute 依次执行维护步骤，调用方必须持有仓库的写锁
+func (m *Manager) execute(name string, tasks []string) error {
+	path := m.repos.Path(name)
+	meta, err := m.repos.Get(name)
+	if err != nil {
+		return err
+	}
+	isFork := meta.ForkOf != ""
+	for _, task := range tasks {
+		log.Printf("🧹 Running %s on %s", task, name)
+		var err error
+		switch task {
+		case TaskRepack:
+			err = repack(path, isFork)
+		case TaskGC:
+			err = gc(path, len(m.repos.Forks(name)) > 0, isFork)
+		case TaskFsck:
+			err = fsck(path)
+			m.recordFsck(name, err)
+			if err != nil {
+				// 损坏已经记在报告和告警里，不影响后续步骤
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		m.recordDone(name, task)
+	}
+	return nil
+}
+
+// recordDone 记录 repack / gc 的完成时间
+func (m *Manager) recordDone(name, task string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.reportLocked(name)
+	now := time.Now()
+	switch task {
+	case TaskRepack:
+		r.LastRepackAt = &now
+	case TaskGC:
+		r.LastGCAt = &now
+	}
+}
+
+// recordFsck 记录 fsck 结果，新发现损坏时记日志并发出 repo_corrupt 事件
+func (m *Manager) recordFsck(name string, fsckErr error) {
+	m.mu.Lock()
+	r := m.reportLocked(name)
+	now := time.Now()
+	r.LastFsckAt = &now
+	wasCorrupt := r.Corrupt
+	r.Corrupt = fsckErr != nil
+	r.FsckError = ""
+	if fsckErr != nil {
+		r.FsckError = fsckErr.Error()
+	}
+	m.mu.Unlock()
+
+	if fsckErr == nil {
+		if wasCorrupt {
+			log.Printf("✅ %s passed fsck again", name)
+		}
+		return
+	}
+	log.Printf("🚨 Repository %s is corrupt: %v", name, fsckErr)
+	if m.webhooks != nil && !wasCorrupt {
+		alert := Alert{Event: types.EventRepoCorrupt, RepoName: name, Error: fsckErr.Error(), CheckedAt: now}
+		if _, err := m.webhooks.Publish(name, types.EventRepoCorrupt, alert); err != nil {
+			log.Printf("❌ Failed to publish corruption alert for %s: %v", name, err)
+		}
+	}
+}
+
+// Report 重新统计仓库大小，和最近一次维护的结果一起返回
+func (m *Manager) Report(name string) (*Report, error) {
+	meta, err := m.repos.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	name = meta.Name
+	st, err := countObjects(m.repos.Path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.reportLocked(name)
+	r.SizeBytes = meta.SizeBytes
+	r.LooseObjects = st.LooseObjects
+	r.LooseBytes = st.LooseBytes
+	r.PackedObjects = st.PackedObjects
+	r.Packs = st.Packs
+	r.PackBytes = st.PackBytes
+	r.GarbageBytes = st.GarbageBytes
+	r.MeasuredAt = time.Now()
+	cp := *r
+	cp.Running = m.running[name]
+	return &cp, nil
+}
+
+// Reports 所有仓库的报告，按占用从大到小排列
+func (m *Manager) Reports() []*Report {
+	list := []*Report{}
+	for _, r := range m.repos.List() {
+		report, err := m.Report(r.Name)
+		if err != nil {
+			continue
+		}
+		list = append(list, report)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].SizeBytes != list[j].SizeBytes {
+			return list[i].SizeBytes > list[j].SizeBytes
+		}
+		return list[i].Repo < list[j].Repo
+	})
+	return list
+}
+
+// RenameRepo 仓库改名时迁移它的维护记录
+func (m *Manager) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.reports[oldName]
+	if !ok {
+		return nil
+	}
+	delete(m.reports, oldName)
+	r.Repo = newName
+	m.reports[newName] = r
+	return m.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的维护记录
+func (m *Manager) DeleteRepo(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.reports, utils.NormalizeRepoName(name))
+	return m.saveLocked()
+}
+
+// reportLocked 取出仓库的报告，不存在时创建一个，调用方必须持有 m.mu
+func (m *Manager) reportLocked(name string) *Report {
+	r, ok := m.reports[name]
+	if !ok {
+		r = &Report{Repo: name}
+		m.reports[name] = r
+	}
+	return r
+}
+
+// saveLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveLocked() error {
+	list := make([]*Report, 0, len(m.reports))
+	for _, r := range m.reports {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Repo < list[j].Repo })
+	return m.store.Save(maintenanceFile, list)
+}
+
+func threshold(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
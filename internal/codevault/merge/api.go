@@ -0,0 +1,364 @@
+package merge
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 合并请求接口：有读权限就能查看，开、批准、合并需要写权限
+type API struct {
+	manager *Manager
+	policy  *access.Policy
+}
+
+// NewAPI 创建接口
+func NewAPI(manager *Manager, policy *access.Policy) *API {
+	return &API{manager: manager, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/merge-requests", a.handleCreate)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/merge-requests", a.handleList)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/merge-requests/{id}", a.handleGet)
+	mux.HandleFunc("PATCH /api/repos/{owner}/{repo}/merge-requests/{id}", a.handleUpdate)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/merge-requests/{id}/approve", a.handleApprove)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/merge-requests/{id}/approve", a.handleUnapprove)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/merge-requests/{id}/merge", a.handleMerge)
+
+	// 评审和评论
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/merge-requests/{id}/reviews", a.handleListReviews)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/merge-requests/{id}/reviews", a.handleSubmitReview)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/merge-requests/{id}/comments", a.handleListComments)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/merge-requests/{id}/comments", a.handleAddComment)
+	mux.HandleFunc("PATCH /api/repos/{owner}/{repo}/merge-requests/{id}/comments/{comment}", a.handleEditComment)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/merge-requests/{id}/comments/{comment}", a.handleDeleteComment)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/merge-requests/{id}/comments/{comment}/resolve", a.handleResolve)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/merge-requests/{id}/comments/{comment}/resolve", a.handleResolve)
+}
+
+// view 返回给客户端的合并请求，附带当前阻止合并的原因
+type view struct {
+	*MergeRequest
+	Blockers []string `json:"blockers"`
+}
+
+func (a *API) view(mr *MergeRequest) view {
+	blockers := a.manager.Blockers(mr)
+	if blockers == nil {
+		blockers = []string{}
+	}
+	return view{MergeRequest: mr, Blockers: blockers}
+}
+
+// require 检查权限并解析合并请求编号
+func (a *API) require(w http.ResponseWriter, r *http.Request, level access.Level) (string, int, bool) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, level) {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, 404, ErrNotFound.Error())
+		return "", 0, false
+	}
+	return name, id, true
+}
+
+// handleCreate 同一个仓库里的分支需要写权限；从 fork 发起只需要能读目标仓库和 fork
+func (a *API) handleCreate(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	var opts CreateOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if opts.SourceRepo == "" || utils.NormalizeRepoName(opts.SourceRepo) == utils.NormalizeRepoName(name) {
+		if !a.policy.Require(w, r, name, access.Write) {
+			return
+		}
+	} else if !a.policy.Require(w, r, name, access.Read) || !a.policy.Require(w, r, opts.SourceRepo, access.Read) {
+		return
+	}
+	if _, ok := auth.RequireUser(w, r); !ok {
+		return
+	}
+	mr, err := a.manager.Create(name, opts, auth.UserFromContext(r.Context()).Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, a.view(mr))
+}
+
+// handleList 按状态过滤：?state=open（默认）、merged、closed、all
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = StateOpen
+	}
+	utils.WriteJSON(w, 200, a.manager.List(name, state))
+}
+
+// handleGet 查询时顺便刷新 head 和可合并性
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	mr, err := a.manager.Refresh(name, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, a.view(mr))
+}
+
+// handleUpdate 修改标题、描述，或者通过 state 关闭 / 重新打开
+func (a *API) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		State       *string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+
+	mr, err := a.manager.Edit(name, id, req.Title, req.Description)
+	if err == nil && req.State != nil && *req.State != mr.State {
+		switch *req.State {
+		case StateClosed:
+			mr, err = a.manager.Close(name, id)
+		case StateOpen:
+			mr, err = a.manager.Reopen(name, id)
+		default:
+			utils.WriteError(w, 400, "state must be open or closed")
+			return
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, a.view(mr))
+}
+
+func (a *API) handleApprove(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	mr, err := a.manager.Approve(name, id, auth.UserFromContext(r.Context()).Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, a.view(mr))
+}
+
+func (a *API) handleUnapprove(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	mr, err := a.manager.Unapprove(name, id, auth.UserFromContext(r.Context()).Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, a.view(mr))
+}
+
+// handleMerge 合并：{"strategy": "merge|squash|rebase", "message": "..."}，rebase 会保留原来的提交说明
+func (a *API) handleMerge(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	var req struct {
+		Strategy string `json:"strategy"`
+		Message  string `json:"message"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.WriteError(w, 400, "invalid JSON")
+			return
+		}
+	}
+	mr, err := a.manager.Merge(name, id, req.Strategy, req.Message, auth.UserFromContext(r.Context()))
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		utils.WriteJSON(w, 405, map[string]any{"error": "merge request is not mergeable", "reasons": blocked.Reasons})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, a.view(mr))
+}
+
+func (a *API) handleListReviews(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	mr, err := a.manager.Get(name, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, mr.Reviews)
+}
+
+// handleSubmitReview 有读权限就可以评论，approve 和 request_changes 需要写权限
+func (a *API) handleSubmitReview(w http.ResponseWriter, r *http.Request) {
+	// 公开仓库匿名用户也有读权限，评论、评审要记下是谁，必须先登录
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	var opts ReviewOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if opts.State != "" && opts.State != "comment" && opts.State != ReviewCommented {
+		if !a.policy.Require(w, r, name, access.Write) {
+			return
+		}
+	}
+	review, err := a.manager.SubmitReview(name, id, opts, user.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, review)
+}
+
+func (a *API) handleListComments(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	threads, err := a.manager.Comments(name, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, threads)
+}
+
+func (a *API) handleAddComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	var opts CommentOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	c, err := a.manager.AddComment(name, id, opts, user.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, c)
+}
+
+func (a *API) handleEditComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	commentID, _ := strconv.Atoi(r.PathValue("comment"))
+	c, err := a.manager.EditComment(name, id, commentID, req.Body, user.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, c)
+}
+
+// handleDeleteComment 作者本人或仓库管理员可以删除
+func (a *API) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	isAdmin := a.policy.Level(user, name) >= access.Admin
+	commentID, _ := strconv.Atoi(r.PathValue("comment"))
+	if err := a.manager.DeleteComment(name, id, commentID, user.Username, isAdmin); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handleResolve POST 解决线程，DELETE 重新打开，需要写权限
+func (a *API) handleResolve(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	commentID, _ := strconv.Atoi(r.PathValue("comment"))
+	c, err := a.manager.ResolveThread(name, id, commentID, r.Method == http.MethodPost, auth.UserFromContext(r.Context()).Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, c)
+}
+
+// writeError 把合并请求模块的错误映射成 HTTP 状态码
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrCommentNotFound), errors.Is(err, repo.ErrNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrNotOpen), errors.Is(err, ErrMergeFailed):
+		utils.WriteError(w, 409, err.Error())
+	default:
+		utils.WriteError(w, 400, err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+package merge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/protect"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/status"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+)
+
+// testAPI 注册合并请求的路由，alice/demo.git 是公开仓库，匿名用户有读权限
+func testAPI(t *testing.T) *http.ServeMux {
+	t.Helper()
+	dir := t.TempDir()
+	st, err := store.New(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.NewPolicy(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos, err := repo.NewManager(filepath.Join(dir, "repos"), st, policy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.InitRepo("alice/demo.git", "alice", access.Public); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := status.NewStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := protect.NewRules(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(st, repos, statuses, rules, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewAPI(m, policy).RegisterRoutes(mux)
+	return mux
+}
+
+func TestAnonymousCannotReviewOrComment(t *testing.T) {
+	mux := testAPI(t)
+	base := "/api/repos/alice/demo.git/merge-requests/1"
+	requests := []struct{ method, path, body string }{
+		{"POST", base + "/reviews", `{"state":"comment","body":"hi"}`},
+		{"POST", base + "/comments", `{"body":"hi"}`},
+		{"PATCH", base + "/comments/1", `{"body":"edited"}`},
+		{"DELETE", base + "/comments/1", ""},
+	}
+	for _, req := range requests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+		if w.Code != 401 {
+			t.Errorf("anonymous %s %s returned %d, want 401", req.method, req.path, w.Code)
+		}
+	}
+
+	// 读还是可以匿名
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", base+"/comments", nil))
+	if w.Code == 401 {
+		t.Errorf("anonymous GET comments should not require login")
+	}
+}
@@ -0,0 +1,202 @@
+package merge
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 合并方式
+const (
+	StrategyMerge  = "merge"  // 生成合并提交
+	StrategySquash = "squash" // 把源分支压成一个提交
+	StrategyRebase = "rebase" // 把源分支的提交逐个变基到目标分支上，然后快进
+)
+
+// identity 服务端生成提交时使用的身份，用户没有邮箱，用用户名拼一个
+type identity struct {
+	Name  string
+	Email string
+}
+
+func userIdentity(username string) identity {
+	return identity{Name: username, Email: username + "@users.noreply.devnexus"}
+}
+
+// gitRepo 裸仓库上的 git 操作
+type gitRepo struct {
+	path string
+}
+
+// run 执行 git 命令，出错时把输出带上
+func (g gitRepo) run(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(stderr.String()+string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// branchSHA 查询分支当前指向的提交
+func (g gitRepo) branchSHA(branch string) (string, error) {
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return "", fmt.Errorf("invalid branch: %q", branch)
+	}
+	sha, err := g.run(g.path, nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("branch %s does not exist", branch)
+	}
+	return sha, nil
+}
+
+// mergeBase 两个提交的合并基点，old 侧的行评论锚定在这里；没有共同历史时返回 base
+func (g gitRepo) mergeBase(base, head string) string {
+	sha, err := g.run(g.path, nil, "merge-base", base, head)
+	if err != nil {
+		return base
+	}
+	return sha
+}
+
+// lineCount 文件在某个提交里有多少行
+func (g gitRepo) lineCount(sha, file string) (int, error) {
+	if strings.HasPrefix(sha, "-") {
+		return 0, fmt.Errorf("invalid commit: %q", sha)
+	}
+	cmd := exec.Command("git", "cat-file", "blob", sha+":"+file)
+	cmd.Dir = g.path
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s does not exist at %.7s", file, sha)
+	}
+	n := bytes.Count(out, []byte("\n"))
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		n++
+	}
+	return n, nil
+}
+
+// hunkHeader 匹配 unified diff 的 @@ -a,b +c,d @@，省略的长度是 1
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// trackLine 计算 from 里的第 line 行在 to 里是第几行
+// 这一行被修改、删除，或者整个文件被删除时返回 outdated
+func (g gitRepo) trackLine(from, to, file string, line int) (int, bool) {
+	if from == to {
+		return line, false
+	}
+	if _, err := g.run(g.path, nil, "cat-file", "-e", to+":"+file); err != nil {
+		return 0, true
+	}
+	out, err := g.run(g.path, nil, "diff", "-U0", "--no-color", "--no-ext-diff", from, to, "--", file)
+	if err != nil {
+		return 0, true
+	}
+
+	shift := 0
+	for _, l := range strings.Split(out, "\n") {
+		m := hunkHeader.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		oldStart, _ := strconv.Atoi(m[1])
+		oldLen, newLen := 1, 1
+		if m[2] != "" {
+			oldLen, _ = strconv.Atoi(m[2])
+		}
+		if m[4] != "" {
+			newLen, _ = strconv.Atoi(m[4])
+		}
+		switch {
+		case oldLen == 0 && oldStart < line:
+			// 在 oldStart 之后插入了 newLen 行
+			shift += newLen
+		case oldLen > 0 && line >= oldStart && line < oldStart+oldLen:
+			return 0, true
+		case oldLen > 0 && oldStart+oldLen <= line:
+			shift += newLen - oldLen
+		}
+	}
+	return line + shift, false
+}
+
+// mergeTree 在不需要工作区的情况下试合并，返回冲突的文件
+// 依赖 git 2.38 引入的 merge-tree --write-tree，有冲突时退出码是 1
+func (g gitRepo) mergeTree(base, head string) ([]string, error) {
+	cmd := exec.Command("git", "merge-tree", "--write-tree", "--name-only", "--no-messages", "-z", base, head)
+	cmd.Dir = g.path
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		// 输出格式：<tree> NUL <冲突文件> NUL ...
+		fields := strings.Split(strings.TrimRight(string(out), "\x00"), "\x00")
+		conflicts := []string{}
+		for _, f := range fields[1:] {
+			if f != "" {
+				conflicts = append(conflicts, f)
+			}
+		}
+		return conflicts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git merge-tree failed: %v", err)
+	}
+	return nil, nil
+}
+
+// merge 在临时工作区里按指定方式合并，返回目标分支的新提交，不更新引用
+func (g gitRepo) merge(strategy, base, head, message string, author, committer identity) (string, error) {
+	dir, err := os.MkdirTemp("", "devnexus-merge-*")
+	if err != nil {
+		return "", err
+	}
+	os.Remove(dir) // worktree add 要求目录不存在
+	defer func() {
+		g.run(g.path, nil, "worktree", "remove", "--force", dir)
+		os.RemoveAll(dir)
+		g.run(g.path, nil, "worktree", "prune")
+	}()
+
+	env := []string{
+		"GIT_AUTHOR_NAME=" + author.Name, "GIT_AUTHOR_EMAIL=" + author.Email,
+		"GIT_COMMITTER_NAME=" + committer.Name, "GIT_COMMITTER_EMAIL=" + committer.Email,
+	}
+	start := base
+	if strategy == StrategyRebase {
+		start = head
+	}
+	if _, err := g.run(g.path, nil, "worktree", "add", "--detach", dir, start); err != nil {
+		return "", err
+	}
+
+	switch strategy {
+	case StrategyMerge:
+		_, err = g.run(dir, env, "merge", "--no-ff", "--no-edit", "-m", message, head)
+	case StrategySquash:
+		if _, err = g.run(dir, env, "merge", "--squash", head); err == nil {
+			_, err = g.run(dir, env, "commit", "--allow-empty", "-m", message)
+		}
+	case StrategyRebase:
+		_, err = g.run(dir, env, "rebase", "--no-autostash", base)
+	default:
+		return "", fmt.Errorf("unknown merge strategy: %q", strategy)
+	}
+	if err != nil {
+		return "", err
+	}
+	return g.run(dir, nil, "rev-parse", "HEAD")
+}
+
+// updateBranch 把分支从 old 更新到 new，分支在这期间被别人推送过时失败
+func (g gitRepo) updateBranch(branch, newSHA, oldSHA string) error {
+	_, err := g.run(g.path, nil, "update-ref", "refs/heads/"+branch, newSHA, oldSHA)
+	return err
+}
@@ -0,0 +1,554 @@
+package merge
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/hooks"
+	"github.com/chanslights/DevNexus/internal/codevault/protect"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+	"github.com/chanslights/DevNexus/internal/codevault/status"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// DefaultRequiredCheck 合并前 head 上必须通过的状态，即 OpsEngine 上报的流水线结果
+const DefaultRequiredCheck = "opsengine/pipeline"
+
+// Manager 管理合并请求：跟踪源分支的最新提交、计算可合并性、在服务端执行合并
+type Manager struct {
+	store      *store.Store
+	repos      *repo.Manager
+	statuses   *status.Store
+	rules      *protect.Rules
+	protection *protect.Checker
+	webhooks   *webhook.Dispatcher
+	hooks      *hooks.Manager // 合并和推送一样执行 pre-receive / post-receive 钩子
+	signers    *signing.Verifier
+
+	// RequiredCheck 合并前 head 上必须是 success 的状态 context，为空时只看分支保护规则里的要求
+	RequiredCheck string
+
+	mu       sync.Mutex
+	requests map[string]*MergeRequest // repo#id -> 合并请求
+	comments map[string]*Comment      // repo#id#comment -> 评论
+	mergeMu  sync.Mutex               // 同一时间只执行一个合并
+}
+
+// NewManager 创建合并请求管理器并从 store 中加载
+func NewManager(st *store.Store, repos *repo.Manager, statuses *status.Store, rules *protect.Rules, protection *protect.Checker, webhooks *webhook.Dispatcher, receiveHooks *hooks.Manager, signers *signing.Verifier) (*Manager, error) {
+	m := &Manager{
+		store:         st,
+		repos:         repos,
+		statuses:      statuses,
+		rules:         rules,
+		protection:    protection,
+		webhooks:      webhooks,
+		hooks:         receiveHooks,
+		signers:       signers,
+		RequiredCheck: DefaultRequiredCheck,
+		requests:      make(map[string]*MergeRequest),
+		comments:      make(map[string]*Comment),
+	}
+	var saved []*MergeRequest
+	if err := st.Load(requestsFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, mr := range saved {
+		m.requests[key(mr.Repo, mr.ID)] = mr
+	}
+	var comments []*Comment
+	if err := st.Load(commentsFile, &comments); err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		m.comments[commentKey(c.Repo, c.MergeID, c.ID)] = c
+	}
+	return m, nil
+}
+
+// git 打开仓库
+func (m *Manager) git(repoName string) gitRepo {
+	return gitRepo{path: m.repos.Path(repoName)}
+}
+
+// Create 新建合并请求，同一对分支同时只能有一个打开的合并请求
+func (m *Manager) Create(repoName string, opts CreateOptions, author string) (*MergeRequest, error) {
+	repoName = utils.NormalizeRepoName(repoName)
+	if !m.repos.Exists(repoName) {
+		return nil, repo.ErrNotFound
+	}
+	if strings.TrimSpace(opts.Title) == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if opts.TargetBranch == "" {
+		if r, err := m.repos.Get(repoName); err == nil {
+			opts.TargetBranch = r.DefaultBranch
+		}
+	}
+	if opts.SourceRepo != "" {
+		opts.SourceRepo = utils.NormalizeRepoName(opts.SourceRepo)
+		if opts.SourceRepo == repoName {
+			opts.SourceRepo = ""
+		} else if fork, err := m.repos.Get(opts.SourceRepo); err != nil || fork.ForkOf != repoName {
+			return nil, fmt.Errorf("%s is not a fork of %s", opts.SourceRepo, repoName)
+		}
+	}
+	if opts.SourceRepo == "" && opts.SourceBranch == opts.TargetBranch {
+		return nil, fmt.Errorf("source and target branch must differ")
+	}
+	g := m.git(repoName)
+	head, err := m.sourceHead(repoName, opts.SourceRepo, opts.SourceBranch)
+	if err != nil {
+		return nil, err
+	}
+	base, err := g.branchSHA(opts.TargetBranch)
+	if err != nil {
+		return nil, err
+	}
+	conflicts, err := g.mergeTree(base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := 1
+	for _, mr := range m.requests {
+		if mr.Repo != repoName {
+			continue
+		}
+		if mr.State == StateOpen && mr.SourceRepo == opts.SourceRepo && mr.SourceBranch == opts.SourceBranch && mr.TargetBranch == opts.TargetBranch {
+			return nil, fmt.Errorf("merge request !%d already exists for %s -> %s", mr.ID, mr.sourceLabel(), opts.TargetBranch)
+		}
+		id = max(id, mr.ID+1)
+	}
+	now := time.Now()
+	mr := &MergeRequest{
+		ID:           id,
+		Repo:         repoName,
+		Title:        strings.TrimSpace(opts.Title),
+		Description:  opts.Description,
+		SourceRepo:   opts.SourceRepo,
+		SourceBranch: opts.SourceBranch,
+		TargetBranch: opts.TargetBranch,
+		Author:       author,
+		State:        StateOpen,
+		Approvals:    []Approval{},
+		Reviews:      []Review{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	setHeads(mr, head, base, conflicts)
+	m.requests[key(repoName, id)] = mr
+	return mr.clone(), m.saveLocked()
+}
+
+// sourceHead 源分支的最新提交
+// 来自 fork 时先把 fork 的分支抓到目标仓库的 refs/forks/<fork>/<分支>，之后试合并、合并都只在目标仓库里进行
+// fork 和目标仓库共享对象，只会传输 fork 新增的提交
+func (m *Manager) sourceHead(repoName, sourceRepo, branch string) (string, error) {
+	g := m.git(repoName)
+	if sourceRepo == "" {
+		return g.branchSHA(branch)
+	}
+	sha, err := m.git(sourceRepo).branchSHA(branch)
+	if err != nil {
+		return "", fmt.Errorf("branch %s does not exist in %s", branch, sourceRepo)
+	}
+	ref := "refs/forks/" + sourceRepo + "/" + branch
+	if current, err := g.run(g.path, nil, "rev-parse", "--verify", "--quiet", ref); err == nil && current == sha {
+		return sha, nil
+	}
+	forkPath, err := filepath.Abs(m.repos.Path(sourceRepo))
+	if err != nil {
+		return "", err
+	}
+	if _, err := g.run(g.path, nil, "fetch", "--quiet", "--no-tags", forkPath, "+"+sha+":"+ref); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
+
+// fromFork 从 fork 发起、还打开着的合并请求
+func (m *Manager) fromFork(fork string) []*MergeRequest {
+	fork = utils.NormalizeRepoName(fork)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []*MergeRequest
+	for _, mr := range m.requests {
+		if mr.SourceRepo == fork && mr.State == StateOpen {
+			list = append(list, mr.clone())
+		}
+	}
+	return list
+}
+
+// Edit 修改标题和描述
+func (m *Manager) Edit(repoName string, id int, title, description *string) (*MergeRequest, error) {
+	return m.update(repoName, id, func(mr *MergeRequest) error {
+		if title != nil {
+			if strings.TrimSpace(*title) == "" {
+				return fmt.Errorf("title is required")
+			}
+			mr.Title = strings.TrimSpace(*title)
+		}
+		if description != nil {
+			mr.Description = *description
+		}
+		return nil
+	})
+}
+
+// Close 关闭合并请求
+func (m *Manager) Close(repoName string, id int) (*MergeRequest, error) {
+	return m.update(repoName, id, func(mr *MergeRequest) error {
+		if mr.State != StateOpen {
+			return ErrNotOpen
+		}
+		mr.State = StateClosed
+		return nil
+	})
+}
+
+// Reopen 重新打开已关闭的合并请求，源分支必须还在
+func (m *Manager) Reopen(repoName string, id int) (*MergeRequest, error) {
+	_, err := m.update(repoName, id, func(mr *MergeRequest) error {
+		if mr.State != StateClosed {
+			return fmt.Errorf("only closed merge requests can be reopened")
+		}
+		if _, err := m.sourceHead(mr.Repo, mr.SourceRepo, mr.SourceBranch); err != nil {
+			return err
+		}
+		mr.State = StateOpen
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.Refresh(repoName, id)
+}
+
+// Approve 批准当前的 head，相当于提交一次没有评论的 approve 评审
+func (m *Manager) Approve(repoName string, id int, username string) (*MergeRequest, error) {
+	if _, err := m.SubmitReview(repoName, id, ReviewOptions{State: ReviewApproved}, username); err != nil {
+		return nil, err
+	}
+	return m.Get(repoName, id)
+}
+
+// Unapprove 撤回批准
+func (m *Manager) Unapprove(repoName string, id int, username string) (*MergeRequest, error) {
+	return m.update(repoName, id, func(mr *MergeRequest) error {
+		mr.Approvals = removeApproval(mr.Approvals, username)
+		return nil
+	})
+}
+
+// Refresh 重新读取两个分支并计算可合并性，打开状态以外的合并请求保持不变
+func (m *Manager) Refresh(repoName string, id int) (*MergeRequest, error) {
+	mr, err := m.Get(repoName, id)
+	if err != nil || mr.State != StateOpen {
+		return mr, err
+	}
+	g := m.git(repoName)
+	head, headErr := m.sourceHead(mr.Repo, mr.SourceRepo, mr.SourceBranch)
+	base, err := g.branchSHA(mr.TargetBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	// 源分支被删除时自动关闭
+	if headErr != nil {
+		log.Printf("Closing merge request %s!%d: source branch %s was deleted", mr.Repo, mr.ID, mr.sourceLabel())
+		return m.update(repoName, id, func(mr *MergeRequest) error {
+			mr.State = StateClosed
+			return nil
+		})
+	}
+	if head == mr.HeadSHA && base == mr.BaseSHA && mr.MergeStatus != MergeStatusUnknown {
+		return mr, nil
+	}
+	conflicts, err := g.mergeTree(base, head)
+	if err != nil {
+		return nil, err
+	}
+	headChanged := head != mr.HeadSHA
+	updated, err := m.update(repoName, id, func(mr *MergeRequest) error {
+		if mr.State == StateOpen {
+			setHeads(mr, head, base, conflicts)
+		}
+		return nil
+	})
+	if err == nil && headChanged {
+		m.reanchorComments(repoName, id, head)
+	}
+	return updated, err
+}
+
+// setHeads 记录最新的 head / base 和冲突，head 变了之前的批准都作废
+func setHeads(mr *MergeRequest, head, base string, conflicts []string) {
+	if mr.HeadSHA != "" && mr.HeadSHA != head {
+		mr.Approvals = []Approval{}
+	}
+	mr.HeadSHA, mr.BaseSHA = head, base
+	mr.Conflicts = conflicts
+	mr.MergeStatus = MergeStatusMergeable
+	if len(conflicts) > 0 {
+		mr.MergeStatus = MergeStatusConflict
+	}
+}
+
+// Blockers 列出当前阻止合并的原因，为空表示可以合并
+func (m *Manager) Blockers(mr *MergeRequest) []string {
+	var reasons []string
+	if mr.State != StateOpen {
+		return []string{ErrNotOpen.Error()}
+	}
+	if mr.MergeStatus == MergeStatusConflict {
+		reasons = append(reasons, fmt.Sprintf("merge conflicts in %d file(s)", len(mr.Conflicts)))
+	}
+
+	// 1.状态检查：OpsEngine 的流水线 + 目标分支保护规则要求的 context
+	var contexts []string
+	if m.RequiredCheck != "" {
+		contexts = append(contexts, m.RequiredCheck)
+	}
+	required := 0
+	for _, rule := range m.rules.Matching(mr.Repo, mr.TargetBranch) {
+		contexts = append(contexts, rule.RequiredStatusChecks...)
+		required = max(required, rule.RequiredApprovals)
+	}
+	seen := make(map[string]bool)
+	for _, ctx := range contexts {
+		if seen[ctx] {
+			continue
+		}
+		seen[ctx] = true
+		cs, ok := m.statuses.Get(mr.Repo, mr.HeadSHA, ctx)
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("required status %q is missing for %.7s", ctx, mr.HeadSHA))
+		} else if cs.State != status.Success {
+			reasons = append(reasons, fmt.Sprintf("required status %q is %s for %.7s", ctx, cs.State, mr.HeadSHA))
+		}
+	}
+
+	// 2.批准数，以及还没撤回的 request_changes
+	if len(mr.Approvals) < required {
+		reasons = append(reasons, fmt.Sprintf("%d of %d required approvals", len(mr.Approvals), required))
+	}
+	for _, user := range changesRequested(mr) {
+		reasons = append(reasons, fmt.Sprintf("changes requested by %s", user))
+	}
+
+	// 3.目标分支要求签名时，合并进去的每个提交都要有已知用户的有效签名
+	if m.requiresSignatures(mr) {
+		if unsigned, err := m.unsignedCommits(mr); err != nil {
+			reasons = append(reasons, "failed to verify commit signatures")
+		} else if unsigned > 0 {
+			reasons = append(reasons, fmt.Sprintf("%d commit(s) are not signed by a known user", unsigned))
+		}
+	}
+	return reasons
+}
+
+// unsignedCommits 统计 base..head 之间没有有效签名的提交
+func (m *Manager) unsignedCommits(mr *MergeRequest) (int, error) {
+	if m.signers == nil {
+		return 0, fmt.Errorf("signature verification is not configured")
+	}
+	g := m.git(mr.Repo)
+	out, err := g.run(g.path, nil, "rev-list", mr.HeadSHA, "--not", mr.BaseSHA)
+	if err != nil {
+		return 0, err
+	}
+	shas := strings.Fields(out)
+	results, err := m.signers.VerifyObjects(g.path, nil, shas)
+	if err != nil {
+		return 0, err
+	}
+	unsigned := 0
+	for _, sha := range shas {
+		if v := results[sha]; v == nil || !v.Verified {
+			unsigned++
+		}
+	}
+	return unsigned, nil
+}
+
+// requiresSignatures 目标分支是否有要求签名的保护规则
+func (m *Manager) requiresSignatures(mr *MergeRequest) bool {
+	for _, rule := range m.rules.Matching(mr.Repo, mr.TargetBranch) {
+		if rule.RequireSignedCommits {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge 检查合并条件后在服务端执行合并，目标分支的更新和推送走同样的流程：
+// 分支保护的推送限制、pre-receive 钩子，成功后触发 Webhook 和 post-receive 钩子
+func (m *Manager) Merge(repoName string, id int, strategy, message string, user *auth.User) (*MergeRequest, error) {
+	m.mergeMu.Lock()
+	defer m.mergeMu.Unlock()
+
+	if strategy == "" {
+		strategy = StrategyMerge
+	}
+	if strategy != StrategyMerge && strategy != StrategySquash && strategy != StrategyRebase {
+		return nil, fmt.Errorf("unknown merge strategy: %q", strategy)
+	}
+
+	// 1.用分支的最新状态检查合并条件
+	mr, err := m.Refresh(repoName, id)
+	if err != nil {
+		return nil, err
+	}
+	if reasons := m.Blockers(mr); len(reasons) > 0 {
+		return nil, &BlockedError{Reasons: reasons}
+	}
+	// squash 和 rebase 会在服务端生成新的提交，原来的签名就没有了；合并提交由 CodeVault 生成，不要求签名
+	if strategy != StrategyMerge && m.requiresSignatures(mr) {
+		return nil, &BlockedError{Reasons: []string{fmt.Sprintf("%s requires signed commits, only the merge strategy keeps them", mr.TargetBranch)}}
+	}
+	// 目标分支限制了推送时，只有允许直接推送的用户可以合并
+	if m.protection != nil {
+		if reason := m.protection.Restricted(mr.Repo, mr.TargetBranch, user); reason != "" {
+			return nil, &BlockedError{Reasons: []string{reason}}
+		}
+	}
+
+	// 2.和推送一样拿仓库的读锁，合并和更新引用期间不和 gc / repack 同时进行
+	username := user.Username
+	repoPath, err := filepath.Abs(m.repos.Path(repoName))
+	if err != nil {
+		return nil, err
+	}
+	lock := m.repos.RepoLock(repoName)
+	lock.RLock()
+	newSHA, err := m.mergeLocked(mr, strategy, message, username, repoPath)
+	lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🔀 Merged %s!%d (%s) into %s by %s: %.7s", mr.Repo, mr.ID, strategy, mr.TargetBranch, username, newSHA)
+
+	merged, err := m.update(repoName, id, func(mr *MergeRequest) error {
+		now := time.Now()
+		mr.State = StateMerged
+		mr.MergeCommit = newSHA
+		mr.MergedBy = username
+		mr.MergedAt = &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 4.目标分支更新了，和推送一样通知 OpsEngine 和订阅方，触发 post-receive（推送镜像、代码搜索等）
+	update := types.RefUpdate{Ref: "refs/heads/" + merged.TargetBranch, OldSHA: merged.BaseSHA, NewSHA: newSHA}
+	m.repos.TouchPush(repoName)
+	if m.webhooks != nil {
+		m.webhooks.PublishRefUpdate(merged.Repo, update, username)
+	}
+	if m.hooks != nil {
+		go m.hooks.PostReceive(&hooks.Push{
+			Repo:     merged.Repo,
+			RepoPath: repoPath,
+			Pusher:   username,
+			Updates:  []types.RefUpdate{update},
+			Env:      append(os.Environ(), "GIT_DIR="+repoPath),
+		})
+	}
+	return merged, nil
+}
+
+// mergeLocked 在临时工作区里合并，通过 pre-receive 钩子后更新目标分支，调用方必须持有仓库的读锁
+func (m *Manager) mergeLocked(mr *MergeRequest, strategy, message, username, repoPath string) (string, error) {
+	if message == "" {
+		message = defaultMessage(mr, strategy)
+	}
+	author := userIdentity(username)
+	if strategy == StrategySquash {
+		author = userIdentity(mr.Author)
+	}
+	g := m.git(mr.Repo)
+	newSHA, err := g.merge(strategy, mr.BaseSHA, mr.HeadSHA, message, author, userIdentity(username))
+	if err != nil {
+		log.Printf("❌ Failed to merge %s!%d: %v", mr.Repo, mr.ID, err)
+		return "", fmt.Errorf("%w: could not %s %s into %s, the branches may conflict", ErrMergeFailed, strategy, mr.sourceLabel(), mr.TargetBranch)
+	}
+
+	// 服务端 pre-receive 钩子，合并生成的提交已经在仓库里，没有隔离区
+	update := types.RefUpdate{Ref: "refs/heads/" + mr.TargetBranch, OldSHA: mr.BaseSHA, NewSHA: newSHA}
+	if m.hooks != nil && m.hooks.HasPreReceive(mr.Repo) {
+		report := m.hooks.PreReceive(&hooks.Push{
+			Repo:     mr.Repo,
+			RepoPath: repoPath,
+			Pusher:   username,
+			Updates:  []types.RefUpdate{update},
+			Env:      append(os.Environ(), "GIT_DIR="+repoPath),
+		})
+		if reason, ok := report.Rejected[update.Ref]; ok {
+			log.Printf("⛔ Merge of %s!%d by %s rejected: %s", mr.Repo, mr.ID, username, reason)
+			return "", &BlockedError{Reasons: []string{reason}}
+		}
+	}
+
+	// 更新目标分支，期间有人推送了目标分支就放弃
+	if err := g.updateBranch(mr.TargetBranch, newSHA, mr.BaseSHA); err != nil {
+		return "", fmt.Errorf("%w: target branch %s changed during merge, please retry", ErrMergeFailed, mr.TargetBranch)
+	}
+	return newSHA, nil
+}
+
+// defaultMessage 默认的提交说明
+func defaultMessage(mr *MergeRequest, strategy string) string {
+	if strategy == StrategySquash {
+		msg := fmt.Sprintf("%s (!%d)", mr.Title, mr.ID)
+		if mr.Description != "" {
+			msg += "\n\n" + mr.Description
+		}
+		return msg
+	}
+	return fmt.Sprintf("Merge branch '%s' into '%s'\n\n%s (!%d)", mr.sourceLabel(), mr.TargetBranch, mr.Title, mr.ID)
+}
+
+// Name 实现 hooks.PostReceiveHook
+func (m *Manager) Name() string {
+	return "merge-requests"
+}
+
+// PostReceive 推送之后刷新涉及到的合并请求：源分支有新提交，或者目标分支变了需要重新计算冲突
+func (m *Manager) PostReceive(p *hooks.Push) {
+	branches := make(map[string]bool)
+	for _, u := range p.Updates {
+		if u.IsBranch() {
+			branches[u.ShortName()] = true
+		}
+	}
+	for _, mr := range m.List(p.Repo, StateOpen) {
+		if (mr.SourceRepo == "" && branches[mr.SourceBranch]) || branches[mr.TargetBranch] {
+			if _, err := m.Refresh(mr.Repo, mr.ID); err != nil {
+				log.Printf("Failed to refresh merge request %s!%d: %v", mr.Repo, mr.ID, err)
+			}
+		}
+	}
+	// 推送的是 fork，刷新从它发起的合并请求
+	for _, mr := range m.fromFork(p.Repo) {
+		if branches[mr.SourceBranch] {
+			if _, err := m.Refresh(mr.Repo, mr.ID); err != nil {
+				log.Printf("Failed to refresh merge request %s!%d: %v", mr.Repo, mr.ID, err)
+			}
+		}
+	}
+}
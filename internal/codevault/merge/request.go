@@ -0,0 +1,226 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const requestsFile = "merge_requests"
+
+// 合并请求的状态
+const (
+	StateOpen   = "open"
+	StateMerged = "merged"
+	StateClosed = "closed"
+)
+
+// 可合并性
+const (
+	MergeStatusUnknown   = "unknown"
+	MergeStatusMergeable = "mergeable"
+	MergeStatusConflict  = "conflict"
+)
+
+var (
+	// ErrNotFound 合并请求不存在
+	ErrNotFound = errors.New("merge request not found")
+	// ErrNotOpen 合并请求已经合并或关闭
+	ErrNotOpen = errors.New("merge request is not open")
+	// ErrMergeFailed 服务端合并失败，通常是有冲突或者目标分支在合并期间被更新
+	ErrMergeFailed = errors.New("merge failed")
+)
+
+// BlockedError 合并条件不满足，Reasons 列出所有没满足的条件
+type BlockedError struct {
+	Reasons []string
+}
+
+func (e *BlockedError) Error() string {
+	return "merge blocked: " + strings.Join(e.Reasons, "; ")
+}
+
+// Approval 一次批准，只对批准时的 head 有效，源分支有新推送后会被清掉
+type Approval struct {
+	User      string    `json:"user"`
+	SHA       string    `json:"sha"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MergeRequest 把源分支合并到目标分支的请求
+type MergeRequest struct {
+	ID           int        `json:"id"` // 仓库内递增的编号
+	Repo         string     `json:"repo"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	SourceRepo   string     `json:"source_repo,omitempty"` // 来自 fork 时是 fork 仓库，否则为空
+	SourceBranch string     `json:"source_branch"`
+	TargetBranch string     `json:"target_branch"`
+	HeadSHA      string     `json:"head_sha"` // 源分支最新提交
+	BaseSHA      string     `json:"base_sha"` // 上次计算可合并性时目标分支的提交
+	Author       string     `json:"author"`
+	State        string     `json:"state"`
+	MergeStatus  string     `json:"merge_status"`
+	Conflicts    []string   `json:"conflicts,omitempty"` // 冲突的文件
+	Approvals    []Approval `json:"approvals"`
+	Reviews      []Review   `json:"reviews"`
+	MergeCommit  string     `json:"merge_commit,omitempty"` // 合并后目标分支指向的提交
+	MergedBy     string     `json:"merged_by,omitempty"`
+	MergedAt     *time.Time `json:"merged_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// CreateOptions 创建合并请求的参数
+type CreateOptions struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	SourceRepo   string `json:"source_repo"` // 从 fork 发起时填 fork 仓库名
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+}
+
+// ApprovedBy 用户是否已经批准
+func (mr *MergeRequest) ApprovedBy(username string) bool {
+	for _, a := range mr.Approvals {
+		if a.User == username {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceLabel 源分支的显示名，来自 fork 时带上仓库名
+func (mr *MergeRequest) sourceLabel() string {
+	if mr.SourceRepo == "" {
+		return mr.SourceBranch
+	}
+	return strings.TrimSuffix(mr.SourceRepo, ".git") + ":" + mr.SourceBranch
+}
+
+// clone 深拷贝，返回给调用方
+func (mr *MergeRequest) clone() *MergeRequest {
+	cp := *mr
+	cp.Conflicts = append([]string(nil), mr.Conflicts...)
+	cp.Approvals = append([]Approval{}, mr.Approvals...)
+	cp.Reviews = append([]Review{}, mr.Reviews...)
+	return &cp
+}
+
+// key map 的键：repo#id
+func key(repo string, id int) string {
+	return fmt.Sprintf("%s#%d", utils.NormalizeRepoName(repo), id)
+}
+
+// Get 查询合并请求
+func (m *Manager) Get(repo string, id int) (*MergeRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mr, ok := m.requests[key(repo, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return mr.clone(), nil
+}
+
+// List 按编号倒序列出仓库的合并请求，state 为空或 all 时列出全部
+func (m *Manager) List(repo, state string) []*MergeRequest {
+	repo = utils.NormalizeRepoName(repo)
+	m.mu.Lock()
+	list := []*MergeRequest{}
+	for _, mr := range m.requests {
+		if mr.Repo == repo && (state == "" || state == "all" || mr.State == state) {
+			list = append(list, mr.clone())
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list
+}
+
+// update 在锁内修改合并请求并写回磁盘
+func (m *Manager) update(repo string, id int, fn func(mr *MergeRequest) error) (*MergeRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mr, ok := m.requests[key(repo, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := fn(mr); err != nil {
+		return nil, err
+	}
+	mr.UpdatedAt = time.Now()
+	return mr.clone(), m.saveLocked()
+}
+
+// RenameRepo 仓库改名时迁移它的合并请求和评论
+func (m *Manager) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, mr := range m.requests {
+		if mr.SourceRepo == oldName {
+			mr.SourceRepo = newName
+		}
+		if mr.Repo == oldName {
+			delete(m.requests, k)
+			mr.Repo = newName
+			m.requests[key(mr.Repo, mr.ID)] = mr
+		}
+	}
+	for k, c := range m.comments {
+		if c.Repo == oldName {
+			delete(m.comments, k)
+			c.Repo = newName
+			m.comments[commentKey(c.Repo, c.MergeID, c.ID)] = c
+		}
+	}
+	if err := m.saveCommentsLocked(); err != nil {
+		return err
+	}
+	return m.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的合并请求和评论
+func (m *Manager) DeleteRepo(repo string) error {
+	repo = utils.NormalizeRepoName(repo)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, mr := range m.requests {
+		if mr.Repo == repo {
+			delete(m.requests, k)
+		} else if mr.SourceRepo == repo && mr.State == StateOpen {
+			// fork 被删除了，从它发起的合并请求没法再合并
+			mr.State = StateClosed
+			mr.UpdatedAt = time.Now()
+		}
+	}
+	for k, c := range m.comments {
+		if c.Repo == repo {
+			delete(m.comments, k)
+		}
+	}
+	if err := m.saveCommentsLocked(); err != nil {
+		return err
+	}
+	return m.saveLocked()
+}
+
+// saveLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveLocked() error {
+	list := make([]*MergeRequest, 0, len(m.requests))
+	for _, mr := range m.requests {
+		list = append(list, mr)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Repo != list[j].Repo {
+			return list[i].Repo < list[j].Repo
+		}
+		return list[i].ID < list[j].ID
+	})
+	return m.store.Save(requestsFile, list)
+}
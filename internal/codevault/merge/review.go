@@ -0,0 +1,425 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const commentsFile = "merge_request_comments"
+
+// 评审结论
+const (
+	ReviewApproved         = "approved"
+	ReviewChangesRequested = "changes_requested"
+	ReviewCommented        = "commented"
+)
+
+// 行评论所在的一侧：new 是源分支的文件，old 是合并基点的文件
+const (
+	SideNew = "new"
+	SideOld = "old"
+)
+
+// ErrCommentNotFound 评论不存在
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Review 一次评审，Body 是总体意见，行评论单独存
+type Review struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	State     string    `json:"state"`
+	Body      string    `json:"body,omitempty"`
+	CommitSHA string    `json:"commit_sha"` // 评审时的 head
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Comment 合并请求上的评论，Path 为空时是普通讨论，否则锚定在某个提交的文件和行上
+// 回复通过 InReplyTo 指向线程的第一条评论，解决状态只记在第一条评论上
+type Comment struct {
+	ID        int    `json:"id"`
+	Repo      string `json:"repo"`
+	MergeID   int    `json:"merge_request_id"`
+	Author    string `json:"author"`
+	Body      string `json:"body"`
+	InReplyTo int    `json:"in_reply_to,omitempty"`
+	ReviewID  int    `json:"review_id,omitempty"` // 随评审一起提交的行评论
+
+	Path      string `json:"path,omitempty"`
+	Line      int    `json:"line,omitempty"`       // 评论时的行号
+	Side      string `json:"side,omitempty"`       // new 或 old
+	CommitSHA string `json:"commit_sha,omitempty"` // 评论时的提交
+	// CurrentLine 在最新 head 上对应的行号；这一行在之后的推送里被改动过时 Outdated 为 true
+	CurrentLine int  `json:"current_line,omitempty"`
+	Outdated    bool `json:"outdated"`
+
+	Resolved   bool      `json:"resolved,omitempty"`
+	ResolvedBy string    `json:"resolved_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Thread 一条评论和它的所有回复
+type Thread struct {
+	*Comment
+	Replies []*Comment `json:"replies"`
+}
+
+// CommentOptions 发表评论的参数
+type CommentOptions struct {
+	Body      string `json:"body"`
+	InReplyTo int    `json:"in_reply_to"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Side      string `json:"side"`
+	CommitSHA string `json:"commit_sha"` // 默认是当前 head（old 侧默认是合并基点）
+}
+
+// ReviewOptions 提交评审的参数，Comments 是随评审一起提交的行评论
+type ReviewOptions struct {
+	State    string           `json:"state"` // approve、request_changes、comment
+	Body     string           `json:"body"`
+	Comments []CommentOptions `json:"comments"`
+}
+
+// commentKey 评论 map 的键：repo#mr#comment
+func commentKey(repo string, mrID, id int) string {
+	return key(repo, mrID) + "#" + strconv.Itoa(id)
+}
+
+// Comments 按线程列出合并请求的评论
+func (m *Manager) Comments(repo string, id int) ([]*Thread, error) {
+	if _, err := m.Get(repo, id); err != nil {
+		return nil, err
+	}
+	prefix := key(repo, id) + "#"
+	m.mu.Lock()
+	var all []*Comment
+	for k, c := range m.comments {
+		if strings.HasPrefix(k, prefix) {
+			cp := *c
+			all = append(all, &cp)
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+
+	threads := []*Thread{}
+	byID := make(map[int]*Thread)
+	for _, c := range all {
+		if root, ok := byID[c.InReplyTo]; ok {
+			root.Replies = append(root.Replies, c)
+			continue
+		}
+		t := &Thread{Comment: c, Replies: []*Comment{}}
+		byID[c.ID] = t
+		threads = append(threads, t)
+	}
+	return threads, nil
+}
+
+// AddComment 发表评论或回复
+func (m *Manager) AddComment(repo string, id int, opts CommentOptions, author string) (*Comment, error) {
+	mr, err := m.Get(repo, id)
+	if err != nil {
+		return nil, err
+	}
+	c, err := m.newComment(mr, opts, author)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.insertCommentLocked(c)
+	cp := *c
+	return &cp, m.saveCommentsLocked()
+}
+
+// newComment 校验参数并生成评论，还没有分配 ID
+func (m *Manager) newComment(mr *MergeRequest, opts CommentOptions, author string) (*Comment, error) {
+	if strings.TrimSpace(opts.Body) == "" {
+		return nil, fmt.Errorf("comment body is required")
+	}
+	now := time.Now()
+	c := &Comment{Repo: mr.Repo, MergeID: mr.ID, Author: author, Body: opts.Body, CreatedAt: now, UpdatedAt: now}
+
+	// 1.回复沿用线程的位置
+	if opts.InReplyTo != 0 {
+		m.mu.Lock()
+		root, ok := m.comments[commentKey(mr.Repo, mr.ID, opts.InReplyTo)]
+		if ok && root.InReplyTo != 0 {
+			root, ok = m.comments[commentKey(mr.Repo, mr.ID, root.InReplyTo)]
+		}
+		m.mu.Unlock()
+		if !ok {
+			return nil, ErrCommentNotFound
+		}
+		c.InReplyTo = root.ID
+		return c, nil
+	}
+	if opts.Path == "" {
+		return c, nil
+	}
+
+	// 2.行评论：校验文件和行号确实存在
+	if opts.Side == "" {
+		opts.Side = SideNew
+	}
+	if opts.Side != SideNew && opts.Side != SideOld {
+		return nil, fmt.Errorf("side must be new or old")
+	}
+	if opts.CommitSHA == "" {
+		opts.CommitSHA = mr.HeadSHA
+		if opts.Side == SideOld {
+			opts.CommitSHA = m.git(mr.Repo).mergeBase(mr.BaseSHA, mr.HeadSHA)
+		}
+	}
+	g := m.git(mr.Repo)
+	lines, err := g.lineCount(opts.CommitSHA, opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Line < 1 || opts.Line > lines {
+		return nil, fmt.Errorf("line %d is outside %s (%d lines)", opts.Line, opts.Path, lines)
+	}
+	c.Path, c.Line, c.Side, c.CommitSHA = opts.Path, opts.Line, opts.Side, opts.CommitSHA
+	c.CurrentLine = c.Line
+	if c.Side == SideNew && c.CommitSHA != mr.HeadSHA {
+		c.CurrentLine, c.Outdated = g.trackLine(c.CommitSHA, mr.HeadSHA, c.Path, c.Line)
+	}
+	return c, nil
+}
+
+// insertCommentLocked 分配 ID 并保存，调用方必须持有 m.mu
+func (m *Manager) insertCommentLocked(c *Comment) {
+	prefix := key(c.Repo, c.MergeID) + "#"
+	c.ID = 1
+	for k, existing := range m.comments {
+		if strings.HasPrefix(k, prefix) {
+			c.ID = max(c.ID, existing.ID+1)
+		}
+	}
+	m.comments[commentKey(c.Repo, c.MergeID, c.ID)] = c
+}
+
+// EditComment 修改评论内容，只有作者可以修改
+func (m *Manager) EditComment(repo string, id, commentID int, body, username string) (*Comment, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("comment body is required")
+	}
+	return m.updateComment(repo, id, commentID, func(c *Comment) error {
+		if c.Author != username {
+			return fmt.Errorf("only the author can edit a comment")
+		}
+		c.Body = body
+		return nil
+	})
+}
+
+// DeleteComment 删除评论，删除线程的第一条评论会连回复一起删掉
+func (m *Manager) DeleteComment(repo string, id, commentID int, username string, isAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.comments[commentKey(repo, id, commentID)]
+	if !ok {
+		return ErrCommentNotFound
+	}
+	if c.Author != username && !isAdmin {
+		return fmt.Errorf("only the author can delete a comment")
+	}
+	delete(m.comments, commentKey(repo, id, commentID))
+	if c.InReplyTo == 0 {
+		for k, reply := range m.comments {
+			if reply.Repo == c.Repo && reply.MergeID == c.MergeID && reply.InReplyTo == c.ID {
+				delete(m.comments, k)
+			}
+		}
+	}
+	return m.saveCommentsLocked()
+}
+
+// ResolveThread 解决 / 重新打开线程，commentID 可以是线程里的任意一条评论
+func (m *Manager) ResolveThread(repo string, id, commentID int, resolved bool, username string) (*Comment, error) {
+	m.mu.Lock()
+	c, ok := m.comments[commentKey(repo, id, commentID)]
+	if ok && c.InReplyTo != 0 {
+		commentID = c.InReplyTo
+	}
+	m.mu.Unlock()
+	return m.updateComment(repo, id, commentID, func(c *Comment) error {
+		c.Resolved = resolved
+		c.ResolvedBy = ""
+		if resolved {
+			c.ResolvedBy = username
+		}
+		return nil
+	})
+}
+
+// updateComment 在锁内修改评论并写回磁盘
+func (m *Manager) updateComment(repo string, id, commentID int, fn func(c *Comment) error) (*Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.comments[commentKey(repo, id, commentID)]
+	if !ok {
+		return nil, ErrCommentNotFound
+	}
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	c.UpdatedAt = time.Now()
+	cp := *c
+	return &cp, m.saveCommentsLocked()
+}
+
+// SubmitReview 提交评审：总体结论加上一组行评论
+// approve 会记录一次批准；request_changes 会阻止合并，直到同一个人再次批准
+func (m *Manager) SubmitReview(repo string, id int, opts ReviewOptions, username string) (*Review, error) {
+	mr, err := m.Get(repo, id)
+	if err != nil {
+		return nil, err
+	}
+	if mr.State != StateOpen {
+		return nil, ErrNotOpen
+	}
+	var state string
+	switch opts.State {
+	case "approve", ReviewApproved:
+		state = ReviewApproved
+	case "request_changes", ReviewChangesRequested:
+		state = ReviewChangesRequested
+	case "comment", ReviewCommented, "":
+		state = ReviewCommented
+	default:
+		return nil, fmt.Errorf("state must be approve, request_changes or comment")
+	}
+	if state != ReviewCommented && mr.Author == username {
+		return nil, fmt.Errorf("authors cannot approve or request changes on their own merge request")
+	}
+	if state != ReviewApproved && strings.TrimSpace(opts.Body) == "" && len(opts.Comments) == 0 {
+		return nil, fmt.Errorf("review body or comments are required")
+	}
+
+	// 1.先校验所有行评论，有一条不合法就整个评审失败
+	var comments []*Comment
+	for _, co := range opts.Comments {
+		co.InReplyTo = 0
+		c, err := m.newComment(mr, co, username)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	// 2.评审、批准和行评论一起保存
+	var review Review
+	_, err = m.update(repo, id, func(mr *MergeRequest) error {
+		if mr.State != StateOpen {
+			return ErrNotOpen
+		}
+		review = Review{ID: len(mr.Reviews) + 1, Author: username, State: state, Body: opts.Body, CommitSHA: mr.HeadSHA, CreatedAt: time.Now()}
+		mr.Reviews = append(mr.Reviews, review)
+		if state == ReviewApproved && !mr.ApprovedBy(username) {
+			mr.Approvals = append(mr.Approvals, Approval{User: username, SHA: mr.HeadSHA, CreatedAt: review.CreatedAt})
+		}
+		if state == ReviewChangesRequested {
+			mr.Approvals = removeApproval(mr.Approvals, username)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range comments {
+		c.ReviewID = review.ID
+		m.insertCommentLocked(c)
+	}
+	return &review, m.saveCommentsLocked()
+}
+
+// changesRequested 每个人最近一次非 comment 的评审是 request_changes 的人
+func changesRequested(mr *MergeRequest) []string {
+	latest := make(map[string]string)
+	for _, r := range mr.Reviews {
+		if r.State != ReviewCommented {
+			latest[r.Author] = r.State
+		}
+	}
+	var users []string
+	for user, state := range latest {
+		if state == ReviewChangesRequested {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// removeApproval 去掉某个人的批准
+func removeApproval(approvals []Approval, username string) []Approval {
+	list := []Approval{}
+	for _, a := range approvals {
+		if a.User != username {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// reanchorComments head 变化后重新计算 new 侧行评论在新 head 上的位置
+func (m *Manager) reanchorComments(repo string, id int, head string) {
+	prefix := key(repo, id) + "#"
+	m.mu.Lock()
+	var anchored []Comment
+	for k, c := range m.comments {
+		if strings.HasPrefix(k, prefix) && c.Path != "" && c.Side == SideNew {
+			anchored = append(anchored, *c)
+		}
+	}
+	m.mu.Unlock()
+	if len(anchored) == 0 {
+		return
+	}
+
+	g := m.git(repo)
+	for i := range anchored {
+		c := &anchored[i]
+		c.CurrentLine, c.Outdated = g.trackLine(c.CommitSHA, head, c.Path, c.Line)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range anchored {
+		if cur, ok := m.comments[commentKey(repo, id, c.ID)]; ok {
+			cur.CurrentLine, cur.Outdated = c.CurrentLine, c.Outdated
+		}
+	}
+	if err := m.saveCommentsLocked(); err != nil {
+		log.Printf("Failed to save review comments: %v", err)
+	}
+}
+
+// saveCommentsLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveCommentsLocked() error {
+	list := make([]*Comment, 0, len(m.comments))
+	for _, c := range m.comments {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Repo != list[j].Repo {
+			return list[i].Repo < list[j].Repo
+		}
+		if list[i].MergeID != list[j].MergeID {
+			return list[i].MergeID < list[j].MergeID
+		}
+		return list[i].ID < list[j].ID
+	})
+	return m.store.Save(commentsFile, list)
+}
@@ -0,0 +1,116 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 镜像的管理接口，镜像会覆盖本地或远端的引用，需要仓库管理员权限
+type API struct {
+	manager *Manager
+	policy  *access.Policy
+}
+
+// NewAPI 创建管理接口
+func NewAPI(manager *Manager, policy *access.Policy) *API {
+	return &API{manager: manager, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/mirrors", a.handleList)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/mirrors", a.handleCreate)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/mirrors/{id}", a.handleGet)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/mirrors/{id}", a.handleDelete)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/mirrors/{id}/sync", a.handleSync)
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.manager.List(name))
+}
+
+func (a *API) handleCreate(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	var opts CreateOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	mr, err := a.manager.Create(name, opts, auth.UserFromContext(r.Context()).Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, mr)
+}
+
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	mr, err := a.manager.Get(name, r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, mr)
+}
+
+func (a *API) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	if err := a.manager.Delete(name, r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handleSync 立即同步，等同步结束后返回结果；同步失败时返回 502，响应体里有 last_error
+func (a *API) handleSync(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	mr, err := a.manager.Get(name, r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := a.manager.Sync(mr.ID)
+	switch {
+	case err == nil:
+		utils.WriteJSON(w, 200, result)
+	case result != nil:
+		utils.WriteJSON(w, 502, result)
+	default:
+		writeError(w, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, repo.ErrNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrPullExists), errors.Is(err, ErrBusy):
+		utils.WriteError(w, 409, err.Error())
+	default:
+		utils.WriteError(w, 400, err.Error())
+	}
+}
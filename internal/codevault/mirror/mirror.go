@@ -0,0 +1,414 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/hooks"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/secrets"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	mirrorsFile = "mirrors"
+
+	// DefaultInterval 默认每小时同步一次
+	DefaultInterval = 60
+	// Pusher 从上游拉到的更新在 Webhook 里的推送人
+	Pusher = "mirror"
+)
+
+// 镜像方向
+const (
+	DirectionPull = "pull" // 从上游拉取到本仓库
+	DirectionPush = "push" // 把本仓库推送到远端
+)
+
+// 同步状态
+const (
+	StatusPending = "pending" // 还没同步过
+	StatusSyncing = "syncing"
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+)
+
+var (
+	// ErrNotFound 镜像不存在
+	ErrNotFound = errors.New("mirror not found")
+	// ErrPullExists 一个仓库只能有一个拉取镜像，两个上游会互相覆盖
+	ErrPullExists = errors.New("repository already has a pull mirror")
+	// ErrBusy 镜像正在同步，当前这次结束后会再同步一次
+	ErrBusy = errors.New("mirror is already syncing")
+)
+
+// Mirror 仓库的一个镜像配置和它最近一次同步的结果
+type Mirror struct {
+	ID               string     `json:"id"`
+	Repo             string     `json:"repo"`
+	Direction        string     `json:"direction"`
+	URL              string     `json:"url"`
+	CredentialSecret string     `json:"credential_secret,omitempty"` // 仓库密钥名，值是 user:token 或 SSH 私钥
+	IntervalMinutes  int        `json:"interval_minutes"`
+	Status           string     `json:"status"`
+	LastSyncAt       *time.Time `json:"last_sync_at,omitempty"`
+	LastSuccessAt    *time.Time `json:"last_success_at,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+	CreatedBy        string     `json:"created_by,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// CreateOptions 新建镜像的参数
+type CreateOptions struct {
+	Direction        string `json:"direction"`
+	URL              string `json:"url"`
+	CredentialSecret string `json:"credential_secret"`
+	IntervalMinutes  int    `json:"interval_minutes"`
+}
+
+// Manager 管理仓库镜像：定时 / 手动拉取上游，推送后同步到远端
+type Manager struct {
+	store    *store.Store
+	repos    *repo.Manager
+	secrets  *secrets.Store
+	webhooks *webhook.Dispatcher
+	hooks    *hooks.Manager
+
+	mu      sync.Mutex
+	mirrors map[string]*Mirror
+	running map[string]bool // 正在同步的镜像
+	pending map[string]bool // 同步过程中又来了新推送，结束后再同步一次
+}
+
+// NewManager 创建镜像管理器并从 store 中加载配置
+// 拉取到的更新会和推送一样触发 Webhook 和 post-receive 钩子
+func NewManager(st *store.Store, repos *repo.Manager, sec *secrets.Store, webhooks *webhook.Dispatcher, receiveHooks *hooks.Manager) (*Manager, error) {
+	m := &Manager{
+		store:    st,
+		repos:    repos,
+		secrets:  sec,
+		webhooks: webhooks,
+		hooks:    receiveHooks,
+		mirrors:  make(map[string]*Mirror),
+		running:  make(map[string]bool),
+		pending:  make(map[string]bool),
+	}
+	var saved []*Mirror
+	if err := st.Load(mirrorsFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, mr := range saved {
+		// 上次进程退出时还在同步的，重新来过
+		if mr.Status == StatusSyncing {
+			mr.Status = StatusPending
+		}
+		m.mirrors[mr.ID] = mr
+	}
+	return m, nil
+}
+
+// ValidateURL 只允许网络协议，本地路径、file:// 和 ext:: 会让服务器读写任意目录或执行命令
+// 密码不能写在地址里，要放到仓库密钥中
+func ValidateURL(raw string) error {
+	if raw == "" || strings.HasPrefix(raw, "-") || strings.Contains(raw, "::") {
+		return fmt.Errorf("invalid mirror URL: %q", raw)
+	}
+	if !strings.Contains(raw, "://") {
+		// scp 风格：git@github.com:org/repo.git
+		host, _, ok := strings.Cut(raw, ":")
+		if !ok || host == "" || strings.ContainsAny(host, "/\\") {
+			return fmt.Errorf("mirror URL must be http(s)://, ssh://, git:// or user@host:path")
+		}
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid mirror URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "ssh", "git":
+	default:
+		return fmt.Errorf("unsupported mirror URL scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("mirror URL has no host")
+	}
+	if _, ok := u.User.Password(); ok {
+		return fmt.Errorf("do not put passwords in the mirror URL, use credential_secret instead")
+	}
+	return nil
+}
+
+// Create 为仓库新建镜像
+func (m *Manager) Create(repoName string, opts CreateOptions, creator string) (*Mirror, error) {
+	repoName = utils.NormalizeRepoName(repoName)
+	if !m.repos.Exists(repoName) {
+		return nil, repo.ErrNotFound
+	}
+	if opts.Direction != DirectionPull && opts.Direction != DirectionPush {
+		return nil, fmt.Errorf("direction must be pull or push")
+	}
+	if err := ValidateURL(opts.URL); err != nil {
+		return nil, err
+	}
+	if opts.CredentialSecret != "" {
+		if _, err := m.secrets.Get(repoName, opts.CredentialSecret); err != nil {
+			return nil, fmt.Errorf("credential secret %s: %v", opts.CredentialSecret, err)
+		}
+	}
+	if opts.IntervalMinutes == 0 {
+		opts.IntervalMinutes = DefaultInterval
+	}
+	if opts.IntervalMinutes < 1 {
+		return nil, fmt.Errorf("interval_minutes must be at least 1")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if opts.Direction == DirectionPull {
+		for _, mr := range m.mirrors {
+			if mr.Repo == repoName && mr.Direction == DirectionPull {
+				return nil, ErrPullExists
+			}
+		}
+	}
+	mr := &Mirror{
+		ID:               utils.RandomID(6),
+		Repo:             repoName,
+		Direction:        opts.Direction,
+		URL:              opts.URL,
+		CredentialSecret: opts.CredentialSecret,
+		IntervalMinutes:  opts.IntervalMinutes,
+		Status:           StatusPending,
+		CreatedBy:        creator,
+		CreatedAt:        time.Now(),
+	}
+	m.mirrors[mr.ID] = mr
+	if err := m.saveLocked(); err != nil {
+		return nil, err
+	}
+	cp := *mr
+	return &cp, nil
+}
+
+// Get 查询仓库的一个镜像
+func (m *Manager) Get(repoName, id string) (*Mirror, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mr, ok := m.mirrors[id]
+	if !ok || mr.Repo != utils.NormalizeRepoName(repoName) {
+		return nil, ErrNotFound
+	}
+	cp := *mr
+	return &cp, nil
+}
+
+// List 列出仓库的镜像
+func (m *Manager) List(repoName string) []*Mirror {
+	repoName = utils.NormalizeRepoName(repoName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []*Mirror{}
+	for _, mr := range m.mirrors {
+		if mr.Repo == repoName {
+			cp := *mr
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete 删除镜像，正在进行的同步不受影响
+func (m *Manager) Delete(repoName, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mr, ok := m.mirrors[id]
+	if !ok || mr.Repo != utils.NormalizeRepoName(repoName) {
+		return ErrNotFound
+	}
+	delete(m.mirrors, id)
+	return m.saveLocked()
+}
+
+// Name 作为 post-receive 插件的名字
+func (m *Manager) Name() string { return "mirror" }
+
+// PostReceive 推送成功后，在后台把仓库同步到所有推送镜像
+func (m *Manager) PostReceive(p *hooks.Push) {
+	for _, mr := range m.List(p.Repo) {
+		if mr.Direction == DirectionPush {
+			go m.trigger(mr.ID)
+		}
+	}
+}
+
+// Run 定时同步到期的镜像，失败的镜像也按同样的间隔重试
+// 推送镜像也会定时同步，服务端合并等不经过 receive-pack 的更新由它兜底
+func (m *Manager) Run(tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		for _, id := range m.due(time.Now()) {
+			go m.trigger(id)
+		}
+		<-ticker.C
+	}
+}
+
+// due 到了同步时间的镜像
+func (m *Manager) due(now time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for _, mr := range m.mirrors {
+		if m.running[mr.ID] {
+			continue
+		}
+		interval := time.Duration(mr.IntervalMinutes) * time.Minute
+		if mr.LastSyncAt == nil || now.Sub(*mr.LastSyncAt) >= interval {
+			ids = append(ids, mr.ID)
+		}
+	}
+	return ids
+}
+
+// trigger 后台同步，同一个镜像同时只跑一个同步，期间再触发的合并成结束后的一次
+func (m *Manager) trigger(id string) {
+	if _, err := m.Sync(id); err != nil && !errors.Is(err, ErrBusy) {
+		log.Printf("❌ Mirror %s sync failed: %v", id, err)
+	}
+}
+
+// Sync 立即同步一个镜像并返回同步后的状态
+// 已经在同步时标记为待同步，等当前这次结束后再跑一次，返回 ErrBusy
+func (m *Manager) Sync(id string) (*Mirror, error) {
+	m.mu.Lock()
+	if _, ok := m.mirrors[id]; !ok {
+		m.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	if m.running[id] {
+		m.pending[id] = true
+		m.mu.Unlock()
+		return nil, ErrBusy
+	}
+	m.running[id] = true
+	m.mu.Unlock()
+
+	var result *Mirror
+	var err error
+	for {
+		result, err = m.syncOnce(id)
+		m.mu.Lock()
+		again := m.pending[id]
+		delete(m.pending, id)
+		if !again {
+			delete(m.running, id)
+			m.mu.Unlock()
+			break
+		}
+		m.mu.Unlock()
+	}
+	return result, err
+}
+
+// syncOnce 执行一次同步并记录结果
+func (m *Manager) syncOnce(id string) (*Mirror, error) {
+	m.mu.Lock()
+	mr, ok := m.mirrors[id]
+	if !ok {
+		m.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	mr.Status = StatusSyncing
+	cfg := *mr
+	m.mu.Unlock()
+
+	var err error
+	switch {
+	case !m.repos.Exists(cfg.Repo):
+		err = repo.ErrNotFound
+	case cfg.Direction == DirectionPull && m.repos.IsArchived(cfg.Repo):
+		// 归档的仓库只读，停止从上游拉取
+		err = repo.ErrArchived
+	case cfg.Direction == DirectionPull:
+		err = m.pull(&cfg)
+	default:
+		err = m.push(&cfg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mr, ok = m.mirrors[id]
+	if !ok {
+		// 同步期间被删除了
+		return &cfg, err
+	}
+	now := time.Now()
+	mr.LastSyncAt = &now
+	if err != nil {
+		mr.Status = StatusFailed
+		mr.LastError = err.Error()
+		log.Printf("⚠️ Mirror %s %s %s failed: %v", mr.Repo, mr.Direction, mr.URL, err)
+	} else {
+		mr.Status = StatusOK
+		mr.LastError = ""
+		mr.LastSuccessAt = &now
+	}
+	if saveErr := m.saveLocked(); saveErr != nil {
+		log.Printf("❌ Failed to save mirrors: %v", saveErr)
+	}
+	cp := *mr
+	return &cp, err
+}
+
+// RenameRepo 仓库改名时迁移它的镜像
+func (m *Manager) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mr := range m.mirrors {
+		if mr.Repo == oldName {
+			mr.Repo = newName
+		}
+	}
+	return m.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时删除它的镜像
+func (m *Manager) DeleteRepo(repoName string) error {
+	repoName = utils.NormalizeRepoName(repoName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, mr := range m.mirrors {
+		if mr.Repo == repoName {
+			delete(m.mirrors, id)
+		}
+	}
+	return m.saveLocked()
+}
+
+// knownHostsPath SSH 镜像的 known_hosts，第一次连接时记录主机密钥，之后变了就拒绝
+func (m *Manager) knownHostsPath() string {
+	return filepath.Join(m.store.Dir(), "mirror_known_hosts")
+}
+
+// saveLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveLocked() error {
+	list := make([]*Mirror, 0, len(m.mirrors))
+	for _, mr := range m.mirrors {
+		list = append(list, mr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return m.store.Save(mirrorsFile, list)
+}
@@ -0,0 +1,212 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/hooks"
+	"github.com/chanslights/DevNexus/pkg/types"
+)
+
+const (
+	syncTimeout = 30 * time.Minute
+	maxErrorLen = 2000 // 最多记录多少字节的错误输出
+)
+
+// 镜像同步所有分支和标签，上游删掉的引用本地也删掉
+var refspecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+// pull 从上游拉取，把变化的引用作为推送事件发出去
+func (m *Manager) pull(mr *Mirror) error {
+	repoPath, err := filepath.Abs(m.repos.Path(mr.Repo))
+	if err != nil {
+		return err
+	}
+	// 拿仓库的写锁：拉取前后的引用对比期间不能有推送落进来，否则会被当成镜像更新再触发一次事件
+	lock := m.repos.RepoLock(mr.Repo)
+	lock.Lock()
+	before, err := listRefs(repoPath)
+	if err != nil {
+		lock.Unlock()
+		return err
+	}
+	args := append([]string{"fetch", "--prune", "--quiet", "--", mr.URL}, refspecs...)
+	err = m.git(mr, repoPath, args...)
+	if err != nil {
+		lock.Unlock()
+		return err
+	}
+	after, err := listRefs(repoPath)
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	updates := diffRefs(before, after)
+	if len(updates) == 0 {
+		return nil
+	}
+	log.Printf("🪞 Mirror pulled %d ref updates into %s from %s", len(updates), mr.Repo, mr.URL)
+	m.repos.TouchPush(mr.Repo)
+	if m.webhooks != nil {
+		for _, u := range updates {
+			m.webhooks.PublishRefUpdate(mr.Repo, u, Pusher)
+		}
+	}
+	// 和推送一样触发 post-receive：刷新合并请求、同步推送镜像等
+	if m.hooks != nil {
+		go m.hooks.PostReceive(&hooks.Push{
+			Repo:     mr.Repo,
+			RepoPath: repoPath,
+			Pusher:   Pusher,
+			Updates:  updates,
+			Env:      append(os.Environ(), "GIT_DIR="+repoPath),
+		})
+	}
+	return nil
+}
+
+// push 把本仓库的分支和标签强制推送到远端，远端多出来的引用会被删掉
+func (m *Manager) push(mr *Mirror) error {
+	repoPath, err := filepath.Abs(m.repos.Path(mr.Repo))
+	if err != nil {
+		return err
+	}
+	args := append([]string{"push", "--prune", "--quiet", "--", mr.URL}, refspecs...)
+	if err := m.git(mr, repoPath, args...); err != nil {
+		return err
+	}
+	log.Printf("🪞 Mirror pushed %s to %s", mr.Repo, mr.URL)
+	return nil
+}
+
+// git 带着镜像的凭证执行 git 命令
+// 凭证只通过环境变量和临时文件传给 git，不会出现在命令行参数、地址和仓库配置里
+func (m *Manager) git(mr *Mirror, repoPath string, args ...string) error {
+	env := append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		// 即使地址校验漏了什么，也不允许 file / ext 这类本地协议
+		"GIT_ALLOW_PROTOCOL=http:https:ssh:git",
+	)
+	sshCommand := []string{"ssh", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=" + m.knownHostsPath()}
+
+	if mr.CredentialSecret != "" {
+		secret, err := m.secrets.Get(mr.Repo, mr.CredentialSecret)
+		if err != nil {
+			return fmt.Errorf("credential secret %s: %v", mr.CredentialSecret, err)
+		}
+		if isHTTP(mr.URL) {
+			env = append(env,
+				"GIT_CONFIG_COUNT=1",
+				"GIT_CONFIG_KEY_0=http.extraHeader",
+				"GIT_CONFIG_VALUE_0=Authorization: Basic "+basicAuth(mr.URL, secret),
+			)
+		} else {
+			// SSH 私钥写到只有自己能读的临时文件里，用完就删
+			keyFile, err := os.CreateTemp("", "codevault-mirror-key-*")
+			if err != nil {
+				return err
+			}
+			defer os.Remove(keyFile.Name())
+			_, err = keyFile.WriteString(strings.TrimSpace(secret) + "\n")
+			keyFile.Close()
+			if err != nil {
+				return err
+			}
+			sshCommand = append(sshCommand, "-o", "IdentitiesOnly=yes", "-i", keyFile.Name())
+		}
+	}
+	env = append(env, "GIT_SSH_COMMAND="+shellJoin(sshCommand))
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoPath
+	cmd.Env = env
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(syncTimeout, func() { cmd.Process.Kill() })
+	defer timer.Stop()
+	if err := cmd.Wait(); err != nil {
+		msg := strings.TrimSpace(output.String())
+		if len(msg) > maxErrorLen {
+			msg = msg[len(msg)-maxErrorLen:]
+		}
+		return fmt.Errorf("git %s failed: %v, output: %s", args[0], err, msg)
+	}
+	return nil
+}
+
+// listRefs 当前所有分支和标签
+func listRefs(repoPath string) (map[string]string, error) {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %v", err)
+	}
+	refs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if sha, ref, ok := strings.Cut(line, " "); ok {
+			refs[ref] = sha
+		}
+	}
+	return refs, nil
+}
+
+// diffRefs 对比拉取前后的引用，得到和推送一样的引用更新列表
+func diffRefs(before, after map[string]string) []types.RefUpdate {
+	var updates []types.RefUpdate
+	for ref, sha := range after {
+		old, ok := before[ref]
+		if !ok {
+			old = types.ZeroSHA
+		}
+		if old != sha {
+			updates = append(updates, types.RefUpdate{OldSHA: old, NewSHA: sha, Ref: ref})
+		}
+	}
+	for ref, sha := range before {
+		if _, ok := after[ref]; !ok {
+			updates = append(updates, types.RefUpdate{OldSHA: sha, NewSHA: types.ZeroSHA, Ref: ref})
+		}
+	}
+	return updates
+}
+
+func isHTTP(raw string) bool {
+	return strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://")
+}
+
+// basicAuth 密钥是 user:password；只有令牌时，用户名取地址里的，没有就用 git
+func basicAuth(rawURL, secret string) string {
+	secret = strings.TrimSpace(secret)
+	if !strings.Contains(secret, ":") {
+		user := "git"
+		if u, err := url.Parse(rawURL); err == nil && u.User != nil && u.User.Username() != "" {
+			user = u.User.Username()
+		}
+		secret = user + ":" + secret
+	}
+	return base64.StdEncoding.EncodeToString([]byte(secret))
+}
+
+// shellJoin GIT_SSH_COMMAND 由 shell 解释，参数要加单引号
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
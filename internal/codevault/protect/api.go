@@ -0,0 +1,91 @@
+package protect
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 分支保护规则的管理接口，需要仓库管理员权限
+type API struct {
+	rules  *Rules
+	policy *access.Policy
+}
+
+// NewAPI 创建管理接口
+func NewAPI(rules *Rules, policy *access.Policy) *API {
+	return &API{rules: rules, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/protections", a.handleList)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/protections", a.handleSave)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/protections/{id}", a.handleGet)
+	mux.HandleFunc("PUT /api/repos/{owner}/{repo}/protections/{id}", a.handleSave)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/protections/{id}", a.handleDelete)
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.rules.List(repo))
+}
+
+// handleSave POST 新建规则，PUT 整体替换已有规则
+func (a *API) handleSave(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	var req Rule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	req.Repo = repo
+	req.ID = r.PathValue("id")
+	rule, err := a.rules.Save(req)
+	if errors.Is(err, ErrRuleNotFound) {
+		utils.WriteError(w, 404, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	code := 200
+	if r.Method == http.MethodPost {
+		code = 201
+	}
+	utils.WriteJSON(w, code, rule)
+}
+
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	rule, ok := a.rules.Get(repo, r.PathValue("id"))
+	if !ok {
+		utils.WriteError(w, 404, ErrRuleNotFound.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, rule)
+}
+
+func (a *API) handleDelete(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	if err := a.rules.Delete(repo, r.PathValue("id")); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
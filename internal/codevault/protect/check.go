@@ -0,0 +1,155 @@
+package protect
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+	"github.com/chanslights/DevNexus/internal/codevault/status"
+	"github.com/chanslights/DevNexus/pkg/types"
+)
+
+// Push 一次推送中需要检查的信息
+type Push struct {
+	Repo    string
+	User    *auth.User
+	Updates []types.RefUpdate
+	// IsAncestor 判断 old 是否是 new 的祖先，由调用方在隔离区（已收到但还未入库的对象）中计算
+	IsAncestor func(old, new string) bool
+	// NewCommits 验证从 new 可达、从 exclude 里的提交都不可达的提交的签名，返回 sha -> 结果，同样在隔离区中计算
+	NewCommits func(new string, exclude []string) (map[string]*signing.Verification, error)
+	// Refs 仓库现有的分支和标签 -> 指向的对象
+	Refs func() (map[string]string, error)
+}
+
+// Checker 在 receive-pack 更新引用之前执行分支保护规则
+type Checker struct {
+	rules    *Rules
+	statuses *status.Store
+	policy   *access.Policy
+}
+
+// NewChecker 创建检查器
+func NewChecker(rules *Rules, statuses *status.Store, policy *access.Policy) *Checker {
+	return &Checker{rules: rules, statuses: statuses, policy: policy}
+}
+
+// Check 逐条检查引用更新，返回被拒绝的引用及原因（ref -> 原因）
+func (c *Checker) Check(p Push) map[string]string {
+	rejected := make(map[string]string)
+	for _, u := range p.Updates {
+		if !u.IsBranch() {
+			continue
+		}
+		for _, rule := range c.rules.Matching(p.Repo, u.ShortName()) {
+			if c.bypass(rule, p.User) {
+				continue
+			}
+			if reason := c.violation(rule, p, u); reason != "" {
+				rejected[u.Ref] = reason
+				break
+			}
+		}
+	}
+	return rejected
+}
+
+// Restricted 服务端合并等不经过 receive-pack 的更新也要遵守 RestrictPushes：
+// 只有站点管理员和 bypass 名单里的用户可以更新这个分支，返回空字符串表示允许
+func (c *Checker) Restricted(repo, branch string, user *auth.User) string {
+	for _, rule := range c.rules.Matching(repo, branch) {
+		if rule.RestrictPushes && !c.bypass(rule, user) {
+			return fmt.Sprintf("protected branch: only allowed users can update %s", branch)
+		}
+	}
+	return ""
+}
+
+// violation 检查单条规则，返回空字符串表示通过
+func (c *Checker) violation(rule *Rule, p Push, u types.RefUpdate) string {
+	switch {
+	case u.IsDelete():
+		if !rule.AllowDeletions {
+			return "protected branch: deletion is not allowed"
+		}
+		return ""
+	case rule.RestrictPushes:
+		return "protected branch: direct pushes are restricted"
+	case !u.IsCreate() && !rule.AllowForcePushes && !p.IsAncestor(u.OldSHA, u.NewSHA):
+		return "protected branch: non-fast-forward updates are not allowed"
+	}
+	if rule.RequireSignedCommits {
+		if reason := unsignedCommit(p, u); reason != "" {
+			return reason
+		}
+	}
+	for _, ctx := range rule.RequiredStatusChecks {
+		cs, ok := c.statuses.Get(p.Repo, u.NewSHA, ctx)
+		if !ok {
+			return fmt.Sprintf("protected branch: required status %q is missing for %.7s", ctx, u.NewSHA)
+		}
+		if cs.State != status.Success {
+			return fmt.Sprintf("protected branch: required status %q is %s for %.7s", ctx, cs.State, u.NewSHA)
+		}
+	}
+	return ""
+}
+
+// unsignedCommit 找出第一个没有有效签名的新提交，按 sha 排序，同一次推送的提示是稳定的
+// 新提交按这个分支自己算：更新时是旧值之后的提交，即使它们已经在别的分支上；
+// 新建时是仓库里任何分支、标签都还没有的提交，从已有的历史（比如签名要求之前的提交）开新分支不受影响
+func unsignedCommit(p Push, u types.RefUpdate) string {
+	var exclude []string
+	if u.IsCreate() {
+		refs, err := p.Refs()
+		if err != nil {
+			return "protected branch: failed to verify commit signatures"
+		}
+		for ref, sha := range refs {
+			if ref != u.Ref {
+				exclude = append(exclude, sha)
+			}
+		}
+		sort.Strings(exclude)
+	} else {
+		exclude = []string{u.OldSHA}
+	}
+	results, err := p.NewCommits(u.NewSHA, exclude)
+	if err != nil {
+		return "protected branch: failed to verify commit signatures"
+	}
+	shas := make([]string, 0, len(results))
+	for sha := range results {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	for _, sha := range shas {
+		if v := results[sha]; !v.Verified {
+			return fmt.Sprintf("protected branch: commit %.7s is not signed by a known user (%s)", sha, v.Reason)
+		}
+	}
+	return ""
+}
+
+// bypass 站点管理员以及规则里列出的用户 / 团队不受限制
+func (c *Checker) bypass(rule *Rule, user *auth.User) bool {
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin {
+		return true
+	}
+	for _, name := range rule.BypassUsers {
+		if name == user.Username {
+			return true
+		}
+	}
+	for _, team := range rule.BypassTeams {
+		if c.policy.IsMember(team, user.Username) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package protect
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/signing"
+	"github.com/chanslights/DevNexus/internal/codevault/status"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/types"
+)
+
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// testChecker release/* 要求签名提交，main 不受保护
+func testChecker(t *testing.T) *Checker {
+	t.Helper()
+	st, err := store.New(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := NewRules(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rules.Save(Rule{Repo: "alice/demo.git", Pattern: "release/*", RequireSignedCommits: true}); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := status.NewStore(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := access.NewPolicy(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewChecker(rules, statuses, policy)
+}
+
+// linearPush 模拟一条线性历史 history（从旧到新），signed 里的提交有有效签名
+func linearPush(updates []types.RefUpdate, refs map[string]string, history []string, signed ...string) Push {
+	return Push{
+		Repo:       "alice/demo.git",
+		User:       &auth.User{Username: "alice"},
+		Updates:    updates,
+		IsAncestor: func(old, new string) bool { return slices.Index(history, old) <= slices.Index(history, new) },
+		NewCommits: func(new string, exclude []string) (map[string]*signing.Verification, error) {
+			// rev-list new --not exclude...：new 及之前的提交，去掉 exclude 里任意一个可达的
+			from := 0
+			for _, sha := range exclude {
+				from = max(from, slices.Index(history, sha)+1)
+			}
+			to := slices.Index(history, new) + 1
+			results := make(map[string]*signing.Verification)
+			for _, sha := range history[min(from, to):to] {
+				results[sha] = &signing.Verification{Verified: slices.Contains(signed, sha), Reason: "no signature"}
+			}
+			return results, nil
+		},
+		Refs: func() (map[string]string, error) { return refs, nil },
+	}
+}
+
+func TestCreateProtectedBranchFromUnsignedHistory(t *testing.T) {
+	c := testChecker(t)
+	// main 上是要求签名之前的旧提交，都没有签名
+	history := []string{"c1", "c2", "c3"}
+	refs := map[string]string{"refs/heads/main": "c3", "refs/tags/v1.0": "c2"}
+
+	create := []types.RefUpdate{{Ref: "refs/heads/release/1.0", OldSHA: zeroSHA, NewSHA: "c3"}}
+	if rejected := c.Check(linearPush(create, refs, history)); len(rejected) > 0 {
+		t.Errorf("creating a protected branch from existing history should be allowed: %v", rejected)
+	}
+	// 从标签开分支也一样
+	create = []types.RefUpdate{{Ref: "refs/heads/release/0.9", OldSHA: zeroSHA, NewSHA: "c2"}}
+	if rejected := c.Check(linearPush(create, refs, history)); len(rejected) > 0 {
+		t.Errorf("creating a protected branch from a tag should be allowed: %v", rejected)
+	}
+
+	// 新建时带上的新提交还是要签名
+	history = append(history, "c4")
+	create = []types.RefUpdate{{Ref: "refs/heads/release/1.0", OldSHA: zeroSHA, NewSHA: "c4"}}
+	rejected := c.Check(linearPush(create, refs, history))
+	if reason := rejected["refs/heads/release/1.0"]; !strings.Contains(reason, "c4") {
+		t.Errorf("an unsigned new commit should be rejected, got %q", reason)
+	}
+	if rejected := c.Check(linearPush(create, refs, history, "c4")); len(rejected) > 0 {
+		t.Errorf("a signed new commit should be allowed: %v", rejected)
+	}
+}
+
+func TestUpdateProtectedBranchChecksCommitsAfterOldValue(t *testing.T) {
+	c := testChecker(t)
+	history := []string{"c1", "c2", "c3"}
+	// c3 已经在 main 上了，但对 release/1.0 来说是新提交
+	refs := map[string]string{"refs/heads/main": "c3", "refs/heads/release/1.0": "c1"}
+	update := []types.RefUpdate{{Ref: "refs/heads/release/1.0", OldSHA: "c1", NewSHA: "c3"}}
+
+	rejected := c.Check(linearPush(update, refs, history, "c3"))
+	if reason := rejected["refs/heads/release/1.0"]; !strings.Contains(reason, "c2") {
+		t.Errorf("an unsigned commit from another branch should be rejected, got %q", reason)
+	}
+	if rejected := c.Check(linearPush(update, refs, history, "c2", "c3")); len(rejected) > 0 {
+		t.Errorf("signed commits should be allowed: %v", rejected)
+	}
+}
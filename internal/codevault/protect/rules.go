@@ -0,0 +1,176 @@
+package protect
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const rulesFile = "protections"
+
+// ErrRuleNotFound 保护规则不存在
+var ErrRuleNotFound = errors.New("protection rule not found")
+
+// Rule 分支保护规则，Pattern 是 glob，例如 main、release/*
+type Rule struct {
+	ID                   string    `json:"id"`
+	Repo                 string    `json:"repo"`
+	Pattern              string    `json:"pattern"`
+	AllowForcePushes     bool      `json:"allow_force_pushes"`     // 是否允许非快进更新
+	AllowDeletions       bool      `json:"allow_deletions"`        // 是否允许删除分支
+	RestrictPushes       bool      `json:"restrict_pushes"`        // 只有 bypass 名单里的人可以直接推送
+	RequiredStatusChecks []string  `json:"required_status_checks"` // 新的 SHA 上这些 context 必须是 success
+	RequireSignedCommits bool      `json:"require_signed_commits"` // 推送的每个新提交都要有已知用户的有效签名
+	RequiredApprovals    int       `json:"required_approvals"`     // 合并请求至少需要多少个批准
+	BypassUsers          []string  `json:"bypass_users"`           // 不受规则限制的用户
+	BypassTeams          []string  `json:"bypass_teams"`           // 不受规则限制的团队
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// Matches 判断分支名是否匹配规则
+func (r *Rule) Matches(branch string) bool {
+	ok, _ := path.Match(r.Pattern, branch)
+	return ok
+}
+
+// Rules 所有仓库的分支保护规则
+type Rules struct {
+	store *store.Store
+
+	mu    sync.Mutex
+	rules map[string]*Rule
+}
+
+// NewRules 创建规则表并从 store 中加载
+func NewRules(st *store.Store) (*Rules, error) {
+	rs := &Rules{store: st, rules: make(map[string]*Rule)}
+	var saved []*Rule
+	if err := st.Load(rulesFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, r := range saved {
+		rs.rules[r.ID] = r
+	}
+	return rs, nil
+}
+
+// Save 新建或更新规则，ID 为空时新建
+func (rs *Rules) Save(r Rule) (*Rule, error) {
+	if r.Pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", r.Pattern, err)
+	}
+	if r.RequiredApprovals < 0 {
+		return nil, fmt.Errorf("required_approvals must not be negative")
+	}
+	r.Repo = utils.NormalizeRepoName(r.Repo)
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if r.ID == "" {
+		r.ID = utils.RandomID(6)
+		r.CreatedAt = time.Now()
+	} else if old, ok := rs.rules[r.ID]; !ok || old.Repo != r.Repo {
+		return nil, ErrRuleNotFound
+	} else {
+		r.CreatedAt = old.CreatedAt
+	}
+	rs.rules[r.ID] = &r
+	out := r
+	return &out, rs.saveLocked()
+}
+
+// Get 查询规则
+func (rs *Rules) Get(repo, id string) (*Rule, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, ok := rs.rules[id]
+	if !ok || r.Repo != utils.NormalizeRepoName(repo) {
+		return nil, false
+	}
+	cp := *r
+	return &cp, true
+}
+
+// List 列出仓库的所有规则
+func (rs *Rules) List(repo string) []*Rule {
+	repo = utils.NormalizeRepoName(repo)
+	rs.mu.Lock()
+	list := []*Rule{}
+	for _, r := range rs.rules {
+		if r.Repo == repo {
+			cp := *r
+			list = append(list, &cp)
+		}
+	}
+	rs.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete 删除规则
+func (rs *Rules) Delete(repo, id string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	r, ok := rs.rules[id]
+	if !ok || r.Repo != utils.NormalizeRepoName(repo) {
+		return ErrRuleNotFound
+	}
+	delete(rs.rules, id)
+	return rs.saveLocked()
+}
+
+// Matching 找出匹配某个分支的所有规则
+func (rs *Rules) Matching(repo, branch string) []*Rule {
+	var list []*Rule
+	for _, r := range rs.List(repo) {
+		if r.Matches(branch) {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// RenameRepo 仓库改名时迁移它的规则
+func (rs *Rules) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for _, r := range rs.rules {
+		if r.Repo == oldName {
+			r.Repo = newName
+		}
+	}
+	return rs.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的规则
+func (rs *Rules) DeleteRepo(repo string) error {
+	repo = utils.NormalizeRepoName(repo)
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	for id, r := range rs.rules {
+		if r.Repo == repo {
+			delete(rs.rules, id)
+		}
+	}
+	return rs.saveLocked()
+}
+
+// saveLocked 写回磁盘，调用方必须持有 rs.mu
+func (rs *Rules) saveLocked() error {
+	list := make([]*Rule, 0, len(rs.rules))
+	for _, r := range rs.rules {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return rs.store.Save(rulesFile, list)
+}
@@ -0,0 +1,284 @@
+package release
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 发布接口：有读权限就能查看和下载附件，创建、修改和上传附件需要写权限
+type API struct {
+	manager *Manager
+	policy  *access.Policy
+}
+
+// NewAPI 创建接口
+func NewAPI(manager *Manager, policy *access.Policy) *API {
+	return &API{manager: manager, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+// 按标签查询时标签名是一个路径段，带 / 的标签名要写成 %2F
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/releases", a.handleList)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/releases", a.handleCreate)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/releases/generate-notes", a.handleGenerateNotes)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/releases/latest", a.handleLatest)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/releases/tags/{tag}", a.handleGetByTag)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/releases/{id}", a.handleGet)
+	mux.HandleFunc("PATCH /api/repos/{owner}/{repo}/releases/{id}", a.handleUpdate)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/releases/{id}", a.handleDelete)
+
+	// 附件：直接上传请求体，或者从 OpsEngine 的流水线制品拉取
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/releases/{id}/assets", a.handleUpload)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/releases/{id}/assets/from-run", a.handleFromRun)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/releases/{id}/assets/{asset}", a.handleDownload)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/releases/{id}/assets/{asset}", a.handleDeleteAsset)
+}
+
+// require 检查权限并解析发布编号
+func (a *API) require(w http.ResponseWriter, r *http.Request, level access.Level) (string, int, bool) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, level) {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		utils.WriteError(w, 404, ErrNotFound.Error())
+		return "", 0, false
+	}
+	return name, id, true
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.manager.List(name))
+}
+
+// handleCreate 创建发布：{"tag", "target", "name", "body", "prerelease", "generate_notes"}
+func (a *API) handleCreate(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Write) {
+		return
+	}
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var opts CreateOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	rel, err := a.manager.Create(name, opts, u.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, rel)
+}
+
+// handleGenerateNotes 预览发布说明，不创建标签和发布：{"tag", "target"}
+func (a *API) handleGenerateNotes(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	var req struct {
+		Tag    string `json:"tag"`
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	notes, err := a.manager.GenerateNotes(name, req.Tag, req.Target)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, notes)
+}
+
+// handleLatest 最新的正式发布，预发布不算
+func (a *API) handleLatest(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	for _, rel := range a.manager.List(name) {
+		if !rel.Prerelease {
+			utils.WriteJSON(w, 200, rel)
+			return
+		}
+	}
+	utils.WriteError(w, 404, ErrNotFound.Error())
+}
+
+func (a *API) handleGetByTag(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	rel, err := a.manager.GetByTag(name, r.PathValue("tag"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, rel)
+}
+
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	rel, err := a.manager.Get(name, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, rel)
+}
+
+// handleUpdate 修改发布：{"name", "body", "prerelease"}，没有传的字段不修改
+func (a *API) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	var opts UpdateOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	rel, err := a.manager.Update(name, id, opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, rel)
+}
+
+// handleDelete 删除发布和附件，标签不会被删除
+func (a *API) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	if err := a.manager.Delete(name, id, u.Username); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handleUpload 上传附件：POST .../assets?name=app-linux-amd64，请求体就是文件内容
+func (a *API) handleUpload(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	if r.ContentLength > a.manager.MaxAssetSize {
+		utils.WriteError(w, 413, ErrAssetTooLarge.Error())
+		return
+	}
+	asset, err := a.manager.AddAsset(name, id, AssetOptions{
+		Name:        r.URL.Query().Get("name"),
+		ContentType: r.Header.Get("Content-Type"),
+	}, r.Body, u.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, asset)
+}
+
+// handleFromRun 从 OpsEngine 流水线拉取制品作为附件：{"run_id", "artifact", "name"}，name 默认是制品名
+func (a *API) handleFromRun(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		RunID    string `json:"run_id"`
+		Artifact string `json:"artifact"`
+		Name     string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	asset, err := a.manager.AddRunArtifact(name, id, req.RunID, req.Artifact, req.Name, u.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, asset)
+}
+
+// handleDownload 下载附件，总是作为附件下载，不在浏览器里直接渲染
+func (a *API) handleDownload(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Read)
+	if !ok {
+		return
+	}
+	asset, f, err := a.manager.OpenAsset(name, id, r.PathValue("asset"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": asset.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+asset.SHA256+`"`)
+	http.ServeContent(w, r, "", asset.CreatedAt, f)
+}
+
+func (a *API) handleDeleteAsset(w http.ResponseWriter, r *http.Request) {
+	name, id, ok := a.require(w, r, access.Write)
+	if !ok {
+		return
+	}
+	if err := a.manager.DeleteAsset(name, id, r.PathValue("asset")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrAssetNotFound), errors.Is(err, repo.ErrNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrTagTaken), errors.Is(err, ErrAssetExists):
+		utils.WriteError(w, 409, err.Error())
+	case errors.Is(err, ErrAssetTooLarge):
+		utils.WriteError(w, 413, err.Error())
+	default:
+		utils.WriteError(w, 400, err.Error())
+	}
+}
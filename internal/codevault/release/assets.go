@@ -0,0 +1,175 @@
+package release
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+var (
+	// ErrAssetNotFound 附件不存在
+	ErrAssetNotFound = errors.New("asset not found")
+	// ErrAssetExists 同一个发布里已经有同名附件
+	ErrAssetExists = errors.New("an asset with this name already exists")
+	// ErrAssetTooLarge 附件超过大小上限
+	ErrAssetTooLarge = errors.New("asset is too large")
+)
+
+// Asset 发布的附件，通常是编译好的二进制或者安装包
+type Asset struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"` // 下载时的文件名，同一个发布里唯一
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	ContentType string    `json:"content_type"`
+	Source      string    `json:"source,omitempty"` // 从流水线拉取时记录来源，例如 opsengine:run/<id>/<artifact>
+	Uploader    string    `json:"uploader"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AssetOptions 添加附件的参数
+type AssetOptions struct {
+	Name        string
+	ContentType string
+	Source      string
+}
+
+func (m *Manager) repoDir(repo string) string {
+	return filepath.Join(m.dir, utils.NormalizeRepoName(repo))
+}
+
+func (m *Manager) releaseDir(repo string, id int) string {
+	return filepath.Join(m.repoDir(repo), strconv.Itoa(id))
+}
+
+// validAssetName 附件名直接用作下载文件名，不能带路径和控制字符
+func validAssetName(name string) error {
+	if name == "" || name == "." || name == ".." || len(name) > 255 || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid asset name: %q", name)
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("invalid asset name: %q", name)
+		}
+	}
+	return nil
+}
+
+// AddAsset 上传附件：一边写临时文件一边计算 sha256，写完再登记到发布上
+func (m *Manager) AddAsset(repo string, id int, opts AssetOptions, r io.Reader, uploader string) (*Asset, error) {
+	opts.Name = strings.TrimSpace(opts.Name)
+	if err := validAssetName(opts.Name); err != nil {
+		return nil, err
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+	rel, err := m.Get(repo, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range rel.Assets {
+		if a.Name == opts.Name {
+			return nil, ErrAssetExists
+		}
+	}
+
+	dir := m.releaseDir(rel.Repo, rel.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	// 多读一个字节，用来发现超过上限的内容
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, m.MaxAssetSize+1))
+	tmp.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive asset: %v", err)
+	}
+	if n > m.MaxAssetSize {
+		return nil, ErrAssetTooLarge
+	}
+
+	asset := &Asset{
+		ID:          utils.RandomID(8),
+		Name:        opts.Name,
+		Size:        n,
+		SHA256:      hex.EncodeToString(h.Sum(nil)),
+		ContentType: opts.ContentType,
+		Source:      opts.Source,
+		Uploader:    uploader,
+		CreatedAt:   time.Now(),
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, asset.ID)); err != nil {
+		return nil, err
+	}
+
+	// 上传期间可能有同名附件先登记了，或者发布被删掉了
+	_, err = m.update(repo, id, func(rel *Release) error {
+		for _, a := range rel.Assets {
+			if a.Name == asset.Name {
+				return ErrAssetExists
+			}
+		}
+		rel.Assets = append(rel.Assets, asset)
+		return nil
+	})
+	if err != nil {
+		os.Remove(filepath.Join(dir, asset.ID))
+		return nil, err
+	}
+	out := *asset
+	return &out, nil
+}
+
+// OpenAsset 打开附件用于下载，调用方负责关闭
+func (m *Manager) OpenAsset(repo string, id int, assetID string) (*Asset, *os.File, error) {
+	rel, err := m.Get(repo, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, a := range rel.Assets {
+		if a.ID == assetID {
+			f, err := os.Open(filepath.Join(m.releaseDir(rel.Repo, rel.ID), a.ID))
+			if os.IsNotExist(err) {
+				return nil, nil, ErrAssetNotFound
+			}
+			return a, f, err
+		}
+	}
+	return nil, nil, ErrAssetNotFound
+}
+
+// DeleteAsset 删除附件
+func (m *Manager) DeleteAsset(repo string, id int, assetID string) error {
+	rel, err := m.update(repo, id, func(rel *Release) error {
+		for i, a := range rel.Assets {
+			if a.ID == assetID {
+				rel.Assets = append(rel.Assets[:i], rel.Assets[i+1:]...)
+				return nil
+			}
+		}
+		return ErrAssetNotFound
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(m.releaseDir(rel.Repo, rel.ID), assetID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
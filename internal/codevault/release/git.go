@@ -0,0 +1,166 @@
+package release
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gitRepo 裸仓库上的 git 操作
+type gitRepo struct {
+	path string
+}
+
+// run 执行 git 命令，出错时把输出带上
+func (g gitRepo) run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.path
+	cmd.Env = os.Environ()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(stderr.String()+string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// tagRef 标签当前指向的对象
+type tagRef struct {
+	SHA       string // 附注标签是标签对象，轻量标签就是提交本身
+	Commit    string
+	Annotated bool
+}
+
+// checkTagName 标签名必须是合法的引用名
+func (g gitRepo) checkTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("tag is required")
+	}
+	if strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid tag name: %q", name)
+	}
+	if _, err := g.run("check-ref-format", "refs/tags/"+name); err != nil {
+		return fmt.Errorf("invalid tag name: %q", name)
+	}
+	return nil
+}
+
+// resolveTag 查询标签，不存在时返回 nil
+func (g gitRepo) resolveTag(name string) (*tagRef, error) {
+	sha, err := g.run("rev-parse", "--verify", "--quiet", "refs/tags/"+name)
+	if err != nil || sha == "" {
+		return nil, nil
+	}
+	typ, err := g.run("cat-file", "-t", sha)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := g.run("rev-parse", "--verify", "--quiet", sha+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("tag %s does not point at a commit", name)
+	}
+	return &tagRef{SHA: sha, Commit: commit, Annotated: typ == "tag"}, nil
+}
+
+// resolveCommit 把分支名、标签名或 SHA 解析成提交
+func (g gitRepo) resolveCommit(target string) (string, error) {
+	if target == "" || strings.HasPrefix(target, "-") {
+		return "", fmt.Errorf("invalid target: %q", target)
+	}
+	sha, err := g.run("rev-parse", "--verify", "--quiet", target+"^{commit}")
+	if err != nil || sha == "" {
+		return "", fmt.Errorf("target %s does not exist", target)
+	}
+	return sha, nil
+}
+
+// createTag 在提交上新建附注标签，标签已存在时 git tag 会失败
+// 用户没有邮箱，和合并请求一样用用户名拼一个
+func (g gitRepo) createTag(name, commit, message, username string) (*tagRef, error) {
+	_, err := g.run("-c", "user.name="+username, "-c", "user.email="+username+"@users.noreply.devnexus",
+		"tag", "-a", "-m", message, name, commit)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := g.resolveTag(name)
+	if err != nil {
+		return nil, err
+	}
+	if tag == nil {
+		return nil, fmt.Errorf("tag %s was not created", name)
+	}
+	return tag, nil
+}
+
+// previousTag 提交的历史上离它最近的另一个标签，没有时返回空字符串
+func (g gitRepo) previousTag(tag, commit string) string {
+	prev, err := g.run("describe", "--tags", "--abbrev=0", "--exclude="+tag, commit)
+	if err != nil {
+		return ""
+	}
+	return prev
+}
+
+// commitInfo 发布说明里的一个提交
+type commitInfo struct {
+	SHA     string
+	Author  string
+	Subject string
+}
+
+// firstParentCommits from 之后（不含）到 to 的第一父提交，跳过合并提交，从新到旧
+// 从合并请求合进来的分支上的提交不在第一父链上，由合并请求代表
+func (g gitRepo) firstParentCommits(from, to string, limit int) ([]commitInfo, error) {
+	args := []string{"log", "--first-parent", "--no-merges", fmt.Sprintf("--max-count=%d", limit), "--format=%H%x00%an%x00%s", to}
+	if from != "" {
+		args = append(args, "^"+from)
+	}
+	out, err := g.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	var list []commitInfo
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		list = append(list, commitInfo{SHA: fields[0], Author: fields[1], Subject: fields[2]})
+	}
+	return list, nil
+}
+
+// countCommits from 之后到 to 之间第一父链上的非合并提交数量
+func (g gitRepo) countCommits(from, to string) int {
+	args := []string{"rev-list", "--count", "--first-parent", "--no-merges", to}
+	if from != "" {
+		args = append(args, "^"+from)
+	}
+	out, err := g.run(args...)
+	if err != nil {
+		return 0
+	}
+	var n int
+	fmt.Sscanf(out, "%d", &n)
+	return n
+}
+
+// commitSet from 之后到 to 之间的所有提交，用来判断合并请求是不是在这个范围里合并的
+func (g gitRepo) commitSet(from, to string) (map[string]bool, error) {
+	args := []string{"rev-list", to}
+	if from != "" {
+		args = append(args, "^"+from)
+	}
+	out, err := g.run(args...)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	for _, sha := range strings.Fields(out) {
+		set[sha] = true
+	}
+	return set, nil
+}
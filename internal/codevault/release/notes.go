@@ -0,0 +1,111 @@
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chanslights/DevNexus/internal/codevault/merge"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// maxNoteCommits 发布说明里最多列出多少个提交，超出的部分只显示数量
+const maxNoteCommits = 100
+
+// Notes 自动生成的发布说明
+type Notes struct {
+	Tag         string `json:"tag"`
+	PreviousTag string `json:"previous_tag,omitempty"` // 为空表示这是第一个标签，说明包含全部历史
+	Body        string `json:"body"`                   // Markdown
+}
+
+// GenerateNotes 预览发布说明：tag 还不存在时用 target（默认是默认分支）作为发布的提交
+func (m *Manager) GenerateNotes(repoName, tag, target string) (*Notes, error) {
+	repoName = utils.NormalizeRepoName(repoName)
+	r, err := m.repos.Get(repoName)
+	if err != nil {
+		return nil, err
+	}
+	g := m.git(repoName)
+	if err := g.checkTagName(tag); err != nil {
+		return nil, err
+	}
+	existing, err := g.resolveTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	var commit string
+	if existing != nil {
+		commit = existing.Commit
+	} else {
+		if target == "" {
+			target = r.DefaultBranch
+		}
+		if commit, err = g.resolveCommit(target); err != nil {
+			return nil, err
+		}
+	}
+	return m.notes(repoName, tag, commit)
+}
+
+// notes 生成上一个标签到 commit 之间的发布说明：
+// 先列出这段时间合并的合并请求，再列出直接提交到分支上的提交（合并请求产生的提交不重复列出）
+func (m *Manager) notes(repoName, tag, commit string) (*Notes, error) {
+	g := m.git(repoName)
+	prev := g.previousTag(tag, commit)
+	inRange, err := g.commitSet(prev, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []*merge.MergeRequest
+	mergeCommits := make(map[string]bool)
+	if m.merges != nil {
+		for _, mr := range m.merges.List(repoName, merge.StateMerged) {
+			if mr.MergeCommit != "" && inRange[mr.MergeCommit] {
+				merged = append(merged, mr)
+				mergeCommits[mr.MergeCommit] = true
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ID < merged[j].ID })
+
+	commits, err := g.firstParentCommits(prev, commit, maxNoteCommits)
+	if err != nil {
+		return nil, err
+	}
+	total := g.countCommits(prev, commit)
+
+	var b strings.Builder
+	b.WriteString("## What's changed\n")
+	if len(merged) > 0 {
+		b.WriteString("\n### Merge requests\n\n")
+		for _, mr := range merged {
+			fmt.Fprintf(&b, "- %s (!%d) by @%s\n", mr.Title, mr.ID, mr.Author)
+		}
+	}
+	var direct []commitInfo
+	for _, c := range commits {
+		if !mergeCommits[c.SHA] {
+			direct = append(direct, c)
+		}
+	}
+	if len(direct) > 0 {
+		b.WriteString("\n### Commits\n\n")
+		for _, c := range direct {
+			fmt.Fprintf(&b, "- %.7s %s (%s)\n", c.SHA, c.Subject, c.Author)
+		}
+		if total > len(commits) {
+			fmt.Fprintf(&b, "- … and %d more\n", total-len(commits))
+		}
+	}
+	if len(merged) == 0 && len(direct) == 0 {
+		b.WriteString("\nNo changes.\n")
+	}
+	if prev != "" {
+		fmt.Fprintf(&b, "\n**Full changelog**: %s...%s\n", prev, tag)
+	} else {
+		fmt.Fprintf(&b, "\n**Full changelog**: first release, %d commit(s)\n", total)
+	}
+	return &Notes{Tag: tag, PreviousTag: prev, Body: strings.TrimSuffix(b.String(), "\n")}, nil
+}
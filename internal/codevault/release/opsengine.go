@@ -0,0 +1,137 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// Run OpsEngine 的一次流水线运行，只取用得到的字段
+type Run struct {
+	ID        string        `json:"id"`
+	Repo      string        `json:"repo"`
+	Commit    string        `json:"commit"`
+	State     string        `json:"state"`
+	Artifacts []RunArtifact `json:"artifacts"`
+}
+
+// RunArtifact 流水线运行产出的制品
+type RunArtifact struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// RunClient 从 OpsEngine 拉取流水线运行和制品
+// 请求用和 Webhook 相同的共享密钥签名，签名内容是 "GET 路径"
+type RunClient struct {
+	baseURL string
+	secret  string
+	client  *http.Client
+}
+
+// NewRunClient 创建客户端，baseURL 例如 http://localhost:8081
+func NewRunClient(baseURL, secret string) *RunClient {
+	return &RunClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+		// 制品可能很大，不设整体超时，只限制等待响应头的时间
+		client: &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 30 * time.Second}},
+	}
+}
+
+// get 发送签名的 GET 请求，非 200 时返回错误
+func (c *RunClient) get(path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("User-Agent", "DevNexus-CodeVault")
+	req.Header.Set(types.HeaderTimestamp, fmt.Sprintf("%d", timestamp))
+	if c.secret != "" {
+		req.Header.Set(types.HeaderSignature, utils.SignRequest(c.secret, timestamp, http.MethodGet, req.URL.EscapedPath()))
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach OpsEngine: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("OpsEngine returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// Run 查询流水线运行
+func (c *RunClient) Run(id string) (*Run, error) {
+	resp, err := c.get("/runs/" + url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var run Run
+	if err := json.NewDecoder(resp.Body).Decode(&run); err != nil {
+		return nil, fmt.Errorf("invalid run from OpsEngine: %v", err)
+	}
+	return &run, nil
+}
+
+// Artifact 下载制品，调用方负责关闭
+func (c *RunClient) Artifact(runID, name string) (io.ReadCloser, error) {
+	resp, err := c.get("/runs/" + url.PathEscape(runID) + "/artifacts/" + url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// AddRunArtifact 把 OpsEngine 流水线的制品添加为附件
+// 运行必须属于同一个仓库，否则有写权限的人可以借发布拿到别的仓库的制品
+func (m *Manager) AddRunArtifact(repo string, id int, runID, artifact, name, uploader string) (*Asset, error) {
+	if m.Runs == nil {
+		return nil, fmt.Errorf("OpsEngine is not configured")
+	}
+	if runID == "" || artifact == "" {
+		return nil, fmt.Errorf("run_id and artifact are required")
+	}
+	if _, err := m.Get(repo, id); err != nil {
+		return nil, err
+	}
+	run, err := m.Runs.Run(runID)
+	if err != nil {
+		return nil, err
+	}
+	if utils.NormalizeRepoName(run.Repo) != utils.NormalizeRepoName(repo) {
+		return nil, fmt.Errorf("run %s does not belong to %s", runID, utils.NormalizeRepoName(repo))
+	}
+	found := false
+	for _, a := range run.Artifacts {
+		if a.Name == artifact {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("run %s has no artifact %q", runID, artifact)
+	}
+
+	body, err := m.Runs.Artifact(runID, artifact)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	if name == "" {
+		name = artifact
+	}
+	return m.AddAsset(repo, id, AssetOptions{
+		Name:   name,
+		Source: fmt.Sprintf("opsengine:run/%s/%s@%.7s", runID, artifact, run.Commit),
+	}, body, uploader)
+}
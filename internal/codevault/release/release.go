@@ -0,0 +1,430 @@
+package release
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/merge"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const releasesFile = "releases"
+
+var (
+	// ErrNotFound 发布不存在
+	ErrNotFound = errors.New("release not found")
+	// ErrTagTaken 标签已经有对应的发布了
+	ErrTagTaken = errors.New("a release already exists for this tag")
+)
+
+// Release 基于附注标签的发布，标签只是指向提交，说明和附件保存在这里
+type Release struct {
+	ID         int       `json:"id"` // 仓库内递增的编号
+	Repo       string    `json:"repo"`
+	Tag        string    `json:"tag"`
+	Name       string    `json:"name"`
+	Body       string    `json:"body"` // 发布说明，Markdown
+	Prerelease bool      `json:"prerelease"`
+	Commit     string    `json:"commit"`  // 标签指向的提交
+	TagSHA     string    `json:"tag_sha"` // 附注标签对象
+	Author     string    `json:"author"`
+	Assets     []*Asset  `json:"assets"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CreateOptions 创建发布的参数
+// 标签已存在时必须是附注标签；不存在时在 Target（分支或提交，默认是默认分支）上新建附注标签
+type CreateOptions struct {
+	Tag           string `json:"tag"`
+	Target        string `json:"target"`
+	Message       string `json:"message"` // 新建标签的说明，默认使用发布名
+	Name          string `json:"name"`    // 默认使用标签名
+	Body          string `json:"body"`
+	Prerelease    bool   `json:"prerelease"`
+	GenerateNotes bool   `json:"generate_notes"` // 根据上一个标签以来的提交和合并请求生成说明，追加在 Body 后面
+}
+
+// UpdateOptions 修改发布，为 nil 的字段不修改；标签和提交创建后不能再改
+type UpdateOptions struct {
+	Name       *string `json:"name"`
+	Body       *string `json:"body"`
+	Prerelease *bool   `json:"prerelease"`
+}
+
+// clone 深拷贝，返回给调用方
+func (rel *Release) clone() *Release {
+	cp := *rel
+	cp.Assets = make([]*Asset, len(rel.Assets))
+	for i, a := range rel.Assets {
+		ac := *a
+		cp.Assets[i] = &ac
+	}
+	return &cp
+}
+
+// key map 的键：repo#id
+func key(repo string, id int) string {
+	return fmt.Sprintf("%s#%d", utils.NormalizeRepoName(repo), id)
+}
+
+// Manager 管理仓库的发布和附件
+// 附件保存在 <dir>/<owner>/<name>.git/<release>/<asset>，仓库改名 / 删除时跟着移动 / 删除
+type Manager struct {
+	store    *store.Store
+	repos    *repo.Manager
+	merges   *merge.Manager
+	webhooks *webhook.Dispatcher
+	dir      string
+
+	// Runs 从 OpsEngine 拉取流水线制品，为 nil 时不能从流水线添加附件
+	Runs *RunClient
+	// MaxAssetSize 单个附件的大小上限（字节）
+	MaxAssetSize int64
+
+	mu       sync.Mutex
+	releases map[string]*Release // repo#id -> 发布
+	createMu sync.Mutex          // 同一时间只创建一个发布，避免两个请求抢同一个标签
+}
+
+// NewManager 创建发布管理器并从 store 中加载
+func NewManager(st *store.Store, repos *repo.Manager, merges *merge.Manager, webhooks *webhook.Dispatcher) (*Manager, error) {
+	m := &Manager{
+		store:        st,
+		repos:        repos,
+		merges:       merges,
+		webhooks:     webhooks,
+		dir:          filepath.Join(st.Dir(), "releases"),
+		MaxAssetSize: 2 << 30,
+		releases:     make(map[string]*Release),
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create release storage: %v", err)
+	}
+	var saved []*Release
+	if err := st.Load(releasesFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, rel := range saved {
+		m.releases[key(rel.Repo, rel.ID)] = rel
+	}
+	return m, nil
+}
+
+// git 打开仓库
+func (m *Manager) git(repoName string) gitRepo {
+	return gitRepo{path: m.repos.Path(repoName)}
+}
+
+// Create 创建发布：使用已有的附注标签，或者新建一个，然后通知订阅方和 OpsEngine
+func (m *Manager) Create(repoName string, opts CreateOptions, author string) (*Release, error) {
+	repoName = utils.NormalizeRepoName(repoName)
+	r, err := m.repos.Get(repoName)
+	if err != nil {
+		return nil, err
+	}
+	opts.Tag = strings.TrimSpace(opts.Tag)
+	g := m.git(repoName)
+	if err := g.checkTagName(opts.Tag); err != nil {
+		return nil, err
+	}
+
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	if _, err := m.GetByTag(repoName, opts.Tag); err == nil {
+		return nil, ErrTagTaken
+	}
+
+	// 1.找到或新建标签
+	tag, err := g.resolveTag(opts.Tag)
+	if err != nil {
+		return nil, err
+	}
+	created := false
+	if tag != nil {
+		if !tag.Annotated {
+			return nil, fmt.Errorf("tag %s is a lightweight tag, releases need an annotated tag", opts.Tag)
+		}
+		if opts.Target != "" {
+			if commit, err := g.resolveCommit(opts.Target); err != nil || commit != tag.Commit {
+				return nil, fmt.Errorf("tag %s already exists and does not point at %s", opts.Tag, opts.Target)
+			}
+		}
+	} else {
+		target := opts.Target
+		if target == "" {
+			target = r.DefaultBranch
+		}
+		commit, err := g.resolveCommit(target)
+		if err != nil {
+			return nil, err
+		}
+		message := opts.Message
+		if message == "" {
+			message = opts.Name
+		}
+		if message == "" {
+			message = opts.Tag
+		}
+		// 和推送一样拿仓库的读锁，不和 gc / repack 同时进行
+		lock := m.repos.RepoLock(repoName)
+		lock.RLock()
+		tag, err = g.createTag(opts.Tag, commit, message, author)
+		lock.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		created = true
+	}
+
+	// 2.生成发布说明
+	body := opts.Body
+	if opts.GenerateNotes {
+		notes, err := m.notes(repoName, opts.Tag, tag.Commit)
+		if err != nil {
+			return nil, err
+		}
+		if body != "" {
+			body += "\n\n"
+		}
+		body += notes.Body
+	}
+	name := strings.TrimSpace(opts.Name)
+	if name == "" {
+		name = opts.Tag
+	}
+
+	m.mu.Lock()
+	id := 1
+	for _, rel := range m.releases {
+		if rel.Repo == repoName && rel.ID >= id {
+			id = rel.ID + 1
+		}
+	}
+	now := time.Now()
+	rel := &Release{
+		ID:         id,
+		Repo:       repoName,
+		Tag:        opts.Tag,
+		Name:       name,
+		Body:       body,
+		Prerelease: opts.Prerelease,
+		Commit:     tag.Commit,
+		TagSHA:     tag.SHA,
+		Author:     author,
+		Assets:     []*Asset{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	m.releases[key(repoName, id)] = rel
+	err = m.saveLocked()
+	if err != nil {
+		delete(m.releases, key(repoName, id))
+	}
+	out := rel.clone()
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🏷️ Released %s %s (%.7s) by %s", repoName, rel.Tag, rel.Commit, author)
+
+	// 3.新建的标签和推送上来的一样发 tag 事件，再发 release 事件
+	if created {
+		m.repos.TouchPush(repoName)
+		if m.webhooks != nil {
+			m.webhooks.PublishRefUpdate(repoName, types.RefUpdate{OldSHA: types.ZeroSHA, NewSHA: tag.SHA, Ref: "refs/tags/" + opts.Tag}, author)
+		}
+	}
+	m.publish(out, types.ReleasePublished, author)
+	return out, nil
+}
+
+// Get 查询发布
+func (m *Manager) Get(repo string, id int) (*Release, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rel, ok := m.releases[key(repo, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return rel.clone(), nil
+}
+
+// GetByTag 按标签名查询发布
+func (m *Manager) GetByTag(repo, tag string) (*Release, error) {
+	repo = utils.NormalizeRepoName(repo)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rel := range m.releases {
+		if rel.Repo == repo && rel.Tag == tag {
+			return rel.clone(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// List 按编号倒序列出仓库的发布
+func (m *Manager) List(repo string) []*Release {
+	repo = utils.NormalizeRepoName(repo)
+	m.mu.Lock()
+	list := []*Release{}
+	for _, rel := range m.releases {
+		if rel.Repo == repo {
+			list = append(list, rel.clone())
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list
+}
+
+// Update 修改发布名、说明和是否预发布
+func (m *Manager) Update(repo string, id int, opts UpdateOptions) (*Release, error) {
+	return m.update(repo, id, func(rel *Release) error {
+		if opts.Name != nil {
+			name := strings.TrimSpace(*opts.Name)
+			if name == "" {
+				name = rel.Tag
+			}
+			rel.Name = name
+		}
+		if opts.Body != nil {
+			rel.Body = *opts.Body
+		}
+		if opts.Prerelease != nil {
+			rel.Prerelease = *opts.Prerelease
+		}
+		return nil
+	})
+}
+
+// Delete 删除发布和它的附件，标签保留在仓库里
+func (m *Manager) Delete(repo string, id int, username string) error {
+	m.mu.Lock()
+	rel, ok := m.releases[key(repo, id)]
+	if !ok {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(m.releases, key(repo, id))
+	if err := m.saveLocked(); err != nil {
+		m.releases[key(repo, id)] = rel
+		m.mu.Unlock()
+		return err
+	}
+	out := rel.clone()
+	m.mu.Unlock()
+
+	if err := os.RemoveAll(m.releaseDir(out.Repo, out.ID)); err != nil {
+		log.Printf("⚠️ Failed to remove assets of %s release %d: %v", out.Repo, out.ID, err)
+	}
+	log.Printf("🗑️ Deleted release %s %s by %s", out.Repo, out.Tag, username)
+	m.publish(out, types.ReleaseDeleted, username)
+	return nil
+}
+
+// update 在锁内修改发布并写回磁盘
+func (m *Manager) update(repo string, id int, fn func(rel *Release) error) (*Release, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rel, ok := m.releases[key(repo, id)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if err := fn(rel); err != nil {
+		return nil, err
+	}
+	rel.UpdatedAt = time.Now()
+	return rel.clone(), m.saveLocked()
+}
+
+// publish 发送 release 事件，OpsEngine 按 .devnexus.yaml 里的 on: [release] 决定要不要构建
+func (m *Manager) publish(rel *Release, action, username string) {
+	if m.webhooks == nil {
+		return
+	}
+	payload := types.WebhookPayload{
+		Event:    types.EventRelease,
+		RepoName: rel.Repo,
+		Ref:      "refs/tags/" + rel.Tag,
+		Tag:      rel.Tag,
+		CommitID: rel.Commit,
+		Pusher:   username,
+		Action:   action,
+		Release:  &types.ReleaseInfo{ID: rel.ID, Name: rel.Name, Prerelease: rel.Prerelease},
+	}
+	list, err := m.webhooks.Publish(rel.Repo, types.EventRelease, payload)
+	if err != nil {
+		log.Printf("❌ Failed to send webhook: %v", err)
+		return
+	}
+	for _, dl := range list {
+		log.Printf("📨 Webhook %s (%s) queued for %s -> %s", dl.ID, types.EventRelease, rel.Repo, dl.URL)
+	}
+}
+
+// RenameRepo 仓库改名时迁移它的发布和附件
+func (m *Manager) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, rel := range m.releases {
+		if rel.Repo == oldName {
+			delete(m.releases, k)
+			rel.Repo = newName
+			m.releases[key(rel.Repo, rel.ID)] = rel
+		}
+	}
+	if _, err := os.Stat(m.repoDir(oldName)); err == nil {
+		// 转移到别的所有者名下时新的上级目录可能还不存在
+		if err := os.MkdirAll(filepath.Dir(m.repoDir(newName)), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(m.repoDir(oldName), m.repoDir(newName)); err != nil {
+			return err
+		}
+	}
+	return m.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时删除它的发布和附件
+func (m *Manager) DeleteRepo(repo string) error {
+	repo = utils.NormalizeRepoName(repo)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, rel := range m.releases {
+		if rel.Repo == repo {
+			delete(m.releases, k)
+		}
+	}
+	if err := os.RemoveAll(m.repoDir(repo)); err != nil {
+		return err
+	}
+	return m.saveLocked()
+}
+
+// saveLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveLocked() error {
+	list := make([]*Release, 0, len(m.releases))
+	for _, rel := range m.releases {
+		list = append(list, rel)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Repo != list[j].Repo {
+			return list[i].Repo < list[j].Repo
+		}
+		return list[i].ID < list[j].ID
+	})
+	return m.store.Save(releasesFile, list)
+}
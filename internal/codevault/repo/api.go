@@ -0,0 +1,265 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 仓库管理接口
+type API struct {
+	manager *Manager
+	policy  *access.Policy
+}
+
+// NewAPI 创建管理接口
+func NewAPI(manager *Manager, policy *access.Policy) *API {
+	return &API{manager: manager, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/repos", a.handleCreate)
+	mux.HandleFunc("GET /api/repos", a.handleList)
+	mux.HandleFunc("GET /api/repos/{repo}", a.handleGetLegacy)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}", a.handleGet)
+	mux.HandleFunc("PATCH /api/repos/{owner}/{repo}", a.handleUpdate)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}", a.handleDelete)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/archive", a.handleArchive)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/unarchive", a.handleArchive)
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/forks", a.handleFork)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/forks", a.handleListForks)
+}
+
+// handleCreate 登录用户可以在自己或所在组织名下创建仓库，创建者成为仓库管理员
+// name 不带所有者时建在自己名下
+func (a *API) handleCreate(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var opts CreateOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	opts.Name = FullName(user.Username, opts.Name)
+	if !a.requireCreate(w, user, opts.Name) {
+		return
+	}
+	created, err := a.manager.Create(opts, user.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, created)
+}
+
+// handleList 分页列出当前用户能看到的仓库，总数放在 X-Total-Count 头里
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFromContext(r.Context())
+	page, perPage := utils.Pagination(r)
+
+	visible := []*Repo{}
+	for _, repo := range a.manager.List() {
+		if a.policy.Level(user, repo.Name) >= access.Read {
+			visible = append(visible, repo)
+		}
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(visible)))
+
+	start := min((page-1)*perPage, len(visible))
+	end := min(start+perPage, len(visible))
+	utils.WriteJSON(w, 200, visible[start:end])
+}
+
+// handleGet 改名、转移过的仓库用旧名字访问时 301 到新地址
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.manager.Exists(name) && a.redirect(w, r, name) {
+		return
+	}
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	repo, err := a.manager.Get(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, repo)
+}
+
+// handleGetLegacy 迁移之前没有所有者的老地址 /api/repos/demo，重定向到迁移后的仓库
+func (a *API) handleGetLegacy(w http.ResponseWriter, r *http.Request) {
+	if !a.redirect(w, r, utils.NormalizeRepoName(r.PathValue("repo"))) {
+		utils.WriteError(w, 404, ErrNotFound.Error())
+	}
+}
+
+// redirect 旧名字能找到现在的仓库、并且当前用户能读时 301 过去
+func (a *API) redirect(w http.ResponseWriter, r *http.Request, name string) bool {
+	target, ok := a.manager.Resolve(name)
+	if !ok || a.policy.Level(auth.UserFromContext(r.Context()), target) < access.Read {
+		return false
+	}
+	http.Redirect(w, r, "/api/repos/"+strings.TrimSuffix(target, ".git"), 301)
+	return true
+}
+
+// handleUpdate 修改描述、默认分支，或者通过 name 重命名
+// name 带上别的所有者就是转移，需要有在新所有者名下建仓库的权限
+func (a *API) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	var req struct {
+		Name          *string `json:"name"`
+		Description   *string `json:"description"`
+		DefaultBranch *string `json:"default_branch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+
+	if req.Description != nil || req.DefaultBranch != nil {
+		if _, err := a.manager.Update(name, req.Description, req.DefaultBranch); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if req.Name != nil && FullName(utils.RepoOwner(name), *req.Name) != name {
+		newName := FullName(utils.RepoOwner(name), *req.Name)
+		if !a.requireCreate(w, auth.UserFromContext(r.Context()), newName) {
+			return
+		}
+		renamed, err := a.manager.Rename(name, newName)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		name = renamed.Name
+	}
+	repo, err := a.manager.Get(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, repo)
+}
+
+func (a *API) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	if err := a.manager.Delete(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// handleArchive 归档 / 取消归档
+func (a *API) handleArchive(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Admin) {
+		return
+	}
+	archived := r.URL.Path[len(r.URL.Path)-len("/archive"):] == "/archive"
+	repo, err := a.manager.SetArchived(name, archived)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 200, repo)
+}
+
+// handleFork 能读仓库的登录用户都可以 fork 到自己或所在组织名下
+// owner 为空时是当前用户，name 为空时沿用父仓库的名字
+func (a *API) handleFork(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	user, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Owner string `json:"owner"`
+		Name  string `json:"name"`
+	}
+	// 请求体可以为空
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	if req.Owner == "" {
+		req.Owner = user.Username
+	}
+	if req.Name == "" {
+		req.Name = path.Base(name)
+	}
+	forkName := FullName(req.Owner, req.Name)
+	if !a.requireCreate(w, user, forkName) {
+		return
+	}
+	fork, err := a.manager.Fork(name, forkName, user.Username)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, 201, fork)
+}
+
+// handleListForks 只列出当前用户能看到的 fork
+func (a *API) handleListForks(w http.ResponseWriter, r *http.Request) {
+	name := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, name, access.Read) {
+		return
+	}
+	user := auth.UserFromContext(r.Context())
+	visible := []*Repo{}
+	for _, fork := range a.manager.Forks(name) {
+		if a.policy.Level(user, fork.Name) >= access.Read {
+			visible = append(visible, fork)
+		}
+	}
+	utils.WriteJSON(w, 200, visible)
+}
+
+// requireCreate 检查用户能否在 name 的所有者名下建仓库，不能时写回 403
+func (a *API) requireCreate(w http.ResponseWriter, user *auth.User, name string) bool {
+	if err := ValidateName(name); err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return false
+	}
+	if !a.policy.CanCreate(user, utils.RepoOwner(name)) {
+		utils.WriteError(w, 403, "cannot create repositories under "+utils.RepoOwner(name))
+		return false
+	}
+	return true
+}
+
+// writeError 把仓库模块的错误映射成 HTTP 状态码
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		utils.WriteError(w, 404, err.Error())
+	case errors.Is(err, ErrExists):
+		utils.WriteError(w, 409, err.Error())
+	default:
+		utils.WriteError(w, 400, err.Error())
+	}
+}
@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// Fork 由 creator 复制一份仓库，新仓库通过 git alternates 共享父仓库的对象，只存自己新增的对象；
+// LFS 等仓库以外的数据由实现了 ForkListener 的模块复制
+// name 为空时用 <creator>/<父仓库名>
+func (m *Manager) Fork(parent, name, creator string) (*Repo, error) {
+	parent = utils.NormalizeRepoName(parent)
+	if name == "" {
+		name = path.Base(parent)
+	}
+	name = FullName(creator, name)
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.Exists(parent) {
+		return nil, ErrNotFound
+	}
+	if m.Exists(name) {
+		return nil, ErrExists
+	}
+	src := m.metaLocked(parent)
+	visibility := m.policy.Settings(parent).Visibility
+
+	// 1.--shared 只复制引用，对象通过 alternates 指向父仓库
+	dir := m.Path(name)
+	cmd := exec.Command("git", "clone", "--bare", "--shared", "--quiet", "--", m.Path(parent), dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		m.removeOwnerDir(name)
+		return nil, fmt.Errorf("git clone failed: %v, output: %s", err, out)
+	}
+	// clone 会把父仓库记成 origin，服务端的仓库不需要远端
+	removeOrigin := exec.Command("git", "remote", "remove", "origin")
+	removeOrigin.Dir = dir
+	removeOrigin.Run()
+	if err := m.linkObjects(name, parent); err != nil {
+		os.RemoveAll(dir)
+		m.removeOwnerDir(name)
+		return nil, err
+	}
+	if src.Description != "" {
+		os.WriteFile(filepath.Join(dir, "description"), []byte(src.Description+"\n"), 0644)
+	}
+
+	// 2.fork 的人是新仓库的管理员，私有仓库的 fork 也是私有的
+	if err := m.policy.InitRepo(name, creator, visibility); err != nil {
+		return nil, err
+	}
+	r := &Repo{
+		Name:          name,
+		Description:   src.Description,
+		DefaultBranch: src.DefaultBranch,
+		Visibility:    visibility,
+		CreatedBy:     creator,
+		CreatedAt:     time.Now(),
+		ForkOf:        parent,
+	}
+	m.repos[name] = r
+	if err := m.saveLocked(); err != nil {
+		return nil, err
+	}
+	if err := m.claimNameLocked(name); err != nil {
+		return nil, err
+	}
+	for _, l := range m.listeners {
+		if fl, ok := l.(ForkListener); ok {
+			if err := fl.ForkRepo(parent, name); err != nil {
+				return nil, fmt.Errorf("failed to copy repository data: %v", err)
+			}
+		}
+	}
+	log.Printf("🍴 %s forked %s to %s", creator, parent, name)
+
+	if m.webhooks != nil {
+		m.webhooks.Publish(name, types.EventRepoCreate, types.WebhookPayload{
+			Event:    types.EventRepoCreate,
+			RepoName: name,
+			Branch:   r.DefaultBranch,
+			Pusher:   creator,
+		})
+	}
+	cp := *r
+	return &cp, nil
+}
+
+// Forks 列出直接 fork 自 name 的仓库
+func (m *Manager) Forks(name string) []*Repo {
+	name = utils.NormalizeRepoName(name)
+	m.mu.Lock()
+	var names []string
+	for _, r := range m.repos {
+		if r.ForkOf == name {
+			names = append(names, r.Name)
+		}
+	}
+	m.mu.Unlock()
+
+	list := []*Repo{}
+	for _, n := range names {
+		list = append(list, m.meta(n))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// linkObjects 把 fork 的 alternates 指向父仓库的对象目录
+// 用相对路径，整个仓库目录搬走（备份恢复）之后依然有效
+func (m *Manager) linkObjects(fork, parent string) error {
+	objects := filepath.Join(m.Path(fork), "objects")
+	rel, err := filepath.Rel(objects, filepath.Join(m.Path(parent), "objects"))
+	if err != nil {
+		return err
+	}
+	alternates := filepath.Join(objects, "info", "alternates")
+	if err := os.WriteFile(alternates, []byte(filepath.ToSlash(rel)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to link objects of %s: %v", fork, err)
+	}
+	return nil
+}
+
+// dissociate 把 fork 用到的父仓库对象复制过来，然后断开 alternates，父仓库被删除前调用
+func (m *Manager) dissociate(fork string) error {
+	path := m.Path(fork)
+	cmd := exec.Command("git", "repack", "-a", "-d", "-q")
+	cmd.Dir = path
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git repack failed: %v, output: %s", err, out)
+	}
+	err := os.Remove(filepath.Join(path, "objects", "info", "alternates"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
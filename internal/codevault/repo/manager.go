@@ -0,0 +1,554 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/internal/codevault/webhook"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	reposFile     = "repos"
+	redirectsFile = "repo_redirects"
+)
+
+var (
+	// ErrNotFound 仓库不存在
+	ErrNotFound = errors.New("repository not found")
+	// ErrExists 仓库已存在
+	ErrExists = errors.New("repository already exists")
+	// ErrArchived 仓库已归档，只读
+	ErrArchived = errors.New("repository is archived")
+
+	namePattern   = regexp.MustCompile(`^([^/]+)/[A-Za-z0-9][A-Za-z0-9._-]{0,99}\.git$`)
+	branchPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+)
+
+// Repo 仓库元数据
+type Repo struct {
+	Name          string     `json:"name"`
+	Description   string     `json:"description"`
+	DefaultBranch string     `json:"default_branch"`
+	Visibility    string     `json:"visibility"`
+	Archived      bool       `json:"archived"`
+	CreatedBy     string     `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastPushAt    *time.Time `json:"last_push_at,omitempty"`
+	ForkOf        string     `json:"fork_of,omitempty"`    // fork 自哪个仓库，对象通过 alternates 共享
+	SizeBytes     int64      `json:"size_bytes,omitempty"` // 查询时实时计算，不落盘
+}
+
+// CreateOptions 创建仓库的参数
+type CreateOptions struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	DefaultBranch string `json:"default_branch"`
+	Visibility    string `json:"visibility"`
+}
+
+// Listener 仓库改名、删除时需要同步数据的其他模块（权限、Webhook、分支保护等）
+type Listener interface {
+	RenameRepo(oldName, newName string) error
+	DeleteRepo(name string) error
+}
+
+// ForkListener fork 时也需要复制数据的 Listener 额外实现这个接口，比如 LFS 对象
+type ForkListener interface {
+	ForkRepo(parent, fork string) error
+}
+
+// Manager 管理磁盘上的裸仓库和它们的元数据
+type Manager struct {
+	root      string
+	store     *store.Store
+	policy    *access.Policy
+	webhooks  *webhook.Dispatcher
+	listeners []Listener
+
+	mu        sync.Mutex
+	repos     map[string]*Repo
+	redirects map[string]string        // 改名、转移之前的旧名字 -> 现在的名字
+	locks     map[string]*sync.RWMutex // 仓库级的读写锁，见 RepoLock
+}
+
+// NewManager 创建仓库管理器并从 store 中加载元数据
+func NewManager(root string, st *store.Store, policy *access.Policy, webhooks *webhook.Dispatcher) (*Manager, error) {
+	m := &Manager{
+		root:      root,
+		store:     st,
+		policy:    policy,
+		webhooks:  webhooks,
+		repos:     make(map[string]*Repo),
+		redirects: make(map[string]string),
+		locks:     make(map[string]*sync.RWMutex),
+	}
+	var saved []*Repo
+	if err := st.Load(reposFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, r := range saved {
+		m.repos[r.Name] = r
+	}
+	if err := st.Load(redirectsFile, &m.redirects); err != nil {
+		return nil, err
+	}
+	if m.redirects == nil {
+		m.redirects = make(map[string]string)
+	}
+	return m, nil
+}
+
+// AddListener 注册改名 / 删除时需要同步的模块
+func (m *Manager) AddListener(l Listener) {
+	m.listeners = append(m.listeners, l)
+}
+
+// Path 仓库在磁盘上的路径
+func (m *Manager) Path(name string) string {
+	return filepath.Join(m.root, utils.NormalizeRepoName(name))
+}
+
+// Exists 仓库是否存在于磁盘上，不合法的名字一律当作不存在
+func (m *Manager) Exists(name string) bool {
+	name = utils.NormalizeRepoName(name)
+	return ValidateName(name) == nil && isDir(m.Path(name))
+}
+
+// ValidateName 校验仓库名 owner/name.git，防止 ../ 之类的路径穿越
+func ValidateName(name string) error {
+	match := namePattern.FindStringSubmatch(name)
+	if match == nil || strings.Contains(name, "..") || utils.ValidateOwner(match[1]) != nil {
+		return fmt.Errorf("invalid repository name: %q", name)
+	}
+	return nil
+}
+
+// RepoLock 仓库级的读写锁：推送等写入对象的操作拿读锁，可以并发；
+// gc / repack 等维护任务、镜像拉取、改名和删除拿写锁，保证不会和推送同时进行
+func (m *Manager) RepoLock(name string) *sync.RWMutex {
+	name = utils.NormalizeRepoName(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.locks[name]
+	if !ok {
+		l = &sync.RWMutex{}
+		m.locks[name] = l
+	}
+	return l
+}
+
+// FullName 补全仓库名：没写所有者时放在 owner 名下
+func FullName(owner, name string) string {
+	if !strings.Contains(strings.Trim(name, "/"), "/") {
+		name = owner + "/" + strings.Trim(name, "/")
+	}
+	return utils.NormalizeRepoName(name)
+}
+
+// Resolve 查找改名、转移前的旧名字现在对应的仓库，用于重定向
+func (m *Manager) Resolve(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	target, ok := m.redirects[utils.NormalizeRepoName(name)]
+	return target, ok
+}
+
+// Create 新建裸仓库，创建者成为仓库管理员
+func (m *Manager) Create(opts CreateOptions, creator string) (*Repo, error) {
+	name := utils.NormalizeRepoName(opts.Name)
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if opts.DefaultBranch == "" {
+		opts.DefaultBranch = "main"
+	}
+	if !branchPattern.MatchString(opts.DefaultBranch) {
+		return nil, fmt.Errorf("invalid default branch: %q", opts.DefaultBranch)
+	}
+	if opts.Visibility == "" {
+		opts.Visibility = access.Private
+	}
+	if opts.Visibility != access.Public && opts.Visibility != access.Private {
+		return nil, fmt.Errorf("invalid visibility: %q", opts.Visibility)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Exists(name) {
+		return nil, ErrExists
+	}
+
+	path := m.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create owner directory: %v", err)
+	}
+	initCmd := exec.Command("git", "init", "--bare", "--initial-branch="+opts.DefaultBranch, path)
+	if out, err := initCmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git init failed: %v, output: %s", err, out)
+	}
+	if opts.Description != "" {
+		os.WriteFile(filepath.Join(path, "description"), []byte(opts.Description+"\n"), 0644)
+	}
+	if err := m.policy.InitRepo(name, creator, opts.Visibility); err != nil {
+		return nil, err
+	}
+
+	r := &Repo{
+		Name:          name,
+		Description:   opts.Description,
+		DefaultBranch: opts.DefaultBranch,
+		Visibility:    opts.Visibility,
+		CreatedBy:     creator,
+		CreatedAt:     time.Now(),
+	}
+	m.repos[name] = r
+	if err := m.saveLocked(); err != nil {
+		return nil, err
+	}
+	if err := m.claimNameLocked(name); err != nil {
+		return nil, err
+	}
+
+	if m.webhooks != nil {
+		m.webhooks.Publish(name, types.EventRepoCreate, types.WebhookPayload{
+			Event:    types.EventRepoCreate,
+			RepoName: name,
+			Branch:   opts.DefaultBranch,
+			Pusher:   creator,
+		})
+	}
+	cp := *r
+	return &cp, nil
+}
+
+// Get 查询仓库元数据，包括实时计算的磁盘占用
+func (m *Manager) Get(name string) (*Repo, error) {
+	name = utils.NormalizeRepoName(name)
+	if !m.Exists(name) {
+		return nil, ErrNotFound
+	}
+	r := m.meta(name)
+	r.SizeBytes = dirSize(m.Path(name))
+	return r, nil
+}
+
+// List 列出磁盘上所有的仓库（没有元数据的老仓库也会列出来），目录结构是 <root>/<owner>/<name>.git
+func (m *Manager) List() []*Repo {
+	owners, _ := os.ReadDir(m.root)
+	var list []*Repo
+	for _, o := range owners {
+		if !o.IsDir() || strings.HasSuffix(o.Name(), ".git") {
+			continue
+		}
+		entries, _ := os.ReadDir(filepath.Join(m.root, o.Name()))
+		for _, e := range entries {
+			name := o.Name() + "/" + e.Name()
+			if e.IsDir() && ValidateName(name) == nil {
+				list = append(list, m.meta(name))
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsArchived 仓库是否已归档
+func (m *Manager) IsArchived(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.repos[utils.NormalizeRepoName(name)]
+	return ok && r.Archived
+}
+
+// Update 修改描述和默认分支
+func (m *Manager) Update(name string, description, defaultBranch *string) (*Repo, error) {
+	name = utils.NormalizeRepoName(name)
+	if !m.Exists(name) {
+		return nil, ErrNotFound
+	}
+	path := m.Path(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.metaLocked(name)
+	if description != nil {
+		r.Description = *description
+		os.WriteFile(filepath.Join(path, "description"), []byte(*description+"\n"), 0644)
+	}
+	if defaultBranch != nil {
+		if !branchPattern.MatchString(*defaultBranch) {
+			return nil, fmt.Errorf("invalid default branch: %q", *defaultBranch)
+		}
+		cmd := exec.Command("git", "symbolic-ref", "HEAD", "refs/heads/"+*defaultBranch)
+		cmd.Dir = path
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to set default branch: %v, output: %s", err, out)
+		}
+		r.DefaultBranch = *defaultBranch
+	}
+	m.repos[name] = r
+	cp := *r
+	return &cp, m.saveLocked()
+}
+
+// SetArchived 归档 / 取消归档，归档后的仓库拒绝推送
+func (m *Manager) SetArchived(name string, archived bool) (*Repo, error) {
+	name = utils.NormalizeRepoName(name)
+	if !m.Exists(name) {
+		return nil, ErrNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.metaLocked(name)
+	r.Archived = archived
+	m.repos[name] = r
+	cp := *r
+	return &cp, m.saveLocked()
+}
+
+// Rename 重命名仓库，newName 的所有者不同时就是转移；同时通知其他模块迁移数据
+// 旧名字会记下来，之后访问旧地址时重定向到新地址
+func (m *Manager) Rename(oldName, newName string) (*Repo, error) {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	if err := ValidateName(newName); err != nil {
+		return nil, err
+	}
+
+	// 整个过程拿着仓库的写锁，等正在进行的推送、维护结束，期间不会有新的写入；
+	// 仓库锁要在 m.mu 之前拿，推送拿着仓库锁时会调用 TouchPush
+	lock := m.RepoLock(oldName)
+	lock.Lock()
+	defer lock.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 迁移老的平铺仓库时 oldName 没有所有者，这里不校验格式，只确认目录存在
+	if strings.Contains(oldName, "..") || !isDir(m.Path(oldName)) {
+		return nil, ErrNotFound
+	}
+	if m.Exists(newName) {
+		return nil, ErrExists
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Path(newName)), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create owner directory: %v", err)
+	}
+	if err := os.Rename(m.Path(oldName), m.Path(newName)); err != nil {
+		return nil, fmt.Errorf("failed to rename repository: %v", err)
+	}
+	m.removeOwnerDir(oldName)
+	// 锁跟着仓库走，之后按新名字拿到的还是同一把
+	delete(m.locks, oldName)
+	m.locks[newName] = lock
+
+	r := m.metaLocked(oldName)
+	r.Name = newName
+	delete(m.repos, oldName)
+	m.repos[newName] = r
+	// alternates 里是相对路径，父仓库或 fork 自己改名后都要重新指一遍
+	if r.ForkOf != "" {
+		if err := m.linkObjects(newName, r.ForkOf); err != nil {
+			return nil, err
+		}
+	}
+	for _, fork := range m.repos {
+		if fork.ForkOf == oldName {
+			fork.ForkOf = newName
+			if err := m.linkObjects(fork.Name, newName); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := m.saveLocked(); err != nil {
+		return nil, err
+	}
+	// 指向旧名字的重定向改指新名字，始终只跳一次
+	for from, to := range m.redirects {
+		if to == oldName {
+			m.redirects[from] = newName
+		}
+	}
+	m.redirects[oldName] = newName
+	if err := m.claimNameLocked(newName); err != nil {
+		return nil, err
+	}
+	for _, l := range m.listeners {
+		if err := l.RenameRepo(oldName, newName); err != nil {
+			return nil, fmt.Errorf("failed to migrate repository data: %v", err)
+		}
+	}
+	cp := *r
+	return &cp, nil
+}
+
+// Delete 删除仓库和它的所有数据
+func (m *Manager) Delete(name string) error {
+	name = utils.NormalizeRepoName(name)
+	// 和 Rename 一样先拿仓库的写锁再拿 m.mu
+	lock := m.RepoLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.Exists(name) {
+		return ErrNotFound
+	}
+	// fork 还在用父仓库的对象，先复制过去，fork 变成独立的仓库
+	for _, fork := range m.repos {
+		if fork.ForkOf == name {
+			if err := m.dissociate(fork.Name); err != nil {
+				return fmt.Errorf("failed to detach fork %s: %v", fork.Name, err)
+			}
+			fork.ForkOf = ""
+		}
+	}
+	if err := os.RemoveAll(m.Path(name)); err != nil {
+		return fmt.Errorf("failed to delete repository: %v", err)
+	}
+	m.removeOwnerDir(name)
+	delete(m.repos, name)
+	delete(m.locks, name)
+	if err := m.saveLocked(); err != nil {
+		return err
+	}
+	// 仓库没了，旧地址也不再重定向
+	for from, to := range m.redirects {
+		if to == name {
+			delete(m.redirects, from)
+		}
+	}
+	if err := m.store.Save(redirectsFile, m.redirects); err != nil {
+		return err
+	}
+	for _, l := range m.listeners {
+		if err := l.DeleteRepo(name); err != nil {
+			return fmt.Errorf("failed to clean up repository data: %v", err)
+		}
+	}
+	return nil
+}
+
+// TouchPush 记录最近一次推送时间
+func (m *Manager) TouchPush(name string) {
+	name = utils.NormalizeRepoName(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.metaLocked(name)
+	now := time.Now()
+	r.LastPushAt = &now
+	m.repos[name] = r
+	m.saveLocked()
+}
+
+// meta 元数据副本，可见性以权限模块为准
+func (m *Manager) meta(name string) *Repo {
+	m.mu.Lock()
+	r := m.metaLocked(name)
+	m.mu.Unlock()
+	cp := *r
+	cp.Visibility = m.policy.Settings(name).Visibility
+	return &cp
+}
+
+// metaLocked 取出元数据，老仓库没有元数据时从磁盘推断一份，调用方必须持有 m.mu
+func (m *Manager) metaLocked(name string) *Repo {
+	if r, ok := m.repos[name]; ok {
+		return r
+	}
+	r := &Repo{Name: name, DefaultBranch: "main"}
+	path := m.Path(name)
+	if info, err := os.Stat(path); err == nil {
+		r.CreatedAt = info.ModTime()
+	}
+	cmd := exec.Command("git", "symbolic-ref", "--short", "HEAD")
+	cmd.Dir = path
+	if out, err := cmd.Output(); err == nil {
+		r.DefaultBranch = strings.TrimSpace(string(out))
+	}
+	return r
+}
+
+// saveLocked 写回磁盘，调用方必须持有 m.mu
+func (m *Manager) saveLocked() error {
+	list := make([]*Repo, 0, len(m.repos))
+	for _, r := range m.repos {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return m.store.Save(reposFile, list)
+}
+
+// MigrateFlat 把老的平铺仓库 <root>/<name>.git 迁移到 <root>/<owner>/<name>.git
+// 所有者取创建者，没有记录创建者的仓库放在 defaultOwner 名下；旧地址会重定向到新地址
+// 要在所有 Listener 注册之后调用，这样权限、Webhook 等数据会跟着一起迁移
+func (m *Manager) MigrateFlat(defaultOwner string) error {
+	entries, err := os.ReadDir(m.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasSuffix(e.Name(), ".git") {
+			continue
+		}
+		m.mu.Lock()
+		owner := m.metaLocked(e.Name()).CreatedBy
+		m.mu.Unlock()
+		if utils.ValidateOwner(owner) != nil {
+			owner = defaultOwner
+		}
+		newName := owner + "/" + e.Name()
+		if _, err := m.Rename(e.Name(), newName); err != nil {
+			return fmt.Errorf("failed to migrate %s: %v", e.Name(), err)
+		}
+		log.Printf("📦 Migrated repository %s to %s", e.Name(), newName)
+	}
+	return nil
+}
+
+// claimNameLocked 名字被新仓库占用后，之前指向别处的重定向失效，调用方必须持有 m.mu
+func (m *Manager) claimNameLocked(name string) error {
+	delete(m.redirects, name)
+	return m.store.Save(redirectsFile, m.redirects)
+}
+
+// removeOwnerDir 所有者名下最后一个仓库移走之后删掉空目录，目录不空时 os.Remove 会失败，忽略即可
+func (m *Manager) removeOwnerDir(name string) {
+	if dir := filepath.Dir(m.Path(name)); dir != filepath.Clean(m.root) {
+		os.Remove(dir)
+	}
+}
+
+// isDir 路径是否是一个目录
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dirSize 统计目录占用的字节数
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
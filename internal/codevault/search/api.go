@@ -0,0 +1,74 @@
+package search
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 代码搜索接口：结果里只有当前用户能读的仓库，匿名用户只能搜到公开仓库
+type API struct {
+	manager *Manager
+}
+
+// NewAPI 创建接口
+func NewAPI(manager *Manager) *API {
+	return &API{manager: manager}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/search/code", a.handleSearch)
+
+	// 站点管理员查看索引状态、手动重建索引
+	mux.HandleFunc("GET /api/search/status", a.handleStatus)
+	mux.HandleFunc("POST /api/search/reindex", a.handleReindex)
+}
+
+// handleSearch 搜索默认分支上的代码
+// 参数：q、regex=true、case_sensitive=true、repo（仓库名包含）、path（路径正则）、lang、context（0-5，默认 1）、page、per_page
+func (a *API) handleSearch(w http.ResponseWriter, r *http.Request) {
+	page, perPage := utils.Pagination(r)
+	opts := queryOptions(r.URL.Query(), page, perPage)
+	result, err := a.manager.Search(auth.UserFromContext(r.Context()), opts)
+	switch {
+	case err == nil:
+		utils.WriteJSON(w, 200, result)
+	case errors.Is(err, ErrInvalidQuery), errors.Is(err, ErrBroadQuery):
+		utils.WriteError(w, 400, err.Error())
+	default:
+		utils.WriteError(w, 500, err.Error())
+	}
+}
+
+func (a *API) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	utils.WriteJSON(w, 200, a.manager.Statuses())
+}
+
+// handleReindex 重建索引：?repo=owner/name 只重建一个仓库，不带参数时在后台重建全部
+func (a *API) handleReindex(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	name := r.URL.Query().Get("repo")
+	if name == "" {
+		go a.manager.ReindexAll()
+		utils.WriteJSON(w, 202, map[string]string{"status": "reindexing"})
+		return
+	}
+	err := a.manager.Reindex(name)
+	switch {
+	case err == nil:
+		utils.WriteJSON(w, 200, a.manager.status(name))
+	case errors.Is(err, repo.ErrNotFound):
+		utils.WriteError(w, 404, err.Error())
+	default:
+		utils.WriteError(w, 500, err.Error())
+	}
+}
@@ -0,0 +1,185 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// gitRepo 裸仓库上的 git 操作
+type gitRepo struct {
+	path string
+}
+
+// run 执行 git 命令，出错时把输出带上
+func (g gitRepo) run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.path
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("git %s failed: %v, output: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// branchHead 分支指向的提交，分支不存在（比如空仓库）时返回空字符串
+func (g gitRepo) branchHead(branch string) string {
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return ""
+	}
+	out, err := g.run("rev-parse", "--verify", "--quiet", "refs/heads/"+branch+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// hasCommit 提交是否还在仓库里，强推 + gc 之后旧的提交可能已经没了
+func (g gitRepo) hasCommit(sha string) bool {
+	_, err := g.run("cat-file", "-e", sha+"^{commit}")
+	return err == nil
+}
+
+// blobEntry 树里的一个普通文件
+type blobEntry struct {
+	Path string
+	Blob string
+}
+
+// isIndexable 只索引普通文件，跳过符号链接（120000）和子模块（160000）
+func isIndexable(mode string) bool {
+	return mode == "100644" || mode == "100755"
+}
+
+// listTree 列出提交里的所有普通文件
+func (g gitRepo) listTree(commit string) ([]blobEntry, error) {
+	out, err := g.run("ls-tree", "-r", "-z", "--full-tree", commit)
+	if err != nil {
+		return nil, err
+	}
+	var list []blobEntry
+	for _, rec := range strings.Split(out, "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, path, ok := strings.Cut(rec, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "blob" || !isIndexable(fields[0]) {
+			continue
+		}
+		list = append(list, blobEntry{Path: path, Blob: fields[2]})
+	}
+	return list, nil
+}
+
+// change 两个提交之间一个文件的变化，Blob 为空表示删除或者变成了不需要索引的类型
+type change struct {
+	Path string
+	Blob string
+}
+
+// diffTree 两个提交之间变化的文件，改名当作删除 + 新增
+func (g gitRepo) diffTree(from, to string) ([]change, error) {
+	out, err := g.run("diff-tree", "-r", "-z", "--no-renames", "--raw", from, to)
+	if err != nil {
+		return nil, err
+	}
+	// -z 时每条记录是 ":<旧 mode> <新 mode> <旧 sha> <新 sha> <状态>" NUL <path> NUL
+	recs := strings.Split(out, "\x00")
+	var list []change
+	for i := 0; i+1 < len(recs); i += 2 {
+		fields := strings.Fields(strings.TrimPrefix(recs[i], ":"))
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected diff-tree output: %q", recs[i])
+		}
+		c := change{Path: recs[i+1]}
+		if fields[4] != "D" && isIndexable(fields[1]) {
+			c.Blob = fields[3]
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// readBlobs 用一个 git cat-file --batch 读取一批 blob，超过 maxSize 的只跳过不回调
+func (g gitRepo) readBlobs(shas []string, maxSize int64, fn func(sha string, data []byte)) error {
+	if len(shas) == 0 {
+		return nil
+	}
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = g.path
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// 一边写请求一边读结果，否则管道写满后两边互相等待
+	go func() {
+		w := bufio.NewWriter(stdin)
+		for _, sha := range shas {
+			w.WriteString(sha + "\n")
+		}
+		w.Flush()
+		stdin.Close()
+	}()
+
+	r := bufio.NewReaderSize(stdout, 64<<10)
+	var readErr error
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		// <sha> <type> <size> LF <内容> LF，对象不存在时是 <sha> missing LF
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			readErr = fmt.Errorf("unexpected cat-file output: %q", header)
+			break
+		}
+		if size > maxSize || fields[1] != "blob" {
+			if _, err := r.Discard(int(size) + 1); err != nil {
+				readErr = err
+				break
+			}
+			continue
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			readErr = err
+			break
+		}
+		fn(fields[0], data[:size])
+	}
+	if readErr != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return readErr
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git cat-file failed: %v, output: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package search
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// binaryProbe 在开头多少字节里找 NUL，找到就当作二进制文件不索引
+const binaryProbe = 8000
+
+// document 索引里的一个文件，更新时旧的文档只打删除标记，编号不会被复用
+type document struct {
+	Path    string
+	Blob    string
+	Lang    string
+	Size    int64
+	Deleted bool
+}
+
+// repoIndex 一个仓库默认分支的三元组索引：三元组 -> 包含它的文档编号（升序）
+// 只保存文件的 blob SHA，匹配时再从仓库里读内容，索引可以随时删掉重建
+type repoIndex struct {
+	Repo      string
+	Branch    string
+	Commit    string
+	Docs      []*document
+	Postings  map[uint32][]uint32
+	Live      int
+	UpdatedAt time.Time
+
+	mu    sync.RWMutex
+	paths map[string]uint32 // 路径 -> 当前的文档编号，加载后重建
+}
+
+func newIndex(repo, branch string) *repoIndex {
+	return &repoIndex{Repo: repo, Branch: branch, Postings: make(map[uint32][]uint32), paths: make(map[string]uint32)}
+}
+
+// isBinary 内容开头有 NUL 字节
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binaryProbe)], 0) >= 0
+}
+
+// add 索引一个文件，调用方必须持有写锁；同一路径的旧文档要先 remove
+func (idx *repoIndex) add(path, blob string, data []byte) {
+	if isBinary(data) {
+		return
+	}
+	id := uint32(len(idx.Docs))
+	idx.Docs = append(idx.Docs, &document{Path: path, Blob: blob, Lang: detectLanguage(path), Size: int64(len(data))})
+	// 编号递增，直接追加就能保持倒排表有序
+	for _, t := range trigrams(data) {
+		idx.Postings[t] = append(idx.Postings[t], id)
+	}
+	idx.paths[path] = id
+	idx.Live++
+}
+
+// remove 删除路径对应的文档，调用方必须持有写锁
+func (idx *repoIndex) remove(path string) {
+	id, ok := idx.paths[path]
+	if !ok {
+		return
+	}
+	idx.Docs[id].Deleted = true
+	delete(idx.paths, path)
+	idx.Live--
+}
+
+// stale 删除标记比有效文档还多时，倒排表里大部分是垃圾，重建比继续增量更新划算
+func (idx *repoIndex) stale() bool {
+	return len(idx.Docs)-idx.Live > idx.Live+1000
+}
+
+func (idx *repoIndex) status() *Status {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return &Status{
+		Repo:      idx.Repo,
+		Branch:    idx.Branch,
+		Commit:    idx.Commit,
+		Files:     idx.Live,
+		Trigrams:  len(idx.Postings),
+		UpdatedAt: idx.UpdatedAt,
+	}
+}
+
+// candidates 可能匹配查询的文档，调用方必须持有读锁
+func (idx *repoIndex) candidates(q *query) []uint32 {
+	ids := idx.eval(q)
+	out := ids[:0:0]
+	for _, id := range ids {
+		if !idx.Docs[id].Deleted {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func (idx *repoIndex) eval(q *query) []uint32 {
+	switch q.op {
+	case opAnd:
+		// 先从最短的倒排表开始求交集
+		lists := make([][]uint32, 0, len(q.trigrams)+len(q.sub))
+		for _, t := range q.trigrams {
+			lists = append(lists, idx.Postings[t])
+		}
+		for _, sub := range q.sub {
+			lists = append(lists, idx.eval(sub))
+		}
+		if len(lists) == 0 {
+			return idx.eval(allQuery)
+		}
+		sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+		result := lists[0]
+		for _, l := range lists[1:] {
+			if len(result) == 0 {
+				break
+			}
+			result = intersect(result, l)
+		}
+		return result
+	case opOr:
+		var result []uint32
+		for _, sub := range q.sub {
+			result = union(result, idx.eval(sub))
+		}
+		return result
+	default:
+		all := make([]uint32, len(idx.Docs))
+		for i := range all {
+			all[i] = uint32(i)
+		}
+		return all
+	}
+}
+
+func intersect(a, b []uint32) []uint32 {
+	var out []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	return out
+}
+
+func union(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			out = append(out, a[i])
+			i++
+		case a[i] > b[j]:
+			out = append(out, b[j])
+			j++
+		default:
+			out = append(out, a[i])
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	return append(out, b[j:]...)
+}
+
+// save 把索引写到磁盘，先写临时文件再改名
+func (idx *repoIndex) save(path string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(idx); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadIndex 读取保存的索引并重建路径表
+func loadIndex(path string) (*repoIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx := &repoIndex{}
+	if err := gob.NewDecoder(f).Decode(idx); err != nil {
+		return nil, err
+	}
+	if idx.Postings == nil {
+		idx.Postings = make(map[uint32][]uint32)
+	}
+	idx.paths = make(map[string]uint32, idx.Live)
+	for id, d := range idx.Docs {
+		if !d.Deleted {
+			idx.paths[d.Path] = uint32(id)
+		}
+	}
+	return idx, nil
+}
@@ -0,0 +1,76 @@
+package search
+
+import (
+	"path"
+	"strings"
+)
+
+// languages 扩展名 -> 语言，按文件名识别的放在 filenames 里
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".jsx":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".java":  "java",
+	".kt":    "kotlin",
+	".kts":   "kotlin",
+	".scala": "scala",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cxx":   "cpp",
+	".hpp":   "cpp",
+	".hh":    "cpp",
+	".cs":    "csharp",
+	".rs":    "rust",
+	".rb":    "ruby",
+	".php":   "php",
+	".swift": "swift",
+	".m":     "objective-c",
+	".lua":   "lua",
+	".pl":    "perl",
+	".r":     "r",
+	".sh":    "shell",
+	".bash":  "shell",
+	".zsh":   "shell",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".proto": "protobuf",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".json":  "json",
+	".toml":  "toml",
+	".xml":   "xml",
+	".html":  "html",
+	".htm":   "html",
+	".css":   "css",
+	".scss":  "scss",
+	".vue":   "vue",
+	".md":    "markdown",
+	".tf":    "terraform",
+}
+
+var filenames = map[string]string{
+	"Dockerfile":  "dockerfile",
+	"Makefile":    "makefile",
+	"GNUmakefile": "makefile",
+	"go.mod":      "go-module",
+	"Jenkinsfile": "groovy",
+}
+
+// detectLanguage 根据文件名判断语言，认不出来时返回空字符串
+func detectLanguage(p string) string {
+	base := path.Base(p)
+	if lang, ok := filenames[base]; ok {
+		return lang
+	}
+	if strings.HasPrefix(base, "Dockerfile.") {
+		return "dockerfile"
+	}
+	return languages[strings.ToLower(path.Ext(base))]
+}
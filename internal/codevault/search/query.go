@@ -0,0 +1,278 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+)
+
+const (
+	maxMatchesPerFile = 10  // 每个文件最多展示多少个匹配行
+	maxLineLength     = 500 // 展示的一行最多多少字节
+	maxContext        = 5   // 匹配行前后最多带几行上下文
+	maxScannedFiles   = 5000
+	blobBatch         = 200 // 每次从仓库读多少个候选文件，凑够结果就不再往下读
+)
+
+var (
+	// ErrInvalidQuery 查询为空，或者正则、路径过滤写错了
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrBroadQuery 查询推不出任何三元组，只能扫描所有文件
+	ErrBroadQuery = errors.New("query is too broad: it needs at least 3 consecutive literal characters")
+)
+
+// Options 搜索参数
+type Options struct {
+	Query         string
+	Regex         bool   // Query 是正则，否则按字面量搜索
+	CaseSensitive bool   // 默认忽略大小写
+	Repo          string // 仓库名包含这个字符串，例如 alice/ 或者 alice/api
+	Path          string // 路径要匹配的正则
+	Language      string // 按扩展名识别的语言，例如 go、python
+	Context       int    // 匹配行前后带几行
+	Page          int
+	PerPage       int
+}
+
+// Line 结果里的一行，Ranges 是匹配部分在 Text 里的字节区间
+type Line struct {
+	Number int      `json:"number"`
+	Text   string   `json:"text"`
+	Ranges [][2]int `json:"ranges,omitempty"`
+}
+
+// Snippet 一段连续的行，包含匹配行和它们的上下文
+type Snippet struct {
+	Lines []Line `json:"lines"`
+}
+
+// FileResult 一个匹配的文件
+type FileResult struct {
+	Repo       string    `json:"repo"`
+	Branch     string    `json:"branch"`
+	Commit     string    `json:"commit"`
+	Path       string    `json:"path"`
+	Language   string    `json:"language,omitempty"`
+	MatchCount int       `json:"match_count"` // 匹配的行数，Snippets 里最多展示 maxMatchesPerFile 行
+	Snippets   []Snippet `json:"snippets"`
+}
+
+// Result 一页搜索结果，按仓库和路径排序
+type Result struct {
+	Results   []*FileResult `json:"results"`
+	More      bool          `json:"more"`      // 后面还有更多结果
+	Truncated bool          `json:"truncated"` // 候选文件太多，没有全部检查
+}
+
+// candidate 索引筛出来、还需要用正则验证的文件
+type candidate struct {
+	path, blob, lang string
+}
+
+// Search 在用户能读的所有仓库里搜索代码
+func (m *Manager) Search(user *auth.User, opts Options) (*Result, error) {
+	if strings.TrimSpace(opts.Query) == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidQuery)
+	}
+	pattern := opts.Query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !opts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad regular expression: %v", ErrInvalidQuery, err)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad regular expression: %v", ErrInvalidQuery, err)
+	}
+	q := analyze(parsed.Simplify())
+	if q.op == opAll {
+		return nil, ErrBroadQuery
+	}
+	var pathRe *regexp.Regexp
+	if opts.Path != "" {
+		if pathRe, err = regexp.Compile(opts.Path); err != nil {
+			return nil, fmt.Errorf("%w: bad path filter: %v", ErrInvalidQuery, err)
+		}
+	}
+	repoFilter := strings.ToLower(strings.TrimSuffix(opts.Repo, ".git"))
+	lang := strings.ToLower(opts.Language)
+	opts.Context = max(0, min(opts.Context, maxContext))
+
+	// 用户能读、并且符合仓库过滤条件的索引
+	m.mu.RLock()
+	var indexes []*repoIndex
+	for name, idx := range m.indexes {
+		if repoFilter != "" && !strings.Contains(strings.ToLower(strings.TrimSuffix(name, ".git")), repoFilter) {
+			continue
+		}
+		if m.policy.Level(user, name) >= access.Read {
+			indexes = append(indexes, idx)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Repo < indexes[j].Repo })
+
+	// 凑够当前页再多一个就停，多出来的那个说明还有下一页
+	want := opts.Page*opts.PerPage + 1
+	result := &Result{Results: []*FileResult{}}
+	var found []*FileResult
+	scanned := 0
+	for _, idx := range indexes {
+		idx.mu.RLock()
+		repoName, branch, commit := idx.Repo, idx.Branch, idx.Commit
+		var cands []candidate
+		for _, id := range idx.candidates(q) {
+			d := idx.Docs[id]
+			if lang != "" && d.Lang != lang {
+				continue
+			}
+			if pathRe != nil && !pathRe.MatchString(d.Path) {
+				continue
+			}
+			cands = append(cands, candidate{path: d.Path, blob: d.Blob, lang: d.Lang})
+		}
+		idx.mu.RUnlock()
+		sort.Slice(cands, func(i, j int) bool { return cands[i].path < cands[j].path })
+
+		g := gitRepo{path: m.repos.Path(repoName)}
+		for start := 0; start < len(cands) && len(found) < want; start += blobBatch {
+			batch := cands[start:min(start+blobBatch, len(cands))]
+			if scanned+len(batch) > maxScannedFiles {
+				result.Truncated = true
+				break
+			}
+			scanned += len(batch)
+			contents := make(map[string][]byte)
+			shas := make([]string, len(batch))
+			for i, c := range batch {
+				shas[i] = c.blob
+			}
+			if err := g.readBlobs(shas, m.MaxFileSize, func(sha string, data []byte) { contents[sha] = data }); err != nil {
+				return nil, err
+			}
+			for _, c := range batch {
+				data, ok := contents[c.blob]
+				if !ok {
+					continue
+				}
+				fr := matchFile(re, data, opts.Context)
+				if fr == nil {
+					continue
+				}
+				fr.Repo, fr.Branch, fr.Commit, fr.Path, fr.Language = repoName, branch, commit, c.path, c.lang
+				found = append(found, fr)
+				if len(found) >= want {
+					break
+				}
+			}
+		}
+		if len(found) >= want || result.Truncated {
+			break
+		}
+	}
+
+	from := min((opts.Page-1)*opts.PerPage, len(found))
+	to := min(from+opts.PerPage, len(found))
+	result.Results = append(result.Results, found[from:to]...)
+	result.More = len(found) > to
+	return result, nil
+}
+
+// matchFile 逐行匹配，返回带行号的片段；没有匹配时返回 nil
+func matchFile(re *regexp.Regexp, data []byte, context int) *FileResult {
+	lines := bytes.Split(data, []byte("\n"))
+	// 文件以换行结尾时最后一个空串不是真正的一行
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	fr := &FileResult{Snippets: []Snippet{}}
+	var shown []int
+	ranges := make(map[int][][2]int)
+	for i, line := range lines {
+		locs := re.FindAllIndex(line, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		fr.MatchCount++
+		if len(shown) >= maxMatchesPerFile {
+			continue
+		}
+		shown = append(shown, i)
+		for _, loc := range locs {
+			if shown := len(truncate(line)); loc[0] < shown {
+				ranges[i] = append(ranges[i], [2]int{loc[0], min(loc[1], shown)})
+			}
+		}
+	}
+	if fr.MatchCount == 0 {
+		return nil
+	}
+
+	// 匹配行加上前后的上下文，重叠或相邻的合并成一段
+	var cur *Snippet
+	last := -1
+	for _, i := range shown {
+		from, to := max(0, i-context), min(len(lines)-1, i+context)
+		if cur == nil || from > last+1 {
+			fr.Snippets = append(fr.Snippets, Snippet{})
+			cur = &fr.Snippets[len(fr.Snippets)-1]
+		} else {
+			from = last + 1
+		}
+		for n := from; n <= to; n++ {
+			cur.Lines = append(cur.Lines, Line{Number: n + 1, Text: truncate(lines[n]), Ranges: ranges[n]})
+		}
+		last = max(last, to)
+	}
+	return fr
+}
+
+// truncate 截断过长的行，不切断多字节字符
+func truncate(line []byte) string {
+	if len(line) <= maxLineLength {
+		return string(line)
+	}
+	cut := maxLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return string(line[:cut])
+}
+
+// queryOptions 从 URL 参数解析搜索参数
+func queryOptions(values map[string][]string, page, perPage int) Options {
+	get := func(k string) string {
+		if v := values[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	opts := Options{
+		Query:         get("q"),
+		Regex:         get("regex") == "true",
+		CaseSensitive: get("case_sensitive") == "true",
+		Repo:          get("repo"),
+		Path:          get("path"),
+		Language:      get("lang"),
+		Context:       1,
+		Page:          page,
+		PerPage:       perPage,
+	}
+	if c := get("context"); c != "" {
+		fmt.Sscanf(c, "%d", &opts.Context)
+	}
+	return opts
+}
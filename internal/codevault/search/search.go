@@ -0,0 +1,317 @@
+package search
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/hooks"
+	"github.com/chanslights/DevNexus/internal/codevault/repo"
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const indexExt = ".idx"
+
+// DefaultMaxFileSize 超过这个大小的文件不索引，通常是生成的代码或者数据文件
+const DefaultMaxFileSize = 1 << 20
+
+// Status 一个仓库的索引状态
+type Status struct {
+	Repo      string    `json:"repo"`
+	Branch    string    `json:"branch"`
+	Commit    string    `json:"commit"`
+	Files     int       `json:"files"`
+	Trigrams  int       `json:"trigrams"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Manager 维护所有仓库默认分支的代码索引
+// 推送和服务端合并后通过 post-receive 增量更新；修改默认分支等不经过推送的变化由 Run 定期补上
+// 索引保存在 <data>/search/<owner>/<name>.git.idx，删掉后会自动重建
+type Manager struct {
+	repos  *repo.Manager
+	policy *access.Policy
+	dir    string
+
+	// MaxFileSize 单个文件的索引上限（字节）
+	MaxFileSize int64
+
+	mu       sync.RWMutex
+	indexes  map[string]*repoIndex // repo -> 索引
+	updateMu sync.Mutex            // 同一时间只更新一个索引，避免推送高峰时占满 CPU
+}
+
+// NewManager 创建索引管理器并加载已有的索引
+func NewManager(st *store.Store, repos *repo.Manager, policy *access.Policy) (*Manager, error) {
+	m := &Manager{
+		repos:       repos,
+		policy:      policy,
+		dir:         filepath.Join(st.Dir(), "search"),
+		MaxFileSize: DefaultMaxFileSize,
+		indexes:     make(map[string]*repoIndex),
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create search index dir: %v", err)
+	}
+	err := filepath.WalkDir(m.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, indexExt) {
+			return err
+		}
+		idx, err := loadIndex(path)
+		if err != nil {
+			// 坏掉的索引删掉，下次同步时重建
+			log.Printf("⚠️ Discarding unreadable search index %s: %v", path, err)
+			os.Remove(path)
+			return nil
+		}
+		m.indexes[idx.Repo] = idx
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manager) indexPath(repo string) string {
+	return filepath.Join(m.dir, utils.NormalizeRepoName(repo)+indexExt)
+}
+
+func (m *Manager) index(repo string) *repoIndex {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.indexes[utils.NormalizeRepoName(repo)]
+}
+
+// Update 把仓库的索引同步到默认分支的最新提交：能增量就只处理变化的文件，否则整个重建
+func (m *Manager) Update(name string) error {
+	name = utils.NormalizeRepoName(name)
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+	r, err := m.repos.Get(name)
+	if err != nil {
+		return err
+	}
+	g := gitRepo{path: m.repos.Path(name)}
+	head := g.branchHead(r.DefaultBranch)
+	old := m.index(name)
+	if head == "" {
+		// 空仓库或者默认分支不存在，没有可以搜索的内容
+		if old != nil {
+			m.drop(name)
+		}
+		return nil
+	}
+	if old != nil && old.Commit == head && old.Branch == r.DefaultBranch {
+		return nil
+	}
+
+	start := time.Now()
+	var idx *repoIndex
+	if old != nil && !old.stale() && g.hasCommit(old.Commit) {
+		err = m.applyDiff(g, old, head, r.DefaultBranch)
+		idx = old
+	} else {
+		idx, err = m.build(g, name, head, r.DefaultBranch)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to index %s: %v", name, err)
+	}
+	if err := idx.save(m.indexPath(name)); err != nil {
+		log.Printf("⚠️ Failed to save search index of %s: %v", name, err)
+	}
+	log.Printf("🔎 Indexed %s@%s (%.7s): %d files in %s", name, r.DefaultBranch, head, idx.Live, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// build 重新索引整个提交，完成后替换旧的索引
+func (m *Manager) build(g gitRepo, name, commit, branch string) (*repoIndex, error) {
+	entries, err := g.listTree(commit)
+	if err != nil {
+		return nil, err
+	}
+	// 内容相同的文件共用一个 blob，只读一次
+	paths := make(map[string][]string)
+	var shas []string
+	for _, e := range entries {
+		if _, ok := paths[e.Blob]; !ok {
+			shas = append(shas, e.Blob)
+		}
+		paths[e.Blob] = append(paths[e.Blob], e.Path)
+	}
+
+	idx := newIndex(name, branch)
+	err = g.readBlobs(shas, m.MaxFileSize, func(sha string, data []byte) {
+		for _, p := range paths[sha] {
+			idx.add(p, sha, data)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	idx.Commit = commit
+	idx.UpdatedAt = time.Now()
+
+	m.mu.Lock()
+	m.indexes[name] = idx
+	m.mu.Unlock()
+	return idx, nil
+}
+
+// applyDiff 只重新索引两个提交之间变化的文件
+func (m *Manager) applyDiff(g gitRepo, idx *repoIndex, commit, branch string) error {
+	changes, err := g.diffTree(idx.Commit, commit)
+	if err != nil {
+		return err
+	}
+	var shas []string
+	for _, c := range changes {
+		if c.Blob != "" {
+			shas = append(shas, c.Blob)
+		}
+	}
+	contents := make(map[string][]byte)
+	err = g.readBlobs(shas, m.MaxFileSize, func(sha string, data []byte) {
+		contents[sha] = data
+	})
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, c := range changes {
+		idx.remove(c.Path)
+		if data, ok := contents[c.Blob]; ok {
+			idx.add(c.Path, c.Blob, data)
+		}
+	}
+	idx.Commit = commit
+	idx.Branch = branch
+	idx.UpdatedAt = time.Now()
+	return nil
+}
+
+// Reindex 丢掉仓库的索引重新建立
+func (m *Manager) Reindex(name string) error {
+	name = utils.NormalizeRepoName(name)
+	if !m.repos.Exists(name) {
+		return repo.ErrNotFound
+	}
+	m.drop(name)
+	return m.Update(name)
+}
+
+// drop 删除仓库的索引
+func (m *Manager) drop(name string) {
+	m.mu.Lock()
+	delete(m.indexes, name)
+	m.mu.Unlock()
+	os.Remove(m.indexPath(name))
+}
+
+// Run 启动时把所有仓库同步一遍，之后每隔 tick 检查一次默认分支有没有变化
+func (m *Manager) Run(tick time.Duration) {
+	m.sync()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.sync()
+	}
+}
+
+func (m *Manager) sync() {
+	for _, r := range m.repos.List() {
+		if err := m.Update(r.Name); err != nil {
+			log.Printf("❌ %v", err)
+		}
+	}
+}
+
+// ReindexAll 丢掉所有索引重新建立
+func (m *Manager) ReindexAll() {
+	for _, r := range m.repos.List() {
+		if err := m.Reindex(r.Name); err != nil {
+			log.Printf("❌ %v", err)
+		}
+	}
+}
+
+// Statuses 所有仓库的索引状态
+func (m *Manager) Statuses() []*Status {
+	m.mu.RLock()
+	list := []*Status{}
+	for _, idx := range m.indexes {
+		list = append(list, idx.status())
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Repo < list[j].Repo })
+	return list
+}
+
+// status 一个仓库的索引状态，默认分支没有提交时只有仓库名
+func (m *Manager) status(name string) *Status {
+	if idx := m.index(name); idx != nil {
+		return idx.status()
+	}
+	return &Status{Repo: utils.NormalizeRepoName(name)}
+}
+
+// Name 实现 hooks.PostReceiveHook
+func (m *Manager) Name() string {
+	return "code-search"
+}
+
+// PostReceive 推送更新了默认分支时增量更新索引
+func (m *Manager) PostReceive(p *hooks.Push) {
+	r, err := m.repos.Get(p.Repo)
+	if err != nil {
+		return
+	}
+	for _, u := range p.Updates {
+		if u.IsBranch() && u.ShortName() == r.DefaultBranch {
+			if err := m.Update(p.Repo); err != nil {
+				log.Printf("❌ %v", err)
+			}
+			return
+		}
+	}
+}
+
+// RenameRepo 仓库改名时移动它的索引
+func (m *Manager) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+	m.mu.Lock()
+	idx, ok := m.indexes[oldName]
+	if ok {
+		delete(m.indexes, oldName)
+		idx.mu.Lock()
+		idx.Repo = newName
+		idx.mu.Unlock()
+		m.indexes[newName] = idx
+	}
+	m.mu.Unlock()
+	os.Remove(m.indexPath(oldName))
+	if ok {
+		return idx.save(m.indexPath(newName))
+	}
+	return nil
+}
+
+// DeleteRepo 仓库被删除时删除它的索引
+func (m *Manager) DeleteRepo(repo string) error {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+	m.drop(utils.NormalizeRepoName(repo))
+	return nil
+}
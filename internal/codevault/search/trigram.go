@@ -0,0 +1,143 @@
+package search
+
+import (
+	"regexp/syntax"
+	"sort"
+	"unicode"
+)
+
+// 索引和查询都把 ASCII 字母转成小写，区分大小写的查询在验证阶段由正则自己保证
+func fold(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+func trigram(a, b, c byte) uint32 {
+	return uint32(fold(a))<<16 | uint32(fold(b))<<8 | uint32(fold(c))
+}
+
+// trigrams 内容里出现的所有三元组，去重并排序；跨行的三元组不收录，查询是按行匹配的
+func trigrams(data []byte) []uint32 {
+	if len(data) < 3 {
+		return nil
+	}
+	seen := make(map[uint32]struct{}, len(data)/4)
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] == '\n' || data[i+1] == '\n' || data[i+2] == '\n' {
+			continue
+		}
+		seen[trigram(data[i], data[i+1], data[i+2])] = struct{}{}
+	}
+	list := make([]uint32, 0, len(seen))
+	for t := range seen {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// 查询计划的节点类型
+const (
+	opAll = iota // 任何文件都可能匹配，没法用索引过滤
+	opAnd        // 所有三元组和子节点都要满足
+	opOr         // 任意一个子节点满足
+)
+
+// query 从正则推出的索引查询：文件必须包含哪些三元组
+// 只是候选过滤，推不出来的部分当作 opAll，最后由正则逐行验证
+type query struct {
+	op       int
+	trigrams []uint32
+	sub      []*query
+}
+
+var allQuery = &query{op: opAll}
+
+// literalQuery 字面量要求包含它的所有三元组，短于 3 个字节时没有约束
+func literalQuery(s []byte) *query {
+	if len(s) < 3 {
+		return allQuery
+	}
+	q := &query{op: opAnd}
+	for i := 0; i+2 < len(s); i++ {
+		q.trigrams = append(q.trigrams, trigram(s[i], s[i+1], s[i+2]))
+	}
+	return q
+}
+
+// and 合并两个条件，opAll 是单位元
+func and(a, b *query) *query {
+	switch {
+	case a.op == opAll:
+		return b
+	case b.op == opAll:
+		return a
+	}
+	q := &query{op: opAnd}
+	for _, x := range []*query{a, b} {
+		if x.op == opAnd {
+			q.trigrams = append(q.trigrams, x.trigrams...)
+			q.sub = append(q.sub, x.sub...)
+		} else {
+			q.sub = append(q.sub, x)
+		}
+	}
+	return q
+}
+
+// analyze 推出正则要求的三元组：连续的字面量拼成一段，分支取并集，可以出现 0 次的部分不产生约束
+func analyze(re *syntax.Regexp) *query {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return literalQuery(literalBytes(re.Rune))
+	case syntax.OpCapture:
+		return analyze(re.Sub[0])
+	case syntax.OpPlus:
+		return analyze(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return analyze(re.Sub[0])
+		}
+		return allQuery
+	case syntax.OpConcat:
+		q := allQuery
+		var run []rune
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				run = append(run, sub.Rune...)
+				continue
+			}
+			q = and(q, literalQuery(literalBytes(run)))
+			run = nil
+			q = and(q, analyze(sub))
+		}
+		return and(q, literalQuery(literalBytes(run)))
+	case syntax.OpAlternate:
+		q := &query{op: opOr}
+		for _, sub := range re.Sub {
+			s := analyze(sub)
+			if s.op == opAll {
+				return allQuery
+			}
+			q.sub = append(q.sub, s)
+		}
+		return q
+	default:
+		return allQuery
+	}
+}
+
+// literalBytes 字面量的 UTF-8 编码；非 ASCII 字符的大小写变体不止一种，遇到忽略大小写的非 ASCII 字符就断开
+func literalBytes(runes []rune) []byte {
+	var b []byte
+	for _, r := range runes {
+		if r > unicode.MaxASCII && unicode.SimpleFold(r) != r {
+			// 拆成两段各自取三元组比较麻烦，直接放弃后面的部分，只是少过滤一些
+			break
+		}
+		b = append(b, string(r)...)
+	}
+	return b
+}
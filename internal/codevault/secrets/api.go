@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 仓库密钥的管理接口，需要仓库管理员权限，值写入后不能再读出来
+type API struct {
+	store  *Store
+	policy *access.Policy
+}
+
+// NewAPI 创建管理接口
+func NewAPI(store *Store, policy *access.Policy) *API {
+	return &API{store: store, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/secrets", a.handleList)
+	mux.HandleFunc("PUT /api/repos/{owner}/{repo}/secrets/{name}", a.handleSet)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/secrets/{name}", a.handleDelete)
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.store.List(repo))
+}
+
+func (a *API) handleSet(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	sec, err := a.store.Set(repo, r.PathValue("name"), req.Value)
+	if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, sec)
+}
+
+func (a *API) handleDelete(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Admin) {
+		return
+	}
+	err := a.store.Delete(repo, r.PathValue("name"))
+	if errors.Is(err, ErrNotFound) {
+		utils.WriteError(w, 404, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,248 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const secretsFile = "secrets"
+
+var (
+	// ErrNotFound 密钥不存在
+	ErrNotFound = errors.New("secret not found")
+
+	namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Secret 仓库级别的密钥（镜像凭证等），值只在服务端使用，接口只返回名字
+type Secret struct {
+	Name      string    `json:"name"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// stored 落盘的格式：值用 AES-GCM 加密，base64(nonce + 密文)
+type stored struct {
+	Repo      string    `json:"repo"`
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store 加密保存的仓库密钥
+type Store struct {
+	store *store.Store
+	aead  cipher.AEAD
+
+	mu      sync.Mutex
+	secrets map[string]map[string]*stored // repo -> name -> secret
+}
+
+// NewStore 创建密钥存储
+// key 为空时使用数据目录下的 secret.key，不存在时随机生成一把；key 丢了已保存的密钥就解不开了
+func NewStore(st *store.Store, key string) (*Store, error) {
+	raw, err := loadKey(st, key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{store: st, aead: aead, secrets: make(map[string]map[string]*stored)}
+	var saved []*stored
+	if err := st.Load(secretsFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, sec := range saved {
+		s.repoLocked(sec.Repo)[sec.Name] = sec
+	}
+	return s, nil
+}
+
+// loadKey 得到 32 字节的 AES 密钥，配置的 key 可以是任意字符串，取它的 sha256
+func loadKey(st *store.Store, key string) ([]byte, error) {
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return sum[:], nil
+	}
+	path := filepath.Join(st.Dir(), "secret.key")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(raw)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save secret key: %v", err)
+		}
+		log.Printf("Generated secret encryption key: %s", path)
+		return raw, nil
+	} else if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("invalid secret key %s", path)
+	}
+	return raw, nil
+}
+
+// ValidateName 密钥名只能是字母、数字和下划线，和环境变量一样
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name: %q", name)
+	}
+	return nil
+}
+
+// Set 新建或覆盖密钥
+func (s *Store) Set(repo, name, value string) (*Secret, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, fmt.Errorf("secret value is required")
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	repo = utils.NormalizeRepoName(repo)
+	// 仓库名和密钥名作为附加数据，密文不能被挪到别的仓库下使用
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), []byte(repo+"/"+name))
+	sec := &stored{
+		Repo:      repo,
+		Name:      name,
+		Value:     base64.StdEncoding.EncodeToString(sealed),
+		UpdatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repoLocked(repo)[name] = sec
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return &Secret{Name: sec.Name, UpdatedAt: sec.UpdatedAt}, nil
+}
+
+// Get 解密读取密钥的值
+func (s *Store) Get(repo, name string) (string, error) {
+	repo = utils.NormalizeRepoName(repo)
+	s.mu.Lock()
+	sec, ok := s.secrets[repo][name]
+	s.mu.Unlock()
+	if !ok {
+		return "", ErrNotFound
+	}
+	sealed, err := base64.StdEncoding.DecodeString(sec.Value)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupted", name)
+	}
+	n := s.aead.NonceSize()
+	plain, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(repo+"/"+name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %v", name, err)
+	}
+	return string(plain), nil
+}
+
+// List 列出仓库的密钥，不包含值
+func (s *Store) List(repo string) []*Secret {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []*Secret{}
+	for _, sec := range s.secrets[utils.NormalizeRepoName(repo)] {
+		list = append(list, &Secret{Name: sec.Name, UpdatedAt: sec.UpdatedAt})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete 删除密钥
+func (s *Store) Delete(repo, name string) error {
+	repo = utils.NormalizeRepoName(repo)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[repo][name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.secrets[repo], name)
+	return s.saveLocked()
+}
+
+// RenameRepo 仓库改名时迁移它的密钥，附加数据变了，要重新加密
+func (s *Store) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	values := map[string]string{}
+	for _, sec := range s.List(oldName) {
+		v, err := s.Get(oldName, sec.Name)
+		if err != nil {
+			return err
+		}
+		values[sec.Name] = v
+	}
+	for name, v := range values {
+		if _, err := s.Set(newName, name, v); err != nil {
+			return err
+		}
+	}
+	return s.DeleteRepo(oldName)
+}
+
+// DeleteRepo 仓库被删除时删除它的密钥
+func (s *Store) DeleteRepo(repo string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.secrets, utils.NormalizeRepoName(repo))
+	return s.saveLocked()
+}
+
+// repoLocked 取出仓库的密钥表，不存在时创建，调用方必须持有 s.mu
+func (s *Store) repoLocked(repo string) map[string]*stored {
+	m, ok := s.secrets[repo]
+	if !ok {
+		m = make(map[string]*stored)
+		s.secrets[repo] = m
+	}
+	return m
+}
+
+// saveLocked 写回磁盘，调用方必须持有 s.mu
+func (s *Store) saveLocked() error {
+	list := []*stored{}
+	for _, m := range s.secrets {
+		for _, sec := range m {
+			list = append(list, sec)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Repo != list[j].Repo {
+			return list[i].Repo < list[j].Repo
+		}
+		return list[i].Name < list[j].Name
+	})
+	return s.store.Save(secretsFile, list)
+}
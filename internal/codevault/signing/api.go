@@ -0,0 +1,71 @@
+package signing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 当前用户的 GPG 公钥管理接口；SSH 签名用的是 /api/user/keys 里的 SSH 公钥
+type API struct {
+	keys *Keys
+}
+
+// NewAPI 创建接口
+func NewAPI(keys *Keys) *API {
+	return &API{keys: keys}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/user/gpg_keys", a.handleList)
+	mux.HandleFunc("POST /api/user/gpg_keys", a.handleAdd)
+	mux.HandleFunc("DELETE /api/user/gpg_keys/{id}", a.handleDelete)
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, 200, a.keys.List(u.Username))
+}
+
+// handleAdd 添加 GPG 公钥：{"key": "-----BEGIN PGP PUBLIC KEY BLOCK-----..."}
+func (a *API) handleAdd(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	k, err := a.keys.Add(u.Username, req.Key)
+	if errors.Is(err, ErrKeyExists) {
+		utils.WriteError(w, 409, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, k)
+}
+
+func (a *API) handleDelete(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.RequireUser(w, r)
+	if !ok {
+		return
+	}
+	if err := a.keys.Delete(u.Username, r.PathValue("id")); err != nil {
+		utils.WriteError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,250 @@
+package signing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	keysFile    = "gpg_keys"
+	keyringName = "keyring.gpg"
+)
+
+var (
+	// ErrKeyExists GPG 公钥已经被某个用户添加过
+	ErrKeyExists = errors.New("key is already in use")
+	// ErrKeyNotFound GPG 公钥不存在
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// GPGKey 用户上传的 GPG 公钥，用来验证提交和标签的签名
+type GPGKey struct {
+	ID          string     `json:"id"`
+	Owner       string     `json:"owner"`
+	Fingerprint string     `json:"fingerprint"`       // 主密钥指纹，签名验证结果里用它找到用户
+	KeyID       string     `json:"key_id"`            // 长 ID，指纹的后 16 位
+	Subkeys     []string   `json:"subkeys,omitempty"` // 子密钥指纹
+	UIDs        []string   `json:"uids,omitempty"`    // 例如 Alice <alice@example.com>
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Key         string     `json:"key"` // ASCII armor 格式
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Keys 所有用户的 GPG 公钥
+// 验证签名用的 gpgv 只认二进制的 keyring，每次增删公钥都重新生成 <dir>/keyring.gpg，它可以随时删掉重建
+type Keys struct {
+	store *store.Store
+	dir   string
+
+	mu   sync.Mutex
+	keys map[string]*GPGKey // id -> key
+}
+
+// NewKeys 加载公钥并生成 keyring
+func NewKeys(st *store.Store) (*Keys, error) {
+	ks := &Keys{store: st, dir: filepath.Join(st.Dir(), "gpg"), keys: make(map[string]*GPGKey)}
+	if err := os.MkdirAll(ks.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create GPG directory: %v", err)
+	}
+	var saved []*GPGKey
+	if err := st.Load(keysFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, k := range saved {
+		ks.keys[k.ID] = k
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.writeKeyringLocked(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Add 为用户添加 GPG 公钥，一个请求只能包含一把主密钥
+func (ks *Keys) Add(owner, armored string) (*GPGKey, error) {
+	k, err := parseGPGKey(armored)
+	if err != nil {
+		return nil, err
+	}
+	k.ID = utils.RandomID(6)
+	k.Owner = owner
+	k.CreatedAt = time.Now()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.findLocked(k.Fingerprint) != nil {
+		return nil, ErrKeyExists
+	}
+	ks.keys[k.ID] = k
+	if err := ks.saveLocked(); err != nil {
+		delete(ks.keys, k.ID)
+		return nil, err
+	}
+	out := *k
+	return &out, nil
+}
+
+// Delete 删除用户的公钥，之后这把密钥签的提交显示为未知密钥
+func (ks *Keys) Delete(owner, id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	k, ok := ks.keys[id]
+	if !ok || k.Owner != owner {
+		return ErrKeyNotFound
+	}
+	delete(ks.keys, id)
+	return ks.saveLocked()
+}
+
+// List 用户的所有公钥，按添加时间排序
+func (ks *Keys) List(owner string) []*GPGKey {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	list := []*GPGKey{}
+	for _, k := range ks.keys {
+		if k.Owner == owner {
+			cp := *k
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Owner 按主密钥指纹查找公钥的主人
+func (ks *Keys) Owner(fingerprint string) (string, bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if k := ks.findLocked(fingerprint); k != nil {
+		return k.Owner, true
+	}
+	return "", false
+}
+
+// keyring gpgv 使用的 keyring 路径
+func (ks *Keys) keyring() string {
+	return filepath.Join(ks.dir, keyringName)
+}
+
+func (ks *Keys) findLocked(fingerprint string) *GPGKey {
+	for _, k := range ks.keys {
+		if strings.EqualFold(k.Fingerprint, fingerprint) {
+			return k
+		}
+	}
+	return nil
+}
+
+// saveLocked 持久化并重新生成 keyring，调用方必须持有 ks.mu
+func (ks *Keys) saveLocked() error {
+	list := make([]*GPGKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if err := ks.store.Save(keysFile, list); err != nil {
+		return err
+	}
+	return ks.writeKeyringLocked()
+}
+
+// writeKeyringLocked 把所有公钥去掉 armor 后拼在一起，就是 gpg 的 keyring 格式
+// 先写临时文件再改名，正在运行的 gpgv 读到的总是完整的文件
+func (ks *Keys) writeKeyringLocked() error {
+	var buf bytes.Buffer
+	for _, k := range ks.keys {
+		block, err := armor.Decode(strings.NewReader(k.Key))
+		if err != nil {
+			return fmt.Errorf("failed to decode GPG key %s: %v", k.Fingerprint, err)
+		}
+		if _, err := io.Copy(&buf, block.Body); err != nil {
+			return err
+		}
+	}
+	tmp := ks.keyring() + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.keyring())
+}
+
+// parseGPGKey 用 gpg --show-keys 解析公钥，不导入任何 keyring
+// 输出是 --with-colons 格式：pub / sub 记录后面跟着各自的 fpr 记录，uid 的第 10 个字段是用户 ID
+func parseGPGKey(armored string) (*GPGKey, error) {
+	armored = strings.TrimSpace(armored)
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if block.Type != "PGP PUBLIC KEY BLOCK" {
+		return nil, fmt.Errorf("invalid public key: expected a PGP PUBLIC KEY BLOCK, got %s", block.Type)
+	}
+
+	home, err := os.MkdirTemp("", "devnexus-gpg-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(home)
+	cmd := exec.Command("gpg", "--homedir", home, "--batch", "--no-tty", "--with-colons", "--show-keys")
+	cmd.Stdin = strings.NewReader(armored)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("GPG keys are not supported: gpg is not installed on the server")
+		}
+		return nil, fmt.Errorf("invalid public key: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	k := &GPGKey{Key: armored}
+	var last string // 上一条 pub / sub 记录，决定 fpr 属于谁
+	pubs := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub":
+			pubs++
+			last = "pub"
+			if exp, err := strconv.ParseInt(fields[6], 10, 64); err == nil && exp > 0 {
+				t := time.Unix(exp, 0).UTC()
+				k.ExpiresAt = &t
+			}
+		case "sub":
+			last = "sub"
+		case "fpr":
+			if last == "pub" && k.Fingerprint == "" {
+				k.Fingerprint = fields[9]
+			} else if last == "sub" {
+				k.Subkeys = append(k.Subkeys, fields[9])
+			}
+			last = ""
+		case "uid":
+			k.UIDs = append(k.UIDs, fields[9])
+		}
+	}
+	if pubs != 1 || len(k.Fingerprint) < 16 {
+		return nil, fmt.Errorf("invalid public key: expected exactly one primary key, found %d", pubs)
+	}
+	k.KeyID = k.Fingerprint[len(k.Fingerprint)-16:]
+	return k, nil
+}
@@ -0,0 +1,104 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// git 用 ssh-keygen -Y sign -n git 签名，namespace 固定是 git
+const gitNamespace = "git"
+
+const (
+	sshSigMagic   = "SSHSIG"
+	sshSigVersion = 1
+	sshSigEnd     = "-----END SSH SIGNATURE-----"
+)
+
+// sshSignatureBlob SSHSIG 格式的签名（OpenSSH PROTOCOL.sshsig），MAGIC_PREAMBLE 之后的部分
+type sshSignatureBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData 实际被签名的数据，消息本身只以哈希的形式出现
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// verifySSHSignature 解析 armor 格式的 SSH 签名并验证，返回签名里带的公钥
+// 公钥能解析出来但签名无效时同时返回公钥和错误，调用方可以显示是哪把密钥
+func verifySSHSignature(message, armored []byte, namespace string) (ssh.PublicKey, error) {
+	body := strings.TrimSpace(string(armored))
+	body = strings.TrimPrefix(body, sshSignatureBegin)
+	body, _, ok := strings.Cut(body, sshSigEnd)
+	if !ok {
+		return nil, errors.New("malformed SSH signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %v", err)
+	}
+	if !bytes.HasPrefix(raw, []byte(sshSigMagic)) {
+		return nil, errors.New("malformed SSH signature: bad magic")
+	}
+	var blob sshSignatureBlob
+	if err := ssh.Unmarshal(raw[len(sshSigMagic):], &blob); err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %v", err)
+	}
+	if blob.Version != sshSigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", blob.Version)
+	}
+	key, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %v", err)
+	}
+	if blob.Namespace != namespace {
+		return key, fmt.Errorf("SSH signature namespace is %q, expected %q", blob.Namespace, namespace)
+	}
+
+	var h hash.Hash
+	switch blob.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return key, fmt.Errorf("unsupported SSH signature hash %q", blob.HashAlgorithm)
+	}
+	h.Write(message)
+
+	// 签名本身是 SSH 线格式的 string format + string blob，安全密钥的签名后面还有 flags 和计数器
+	var sig struct {
+		Format string
+		Blob   []byte
+		Rest   []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(blob.Signature, &sig); err != nil {
+		return key, fmt.Errorf("malformed SSH signature: %v", err)
+	}
+	signed := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{
+		Namespace:     blob.Namespace,
+		Reserved:      blob.Reserved,
+		HashAlgorithm: blob.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+	if err := key.Verify(signed, &ssh.Signature{Format: sig.Format, Blob: sig.Blob, Rest: sig.Rest}); err != nil {
+		return key, err
+	}
+	return key, nil
+}
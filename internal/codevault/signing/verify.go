@@ -0,0 +1,257 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+)
+
+// 签名格式
+const (
+	FormatGPG = "gpg"
+	FormatSSH = "ssh"
+)
+
+// 验证结果，只有 ReasonValid 算通过
+const (
+	ReasonValid        = "valid"         // 签名有效，密钥属于 Signer
+	ReasonUnsigned     = "unsigned"      // 没有签名
+	ReasonUnknownKey   = "unknown_key"   // 签名的密钥没有被任何用户添加
+	ReasonBadSignature = "bad_signature" // 签名和内容对不上
+	ReasonExpiredKey   = "expired_key"   // GPG 密钥已过期
+	ReasonRevokedKey   = "revoked_key"   // GPG 密钥已吊销
+	ReasonUnsupported  = "unsupported"   // 无法验证的签名，例如 X.509，或者服务器上没有 gpgv
+)
+
+const (
+	pgpSignatureBegin  = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureBegin  = "-----BEGIN SSH SIGNATURE-----"
+	x509SignatureBegin = "-----BEGIN SIGNED MESSAGE-----"
+)
+
+// Verification 提交或附注标签的签名验证结果
+type Verification struct {
+	Verified bool   `json:"verified"`
+	Reason   string `json:"reason"`
+	Format   string `json:"format,omitempty"` // gpg 或 ssh
+	Signer   string `json:"signer,omitempty"` // 密钥所属的用户
+	KeyID    string `json:"key_id,omitempty"` // GPG 主密钥指纹或 SSH 公钥指纹
+}
+
+// Verifier 用用户添加的公钥验证签名：GPG 签名交给 gpgv，SSH 签名直接用用户的 SSH 公钥验证
+type Verifier struct {
+	keys  *Keys
+	users *auth.UserStore
+}
+
+// NewVerifier 创建验证器
+func NewVerifier(keys *Keys, users *auth.UserStore) *Verifier {
+	return &Verifier{keys: keys, users: users}
+}
+
+// VerifyObjects 验证一批提交或标签，env 不为空时在隔离区里读取对象（推送还没入库的提交）
+// 返回 sha -> 结果，不是提交也不是标签的对象不会出现在结果里
+func (v *Verifier) VerifyObjects(repoPath string, env []string, shas []string) (map[string]*Verification, error) {
+	results := make(map[string]*Verification, len(shas))
+	if len(shas) == 0 {
+		return results, nil
+	}
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = repoPath
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(strings.Join(shas, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file failed: %v, output: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// 输出格式：<sha> <type> <size> LF <内容> LF，对象不存在时是 <sha> missing LF
+	r := bufio.NewReader(bytes.NewReader(out))
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected cat-file output: %q", header)
+		}
+		raw := make([]byte, size+1)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return nil, err
+		}
+		raw = raw[:size]
+		switch fields[1] {
+		case "commit":
+			results[fields[0]] = v.VerifyCommit(raw)
+		case "tag":
+			results[fields[0]] = v.VerifyTag(raw)
+		}
+	}
+	return results, nil
+}
+
+// VerifyCommit 验证提交对象：签名在 gpgsig（SHA-256 仓库是 gpgsig-sha256）头里，签名的内容是去掉这个头的对象
+func (v *Verifier) VerifyCommit(raw []byte) *Verification {
+	payload, sig := splitCommit(raw)
+	return v.verify(payload, sig)
+}
+
+// VerifyTag 验证附注标签：签名追加在标签说明的最后，签名的内容是签名之前的部分
+func (v *Verifier) VerifyTag(raw []byte) *Verification {
+	payload, sig := splitTag(raw)
+	return v.verify(payload, sig)
+}
+
+func (v *Verifier) verify(payload, sig []byte) *Verification {
+	switch {
+	case len(sig) == 0:
+		return &Verification{Reason: ReasonUnsigned}
+	case bytes.HasPrefix(sig, []byte(pgpSignatureBegin)):
+		return v.verifyGPG(payload, sig)
+	case bytes.HasPrefix(sig, []byte(sshSignatureBegin)):
+		return v.verifySSH(payload, sig)
+	default:
+		return &Verification{Reason: ReasonUnsupported}
+	}
+}
+
+// verifyGPG 用 gpgv 验证，结果从 --status-fd 的机器可读输出里取
+// VALIDSIG 的最后一个字段是主密钥指纹，子密钥签名也能找到主人
+func (v *Verifier) verifyGPG(payload, sig []byte) *Verification {
+	result := &Verification{Format: FormatGPG, Reason: ReasonBadSignature}
+	sigFile, err := os.CreateTemp("", "devnexus-sig-")
+	if err != nil {
+		result.Reason = ReasonUnsupported
+		return result
+	}
+	defer os.Remove(sigFile.Name())
+	sigFile.Write(sig)
+	sigFile.Close()
+
+	keyring, _ := filepath.Abs(v.keys.keyring())
+	cmd := exec.Command("gpgv", "--homedir", v.keys.dir, "--status-fd", "1", "--keyring", keyring, sigFile.Name(), "-")
+	cmd.Stdin = bytes.NewReader(payload)
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		result.Reason = ReasonUnsupported
+		return result
+	}
+
+	// gpgv 对过期 / 吊销的密钥也会返回 0，以 status 行为准
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "[GNUPG:] "))
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "VALIDSIG":
+			result.KeyID = fields[len(fields)-1]
+		case "BADSIG":
+			result.Reason = ReasonBadSignature
+			return result
+		case "EXPKEYSIG":
+			result.Reason = ReasonExpiredKey
+			return result
+		case "REVKEYSIG":
+			result.Reason = ReasonRevokedKey
+			return result
+		case "NO_PUBKEY":
+			result.KeyID = fields[1]
+			result.Reason = ReasonUnknownKey
+			return result
+		}
+	}
+	if result.KeyID == "" {
+		return result
+	}
+	owner, ok := v.keys.Owner(result.KeyID)
+	if !ok {
+		result.Reason = ReasonUnknownKey
+		return result
+	}
+	result.Verified, result.Reason, result.Signer = true, ReasonValid, owner
+	return result
+}
+
+// verifySSH 验证 SSH 签名，签名里带着公钥，公钥必须是某个用户添加过的 SSH 公钥
+func (v *Verifier) verifySSH(payload, sig []byte) *Verification {
+	result := &Verification{Format: FormatSSH, Reason: ReasonBadSignature}
+	key, err := verifySSHSignature(payload, sig, gitNamespace)
+	if key == nil {
+		return result
+	}
+	result.KeyID = ssh.FingerprintSHA256(key)
+	if err != nil {
+		return result
+	}
+	owner, ok := v.users.KeyOwner(result.KeyID)
+	if !ok {
+		result.Reason = ReasonUnknownKey
+		return result
+	}
+	result.Verified, result.Reason, result.Signer = true, ReasonValid, owner
+	return result
+}
+
+// splitCommit 从提交对象里拆出签名头，签名是多行的，后续行以一个空格开头
+func splitCommit(raw []byte) (payload, sig []byte) {
+	headerEnd := bytes.Index(raw, []byte("\n\n"))
+	if headerEnd < 0 {
+		return raw, nil
+	}
+	var out, signature bytes.Buffer
+	lines := strings.SplitAfter(string(raw[:headerEnd+1]), "\n")
+	inSig := false
+	for _, line := range lines {
+		if inSig && strings.HasPrefix(line, " ") {
+			signature.WriteString(line[1:])
+			continue
+		}
+		inSig = false
+		if name, value, ok := strings.Cut(line, " "); ok && (name == "gpgsig" || name == "gpgsig-sha256") {
+			if signature.Len() == 0 {
+				inSig = true
+				signature.WriteString(value)
+				continue
+			}
+		}
+		out.WriteString(line)
+	}
+	out.Write(raw[headerEnd+1:])
+	return out.Bytes(), signature.Bytes()
+}
+
+// splitTag 标签的签名在说明的最后，从最后一个签名开始行切开
+func splitTag(raw []byte) (payload, sig []byte) {
+	idx := -1
+	for _, begin := range []string{pgpSignatureBegin, sshSignatureBegin, x509SignatureBegin} {
+		if i := bytes.LastIndex(raw, []byte("\n"+begin)); i > idx {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return raw, nil
+	}
+	return raw[:idx+1], raw[idx+1:]
+}
@@ -0,0 +1,178 @@
+package sshd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/internal/codevault/git"
+)
+
+// Config SSH 服务的配置
+type Config struct {
+	Addr        string // 监听地址，例如 :2222
+	HostKeyPath string // 主机私钥，不存在时自动生成一把 ed25519 密钥
+}
+
+// Server 内嵌的 SSH 服务，只接受 git-upload-pack / git-receive-pack 命令
+// 用户用上传到 /api/user/keys 的公钥认证，SSH 用户名不重要（一般是 git）
+type Server struct {
+	config Config
+	users  *auth.UserStore
+	git    *git.Handler
+	ssh    *ssh.ServerConfig
+}
+
+// NewServer 创建 SSH 服务并加载主机密钥
+func NewServer(config Config, users *auth.UserStore, handler *git.Handler) (*Server, error) {
+	signer, err := loadHostKey(config.HostKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{config: config, users: users, git: handler}
+	s.ssh = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			u, err := users.AuthenticateKey(key)
+			if err != nil {
+				return nil, err
+			}
+			// 认证通过的用户名放进连接的 Permissions，后面的会话从这里取
+			return &ssh.Permissions{Extensions: map[string]string{"username": u.Username}}, nil
+		},
+		ServerVersion: "SSH-2.0-CodeVault",
+	}
+	s.ssh.AddHostKey(signer)
+	return s, nil
+}
+
+// ListenAndServe 监听端口并处理连接
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("CodeVault SSH is listening on %s", s.config.Addr)
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(nc)
+	}
+}
+
+func (s *Server) handleConn(nc net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(nc, s.ssh)
+	if err != nil {
+		// 扫描器、密钥不对的客户端都会走到这里，不打日志
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		// 每次请求都重新查一遍用户，连接期间被删除的用户不能继续操作
+		user, ok := s.users.Get(conn.Permissions.Extensions["username"])
+		if !ok {
+			newChan.Reject(ssh.Prohibited, "user not found")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(user, ch, requests)
+	}
+}
+
+// handleSession 处理一个会话：先收 env（GIT_PROTOCOL），再执行 exec 里的 git 命令
+func (s *Server) handleSession(user *auth.User, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	env := map[string]string{}
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := ssh.Unmarshal(req.Payload, &kv); err == nil {
+				env[kv.Name] = kv.Value
+			}
+			req.Reply(true, nil)
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			code := s.git.ServeSSH(&git.SSHSession{
+				User:    user,
+				Command: payload.Command,
+				Env:     env,
+				Stdin:   ch,
+				Stdout:  ch,
+				Stderr:  ch.Stderr(),
+			})
+			exit(ch, code)
+			return
+		case "shell":
+			// ssh -T git@host 用来测试密钥是否配置好
+			req.Reply(true, nil)
+			fmt.Fprintf(ch.Stderr(), "Hi %s! You've successfully authenticated, but CodeVault does not provide shell access.\n", user.Username)
+			exit(ch, 1)
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// exit 发送退出码，客户端的 ssh 进程以它作为自己的退出码
+func exit(ch ssh.Channel, code int) {
+	ch.CloseWrite()
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(code)}))
+}
+
+// loadHostKey 读取主机私钥，不存在时生成一把新的 ed25519 密钥并保存
+func loadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "codevault host key")
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to save host key: %v", err)
+		}
+		log.Printf("Generated SSH host key: %s", path)
+	} else if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host key %s: %v", path, err)
+	}
+	log.Printf("SSH host key fingerprint: %s", strings.TrimSpace(ssh.FingerprintSHA256(signer.PublicKey())))
+	return signer, nil
+}
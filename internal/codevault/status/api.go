@@ -0,0 +1,65 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API 提交状态接口：有写权限的用户（比如 OpsEngine 的账号）上报，有读权限的用户查询
+type API struct {
+	store  *Store
+	policy *access.Policy
+}
+
+// NewAPI 创建接口
+func NewAPI(store *Store, policy *access.Policy) *API {
+	return &API{store: store, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/statuses/{sha}", a.handleCreate)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/commits/{sha}/statuses", a.handleList)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/commits/{sha}/status", a.handleCombined)
+}
+
+func (a *API) handleCreate(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Write) {
+		return
+	}
+	var req Status
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	req.Repo = repo
+	req.SHA = r.PathValue("sha")
+	req.Creator = auth.UserFromContext(r.Context()).Username
+	cs, err := a.store.Set(req)
+	if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, cs)
+}
+
+func (a *API) handleList(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Read) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.store.List(repo, r.PathValue("sha")))
+}
+
+func (a *API) handleCombined(w http.ResponseWriter, r *http.Request) {
+	repo := utils.RepoFromPath(r)
+	if !a.policy.Require(w, r, repo, access.Read) {
+		return
+	}
+	utils.WriteJSON(w, 200, a.store.Combine(repo, r.PathValue("sha")))
+}
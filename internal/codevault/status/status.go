@@ -0,0 +1,173 @@
+package status
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const statusesFile = "statuses"
+
+// 提交状态
+const (
+	Pending = "pending"
+	Success = "success"
+	Failure = "failure"
+	Error   = "error"
+)
+
+// Status CI 等外部系统对某个提交上报的状态，同一个 context 只保留最新的一条
+type Status struct {
+	Repo        string    `json:"repo"`
+	SHA         string    `json:"sha"`
+	Context     string    `json:"context"` // 例如 opsengine/pipeline
+	State       string    `json:"state"`
+	Description string    `json:"description,omitempty"`
+	TargetURL   string    `json:"target_url,omitempty"`
+	Creator     string    `json:"creator"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Combined 某个提交所有 context 的汇总
+type Combined struct {
+	SHA      string    `json:"sha"`
+	State    string    `json:"state"`
+	Statuses []*Status `json:"statuses"`
+}
+
+// Store 提交状态存储
+type Store struct {
+	store *store.Store
+
+	mu       sync.Mutex
+	statuses map[string]*Status // repo/sha/context -> status
+}
+
+// NewStore 创建状态存储并从 store 中加载
+func NewStore(st *store.Store) (*Store, error) {
+	s := &Store{store: st, statuses: make(map[string]*Status)}
+	var saved []*Status
+	if err := st.Load(statusesFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, cs := range saved {
+		s.statuses[key(cs.Repo, cs.SHA, cs.Context)] = cs
+	}
+	return s, nil
+}
+
+// Set 上报一条状态，覆盖同一个 context 之前的状态
+func (s *Store) Set(cs Status) (*Status, error) {
+	switch cs.State {
+	case Pending, Success, Failure, Error:
+	default:
+		return nil, fmt.Errorf("invalid state: %q", cs.State)
+	}
+	if len(cs.SHA) != 40 {
+		return nil, fmt.Errorf("invalid commit sha: %q", cs.SHA)
+	}
+	if cs.Context == "" {
+		cs.Context = "default"
+	}
+	cs.Repo = utils.NormalizeRepoName(cs.Repo)
+	cs.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[key(cs.Repo, cs.SHA, cs.Context)] = &cs
+	out := cs
+	return &out, s.saveLocked()
+}
+
+// List 列出某个提交的所有状态
+func (s *Store) List(repo, sha string) []*Status {
+	repo = utils.NormalizeRepoName(repo)
+	s.mu.Lock()
+	list := []*Status{}
+	for _, cs := range s.statuses {
+		if cs.Repo == repo && cs.SHA == sha {
+			cp := *cs
+			list = append(list, &cp)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Context < list[j].Context })
+	return list
+}
+
+// Get 查询某个提交在某个 context 下的状态
+func (s *Store) Get(repo, sha, context string) (*Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cs, ok := s.statuses[key(utils.NormalizeRepoName(repo), sha, context)]
+	if !ok {
+		return nil, false
+	}
+	cp := *cs
+	return &cp, true
+}
+
+// Combine 汇总某个提交的状态：任何失败即失败，有进行中的即进行中，全部成功才算成功
+func (s *Store) Combine(repo, sha string) *Combined {
+	c := &Combined{SHA: sha, Statuses: s.List(repo, sha), State: Pending}
+	if len(c.Statuses) == 0 {
+		return c
+	}
+	c.State = Success
+	for _, cs := range c.Statuses {
+		switch cs.State {
+		case Failure, Error:
+			c.State = Failure
+			return c
+		case Pending:
+			c.State = Pending
+		}
+	}
+	return c
+}
+
+// RenameRepo 仓库改名时迁移它的提交状态
+func (s *Store) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, cs := range s.statuses {
+		if cs.Repo == oldName {
+			delete(s.statuses, k)
+			cs.Repo = newName
+			s.statuses[key(cs.Repo, cs.SHA, cs.Context)] = cs
+		}
+	}
+	return s.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的提交状态
+func (s *Store) DeleteRepo(repo string) error {
+	repo = utils.NormalizeRepoName(repo)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, cs := range s.statuses {
+		if cs.Repo == repo {
+			delete(s.statuses, k)
+		}
+	}
+	return s.saveLocked()
+}
+
+// saveLocked 写回磁盘，调用方必须持有 s.mu
+func (s *Store) saveLocked() error {
+	list := make([]*Status, 0, len(s.statuses))
+	for _, cs := range s.statuses {
+		list = append(list, cs)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdatedAt.Before(list[j].UpdatedAt) })
+	return s.store.Save(statusesFile, list)
+}
+
+func key(repo, sha, context string) string {
+	return repo + "/" + sha + "/" + context
+}
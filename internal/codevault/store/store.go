@@ -0,0 +1,73 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store 一个极简的 JSON 文件存储，CodeVault 的元数据（投递日志、用户、权限等）都放在这里
+// 每个 name 对应 DataDir 下的一个 json 文件
+// TODO: 后续替换为 GORM + MySQL
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New 创建存储，目录不存在时自动创建
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir 返回存储所在目录
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Load 读取 name 对应的文件并反序列化到 v，文件不存在时保持 v 不变
+func (s *Store) Load(name string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", name, err)
+	}
+	return nil
+}
+
+// Save 序列化 v 并写入 name 对应的文件
+// 先写临时文件再 rename，保证进程崩溃时不会留下写了一半的文件
+func (s *Store) Save(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return os.Rename(tmp, target)
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
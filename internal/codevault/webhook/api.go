@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/chanslights/DevNexus/internal/codevault/access"
+	"github.com/chanslights/DevNexus/internal/codevault/auth"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// API Webhook 订阅与投递日志的管理接口
+// 仓库的订阅和投递记录需要仓库管理员权限，全局投递日志只有站点管理员可以看
+type API struct {
+	hooks      *Registry
+	dispatcher *Dispatcher
+	policy     *access.Policy
+}
+
+// NewAPI 创建管理接口
+func NewAPI(hooks *Registry, dispatcher *Dispatcher, policy *access.Policy) *API {
+	return &API{hooks: hooks, dispatcher: dispatcher, policy: policy}
+}
+
+// RegisterRoutes 注册路由
+func (a *API) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/repos/{owner}/{repo}/hooks", a.handleCreateHook)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/hooks", a.handleListHooks)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/hooks/{id}", a.handleGetHook)
+	mux.HandleFunc("DELETE /api/repos/{owner}/{repo}/hooks/{id}", a.handleDeleteHook)
+	mux.HandleFunc("GET /api/repos/{owner}/{repo}/hooks/{id}/deliveries", a.handleHookDeliveries)
+
+	mux.HandleFunc("GET /api/deliveries", a.handleListDeliveries)
+	mux.HandleFunc("GET /api/deliveries/{id}", a.handleGetDelivery)
+	mux.HandleFunc("POST /api/deliveries/{id}/redeliver", a.handleRedeliver)
+}
+
+func (a *API) handleCreateHook(w http.ResponseWriter, r *http.Request) {
+	if !a.policy.Require(w, r, utils.RepoFromPath(r), access.Admin) {
+		return
+	}
+	var req Hook
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, 400, "invalid JSON")
+		return
+	}
+	req.Repo = utils.RepoFromPath(r)
+	req.Active = true
+	h, err := a.hooks.Create(req)
+	if err != nil {
+		utils.WriteError(w, 400, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 201, h.Redacted())
+}
+
+func (a *API) handleListHooks(w http.ResponseWriter, r *http.Request) {
+	if !a.policy.Require(w, r, utils.RepoFromPath(r), access.Admin) {
+		return
+	}
+	list := []*Hook{}
+	for _, h := range a.hooks.List(utils.RepoFromPath(r)) {
+		list = append(list, h.Redacted())
+	}
+	utils.WriteJSON(w, 200, list)
+}
+
+func (a *API) handleGetHook(w http.ResponseWriter, r *http.Request) {
+	if !a.policy.Require(w, r, utils.RepoFromPath(r), access.Admin) {
+		return
+	}
+	h, ok := a.lookupHook(r)
+	if !ok {
+		utils.WriteError(w, 404, ErrHookNotFound.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, h.Redacted())
+}
+
+func (a *API) handleDeleteHook(w http.ResponseWriter, r *http.Request) {
+	if !a.policy.Require(w, r, utils.RepoFromPath(r), access.Admin) {
+		return
+	}
+	if err := a.hooks.Delete(utils.RepoFromPath(r), r.PathValue("id")); errors.Is(err, ErrHookNotFound) {
+		utils.WriteError(w, 404, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 500, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *API) handleHookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !a.policy.Require(w, r, utils.RepoFromPath(r), access.Admin) {
+		return
+	}
+	h, ok := a.lookupHook(r)
+	if !ok {
+		utils.WriteError(w, 404, ErrHookNotFound.Error())
+		return
+	}
+	utils.WriteJSON(w, 200, a.dispatcher.List(h.ID))
+}
+
+func (a *API) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	if _, ok := auth.RequireAdmin(w, r); !ok {
+		return
+	}
+	utils.WriteJSON(w, 200, a.dispatcher.List(""))
+}
+
+func (a *API) handleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	dl, ok := a.dispatcher.Get(r.PathValue("id"))
+	if !ok {
+		utils.WriteError(w, 404, ErrDeliveryNotFound.Error())
+		return
+	}
+	if !a.policy.Require(w, r, dl.Repo, access.Admin) {
+		return
+	}
+	utils.WriteJSON(w, 200, dl)
+}
+
+func (a *API) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	if dl, ok := a.dispatcher.Get(r.PathValue("id")); ok && !a.policy.Require(w, r, dl.Repo, access.Admin) {
+		return
+	}
+	dl, err := a.dispatcher.Redeliver(r.PathValue("id"))
+	if errors.Is(err, ErrDeliveryNotFound) {
+		utils.WriteError(w, 404, err.Error())
+		return
+	} else if err != nil {
+		utils.WriteError(w, 409, err.Error())
+		return
+	}
+	utils.WriteJSON(w, 202, dl)
+}
+
+// lookupHook 查询路径中的 Hook，并确认它属于路径中的仓库
+func (a *API) lookupHook(r *http.Request) (*Hook, bool) {
+	h, ok := a.hooks.Get(r.PathValue("id"))
+	if !ok || h.Repo != utils.RepoFromPath(r) {
+		return nil, false
+	}
+	return h, true
+}
@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 投递状态
+const (
+	StatusPending   = "pending"   // 正在投递 / 等待重试
+	StatusDelivered = "delivered" // 对端返回 2xx
+	StatusFailed    = "failed"    // 重试次数用完仍然失败
+)
+
+// Delivery 一次 Webhook 投递记录，包含所有尝试
+type Delivery struct {
+	ID        string          `json:"id"`
+	HookID    string          `json:"hook_id,omitempty"` // 为空表示系统级的 OpsEngine 通知
+	Repo      string          `json:"repo"`
+	Event     string          `json:"event"`
+	URL       string          `json:"url"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  []Attempt       `json:"attempts"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Attempt 单次 HTTP 请求的结果
+type Attempt struct {
+	StatusCode   int           `json:"status_code"`             // 对端返回的状态码，网络错误时为 0
+	Latency      time.Duration `json:"latency"`                 // 请求耗时
+	ResponseBody string        `json:"response_body,omitempty"` // 截断后的响应体
+	Error        string        `json:"error,omitempty"`         // 网络错误信息
+	Time         time.Time     `json:"time"`
+}
@@ -0,0 +1,334 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const (
+	deliveriesFile  = "deliveries"
+	maxDeliveries   = 500  // 日志里最多保留多少条投递记录
+	maxResponseBody = 4096 // 响应体最多记录多少字节
+)
+
+// ErrDeliveryNotFound 投递记录不存在
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// Dispatcher 负责签名、投递、重试 Webhook，并把每次投递持久化到日志里
+// 除了仓库级别的订阅外，还有一个系统级的目标（OpsEngine），它只关心 push 和 release 事件
+type Dispatcher struct {
+	store  *store.Store
+	hooks  *Registry
+	client *http.Client // 系统级目标（OpsEngine），通常就在本机或内网
+	// hookClient 仓库订阅，默认不允许访问内网地址
+	hookClient *http.Client
+	systemURL  string
+	secret     string
+
+	// AllowPrivateTargets 允许仓库订阅投递到内网、回环和链路本地地址，默认禁止
+	AllowPrivateTargets bool
+
+	MaxAttempts int           // 最多尝试次数（包含第一次）
+	BaseBackoff time.Duration // 第一次重试前的等待时间，之后每次翻倍
+
+	mu         sync.Mutex
+	deliveries map[string]*Delivery
+	saveMu     sync.Mutex // 保证写盘顺序与内存状态一致
+}
+
+// NewDispatcher 创建投递器，并从 store 中加载历史投递日志
+// systemURL 为空时不通知 OpsEngine，只投递仓库级别的订阅
+func NewDispatcher(st *store.Store, hooks *Registry, systemURL, secret string) (*Dispatcher, error) {
+	d := &Dispatcher{
+		store:       st,
+		hooks:       hooks,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		systemURL:   systemURL,
+		secret:      secret,
+		MaxAttempts: 5,
+		BaseBackoff: 2 * time.Second,
+		deliveries:  make(map[string]*Delivery),
+	}
+	d.hookClient = d.newHookClient()
+	var saved []*Delivery
+	if err := st.Load(deliveriesFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, dl := range saved {
+		d.deliveries[dl.ID] = dl
+	}
+	// 上次进程退出时还没投递完的记录，启动后继续投递
+	for _, dl := range saved {
+		if dl.Status == StatusPending {
+			go d.deliver(dl)
+		}
+	}
+	return d, nil
+}
+
+// Publish 把一个仓库事件扇出给所有订阅方，每个订阅方一条独立的投递记录
+// 投递在后台异步进行，不阻塞调用方
+func (d *Dispatcher) Publish(repo, event string, payload any) ([]*Delivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []*Delivery
+	if d.systemURL != "" && (event == types.EventPush || event == types.EventRelease) {
+		targets = append(targets, &Delivery{URL: d.systemURL})
+	}
+	for _, h := range d.hooks.Matching(repo, event) {
+		targets = append(targets, &Delivery{HookID: h.ID, URL: h.URL})
+	}
+
+	var list []*Delivery
+	for _, dl := range targets {
+		dl.ID = utils.RandomID(16)
+		dl.Repo = repo
+		dl.Event = event
+		dl.Payload = body
+		dl.Status = StatusPending
+		dl.CreatedAt = time.Now()
+
+		d.mu.Lock()
+		d.deliveries[dl.ID] = dl
+		d.mu.Unlock()
+		list = append(list, d.snapshot(dl))
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	d.persist()
+
+	for _, dl := range targets {
+		go d.deliver(dl)
+	}
+	return list, nil
+}
+
+// PublishRefUpdate 把一条引用更新翻译成对应的事件并投递
+// 推送、合并请求以外，镜像从上游拉到的更新也走这里，事件格式保持一致
+func (d *Dispatcher) PublishRefUpdate(repo string, u types.RefUpdate, pusher string) {
+	payload := types.WebhookPayload{
+		RepoName: repo,
+		Ref:      u.Ref,
+		Before:   u.OldSHA,
+		CommitID: u.NewSHA,
+		Created:  u.IsCreate(),
+		Deleted:  u.IsDelete(),
+		Pusher:   pusher,
+	}
+	switch {
+	case u.IsTag():
+		payload.Tag = u.ShortName()
+		d.publishLogged(repo, types.EventTag, payload)
+	case u.IsBranch():
+		payload.Branch = u.ShortName()
+		if u.IsDelete() {
+			d.publishLogged(repo, types.EventBranchDelete, payload)
+			return
+		}
+		if u.IsCreate() {
+			d.publishLogged(repo, types.EventBranchCreate, payload)
+		}
+		d.publishLogged(repo, types.EventPush, payload)
+	}
+}
+
+// publishLogged 投递事件，结果只记日志
+func (d *Dispatcher) publishLogged(repo, event string, payload types.WebhookPayload) {
+	payload.Event = event
+	list, err := d.Publish(repo, event, payload)
+	if err != nil {
+		log.Printf("❌ Failed to send webhook: %v", err)
+		return
+	}
+	for _, dl := range list {
+		log.Printf("📨 Webhook %s (%s) queued for %s -> %s", dl.ID, event, repo, dl.URL)
+	}
+}
+
+// Redeliver 重新投递一条历史记录，沿用原来的投递 ID 和请求体
+func (d *Dispatcher) Redeliver(id string) (*Delivery, error) {
+	d.mu.Lock()
+	dl, ok := d.deliveries[id]
+	if ok {
+		if dl.Status == StatusPending {
+			d.mu.Unlock()
+			return nil, fmt.Errorf("delivery %s is still in progress", id)
+		}
+		dl.Status = StatusPending
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	d.persist()
+
+	go d.deliver(dl)
+	return d.snapshot(dl), nil
+}
+
+// Get 查询单条投递记录
+func (d *Dispatcher) Get(id string) (*Delivery, bool) {
+	d.mu.Lock()
+	dl, ok := d.deliveries[id]
+	d.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return d.snapshot(dl), true
+}
+
+// List 按时间倒序列出投递记录，hookID 不为空时只列出该订阅的记录
+func (d *Dispatcher) List(hookID string) []*Delivery {
+	d.mu.Lock()
+	list := make([]*Delivery, 0, len(d.deliveries))
+	for _, dl := range d.deliveries {
+		if hookID == "" || dl.HookID == hookID {
+			list = append(list, dl)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	for i, dl := range list {
+		list[i] = d.snapshot(dl)
+	}
+	return list
+}
+
+// deliver 带指数退避的重试循环
+func (d *Dispatcher) deliver(dl *Delivery) {
+	backoff := d.BaseBackoff
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		result, retry := d.send(dl)
+
+		d.mu.Lock()
+		dl.Attempts = append(dl.Attempts, result)
+		switch {
+		case result.StatusCode >= 200 && result.StatusCode < 300:
+			dl.Status = StatusDelivered
+		case !retry || attempt == d.MaxAttempts:
+			dl.Status = StatusFailed
+		}
+		status := dl.Status
+		d.mu.Unlock()
+		d.persist()
+
+		if status == StatusDelivered {
+			log.Printf("✅ Webhook %s delivered to %s (%d)", dl.ID, dl.URL, result.StatusCode)
+			return
+		}
+		if status == StatusFailed {
+			log.Printf("❌ Webhook %s to %s failed after %d attempt(s)", dl.ID, dl.URL, attempt)
+			return
+		}
+		log.Printf("⚠️ Webhook %s attempt %d failed, retrying in %s", dl.ID, attempt, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send 发送一次请求，返回结果以及是否值得重试
+func (d *Dispatcher) send(dl *Delivery) (Attempt, bool) {
+	// 系统级目标使用全局密钥，仓库订阅使用各自的密钥和格式
+	secret, contentType, client := d.secret, ContentTypeJSON, d.client
+	if dl.HookID != "" {
+		h, ok := d.hooks.Get(dl.HookID)
+		if !ok {
+			return Attempt{Error: ErrHookNotFound.Error(), Time: time.Now()}, false
+		}
+		secret, contentType, client = h.Secret, h.ContentType, d.hookClient
+	}
+
+	body, mime := []byte(dl.Payload), "application/json"
+	if contentType == ContentTypeForm {
+		body = []byte(url.Values{"payload": {string(dl.Payload)}}.Encode())
+		mime = "application/x-www-form-urlencoded"
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, dl.URL, bytes.NewReader(body))
+	if err != nil {
+		return Attempt{Error: err.Error(), Time: time.Now()}, false
+	}
+	req.Header.Set("Content-Type", mime)
+	req.Header.Set("User-Agent", "DevNexus-CodeVault")
+	req.Header.Set(types.HeaderEvent, dl.Event)
+	req.Header.Set(types.HeaderDelivery, dl.ID)
+	req.Header.Set(types.HeaderTimestamp, fmt.Sprintf("%d", timestamp))
+	if secret != "" {
+		req.Header.Set(types.HeaderSignature, utils.SignPayload(secret, timestamp, body))
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result := Attempt{Time: start, Latency: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+		// 被禁止的地址重试也没用
+		return result, !errors.Is(err, ErrForbiddenTarget)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	result.StatusCode = resp.StatusCode
+	result.ResponseBody = string(respBody)
+	result.Latency = time.Since(start)
+
+	// 5xx、408、429 认为是暂时性错误，其余 4xx（比如签名校验失败）重试也没用
+	retry := resp.StatusCode >= 500 || resp.StatusCode == 408 || resp.StatusCode == 429
+	return result, retry
+}
+
+// persist 把投递日志写回磁盘，只保留最近 maxDeliveries 条
+func (d *Dispatcher) persist() {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+
+	d.mu.Lock()
+	list := make([]*Delivery, 0, len(d.deliveries))
+	for _, dl := range d.deliveries {
+		list = append(list, dl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	if len(list) > maxDeliveries {
+		for _, dl := range list[maxDeliveries:] {
+			delete(d.deliveries, dl.ID)
+		}
+		list = list[:maxDeliveries]
+	}
+	data, err := json.Marshal(list)
+	d.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to encode delivery log: %v", err)
+		return
+	}
+	if err := d.store.Save(deliveriesFile, json.RawMessage(data)); err != nil {
+		log.Printf("Failed to save delivery log: %v", err)
+	}
+}
+
+// snapshot 复制一份记录返回给调用方，避免和投递协程产生数据竞争
+func (d *Dispatcher) snapshot(dl *Delivery) *Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cp := *dl
+	cp.Attempts = append([]Attempt(nil), dl.Attempts...)
+	return &cp
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/internal/codevault/store"
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+const hooksFile = "hooks"
+
+// 投递时使用的请求体格式
+const (
+	ContentTypeJSON = "json" // application/json
+	ContentTypeForm = "form" // application/x-www-form-urlencoded，payload=<json>
+)
+
+// ErrHookNotFound Webhook 订阅不存在
+var ErrHookNotFound = errors.New("hook not found")
+
+// allEvents 可以订阅的事件
+var allEvents = map[string]bool{
+	types.EventPush:         true,
+	types.EventTag:          true,
+	types.EventBranchCreate: true,
+	types.EventBranchDelete: true,
+	types.EventRepoCreate:   true,
+	types.EventRepoCorrupt:  true,
+	types.EventRelease:      true,
+}
+
+// Hook 仓库级别的 Webhook 订阅
+type Hook struct {
+	ID          string    `json:"id"`
+	Repo        string    `json:"repo"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	ContentType string    `json:"content_type"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subscribed 判断订阅是否关心某个事件
+func (h *Hook) Subscribed(event string) bool {
+	if !h.Active {
+		return false
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted 返回去掉密钥的副本，用于 API 输出
+func (h *Hook) Redacted() *Hook {
+	cp := *h
+	cp.Secret = ""
+	cp.Events = append([]string(nil), h.Events...)
+	return &cp
+}
+
+// Registry 管理所有仓库的 Webhook 订阅
+type Registry struct {
+	store *store.Store
+
+	mu    sync.Mutex
+	hooks map[string]*Hook
+}
+
+// NewRegistry 创建订阅表并从 store 中加载
+func NewRegistry(st *store.Store) (*Registry, error) {
+	reg := &Registry{store: st, hooks: make(map[string]*Hook)}
+	var saved []*Hook
+	if err := st.Load(hooksFile, &saved); err != nil {
+		return nil, err
+	}
+	for _, h := range saved {
+		reg.hooks[h.ID] = h
+	}
+	return reg, nil
+}
+
+// Create 校验并保存一个新的订阅
+func (reg *Registry) Create(h Hook) (*Hook, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid hook url: %q", h.URL)
+	}
+	switch h.ContentType {
+	case "":
+		h.ContentType = ContentTypeJSON
+	case ContentTypeJSON, ContentTypeForm:
+	default:
+		return nil, fmt.Errorf("unsupported content type: %q", h.ContentType)
+	}
+	if len(h.Events) == 0 {
+		h.Events = []string{types.EventPush}
+	}
+	for _, e := range h.Events {
+		if !allEvents[e] {
+			return nil, fmt.Errorf("unknown event: %q", e)
+		}
+	}
+
+	h.ID = utils.RandomID(8)
+	h.Repo = utils.NormalizeRepoName(h.Repo)
+	h.CreatedAt = time.Now()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.hooks[h.ID] = &h
+	cp := h
+	return &cp, reg.saveLocked()
+}
+
+// Get 按 ID 查询订阅
+func (reg *Registry) Get(id string) (*Hook, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	h, ok := reg.hooks[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *h
+	return &cp, true
+}
+
+// List 列出某个仓库的所有订阅
+func (reg *Registry) List(repo string) []*Hook {
+	repo = utils.NormalizeRepoName(repo)
+	reg.mu.Lock()
+	var list []*Hook
+	for _, h := range reg.hooks {
+		if h.Repo == repo {
+			cp := *h
+			list = append(list, &cp)
+		}
+	}
+	reg.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete 删除订阅，repo 必须匹配，防止跨仓库误删
+func (reg *Registry) Delete(repo, id string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	h, ok := reg.hooks[id]
+	if !ok || h.Repo != utils.NormalizeRepoName(repo) {
+		return ErrHookNotFound
+	}
+	delete(reg.hooks, id)
+	return reg.saveLocked()
+}
+
+// Matching 找出某个仓库中订阅了 event 的所有 Hook
+func (reg *Registry) Matching(repo, event string) []*Hook {
+	var list []*Hook
+	for _, h := range reg.List(repo) {
+		if h.Subscribed(event) {
+			list = append(list, h)
+		}
+	}
+	return list
+}
+
+// RenameRepo 仓库改名时迁移它的订阅
+func (reg *Registry) RenameRepo(oldName, newName string) error {
+	oldName, newName = utils.NormalizeRepoName(oldName), utils.NormalizeRepoName(newName)
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, h := range reg.hooks {
+		if h.Repo == oldName {
+			h.Repo = newName
+		}
+	}
+	return reg.saveLocked()
+}
+
+// DeleteRepo 仓库被删除时清理它的订阅
+func (reg *Registry) DeleteRepo(repo string) error {
+	repo = utils.NormalizeRepoName(repo)
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for id, h := range reg.hooks {
+		if h.Repo == repo {
+			delete(reg.hooks, id)
+		}
+	}
+	return reg.saveLocked()
+}
+
+// saveLocked 写回磁盘，调用方必须持有 reg.mu
+func (reg *Registry) saveLocked() error {
+	list := make([]*Hook, 0, len(reg.hooks))
+	for _, h := range reg.hooks {
+		list = append(list, h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return reg.store.Save(hooksFile, list)
+}
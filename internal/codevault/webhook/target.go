@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget 仓库订阅的地址解析到了内网、回环或链路本地地址
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// forbiddenIP 仓库管理员不能让 CodeVault 去访问的地址：回环、内网、链路本地（包括云平台的元数据地址）等
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// newHookClient 投递仓库订阅用的客户端
+// 在建立连接时检查的是 DNS 解析后的实际地址，域名解析到内网、或者重定向到内网地址都会被拦住
+// 不走 HTTP_PROXY：经过代理时连接的是代理地址，没法检查真正的目标
+func (d *Dispatcher) newHookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if d.AllowPrivateTargets {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StatusContext OpsEngine 上报提交状态时使用的 context，分支保护里可以把它设为必需
+const StatusContext = "opsengine/pipeline"
+
+// ReleaseContext 发布触发的流水线使用单独的 context，不会覆盖同一个提交上 push 流水线的结果
+const ReleaseContext = "opsengine/release"
+
+// StatusReporter 把流水线结果作为提交状态上报给 CodeVault
+type StatusReporter struct {
+	BaseURL  string // 例如 http://localhost:8080
+	Username string
+	Token    string
+	client   *http.Client
+}
+
+// NewStatusReporter 创建上报器
+func NewStatusReporter(baseURL, username, token string) *StatusReporter {
+	return &StatusReporter{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		Username: username,
+		Token:    token,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Report 上报状态：pending / success / failure / error，targetURL 指向这次运行，可以为空
+func (s *StatusReporter) Report(repo, sha, context, state, description, targetURL string) error {
+	body, _ := json.Marshal(map[string]string{
+		"state":       state,
+		"context":     context,
+		"description": description,
+		"target_url":  targetURL,
+	})
+	url := fmt.Sprintf("%s/api/repos/%s/statuses/%s", s.BaseURL, repo, sha)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status API returned %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
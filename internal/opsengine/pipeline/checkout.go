@@ -0,0 +1,192 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// CheckoutOptions 检出代码的方式，对应 OpsEngine 的 OPSENGINE_CHECKOUT_* 环境变量
+type CheckoutOptions struct {
+	Depth       int      // 浅克隆深度，<=0 时拉取完整历史
+	SparsePaths []string // 只检出这些目录（cone 模式，根目录下的文件总会检出），为空时检出全部
+	Submodules  bool     // 是否递归初始化子模块
+	MirrorDir   string   // 每个仓库一份的镜像缓存目录，新工作区用它做 --reference，为空时不使用
+}
+
+// mirrorLocks 同一个仓库的镜像同时只能有一个 git fetch 在更新
+var (
+	mirrorLocksMu sync.Mutex
+	mirrorLocks   = map[string]*sync.Mutex{}
+)
+
+func mirrorLock(path string) *sync.Mutex {
+	mirrorLocksMu.Lock()
+	defer mirrorLocksMu.Unlock()
+	mu, ok := mirrorLocks[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		mirrorLocks[path] = mu
+	}
+	return mu
+}
+
+// runGit 在 dir 下执行 git，出错时带上输出；输出里可能有仓库地址，先隐藏密码
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// 不要在服务器上卡在输入用户名密码的提示上
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s failed: %v, output: %s", args[0], err, redactOutput(string(out)))
+	}
+	return nil
+}
+
+// Checkout 把 commitID 检出到空目录 workDir：只拉取需要的那一个提交，而不是克隆整个仓库
+// ref 是推送的分支（例如 refs/heads/main），服务端不允许直接按 SHA 拉取时用它兜底
+func Checkout(repoURL, ref, commitID, workDir string, opts CheckoutOptions) error {
+	// 1.更新镜像缓存，失败不影响构建，只是退回到直接从 CodeVault 拉取
+	mirror := ""
+	if opts.MirrorDir != "" {
+		path, err := updateMirror(repoURL, opts.MirrorDir)
+		if err != nil {
+			log.Printf("⚠️ 镜像缓存更新失败，直接从远端拉取: %v", err)
+		} else {
+			mirror = path
+		}
+	}
+
+	// 2.初始化工作区，把镜像的对象库挂成 alternates（和 git clone --reference 的效果一样）
+	if err := runGit(workDir, "init", "-q"); err != nil {
+		return err
+	}
+	if err := runGit(workDir, "remote", "add", "origin", repoURL); err != nil {
+		return err
+	}
+	if mirror != "" {
+		alternates := filepath.Join(workDir, ".git", "objects", "info", "alternates")
+		if err := os.WriteFile(alternates, []byte(filepath.Join(mirror, "objects")+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to set reference repository: %v", err)
+		}
+	}
+
+	// 3.拉取要构建的提交：镜像里已经有了就不用再走网络
+	target := commitID
+	if target == "" {
+		target = ref
+	}
+	if target == "" {
+		target = "HEAD"
+	}
+	if commitID == "" || mirror == "" || runGit(workDir, "cat-file", "-e", commitID+"^{commit}") != nil {
+		if err := fetchCommit(workDir, ref, target, opts.Depth); err != nil {
+			return err
+		}
+	}
+
+	// 4.稀疏检出：只展开需要的目录，根目录的 .devnexus.yaml 在 cone 模式下总会被检出
+	if len(opts.SparsePaths) > 0 {
+		args := append([]string{"sparse-checkout", "set", "--cone", "--"}, opts.SparsePaths...)
+		if err := runGit(workDir, args...); err != nil {
+			return err
+		}
+	}
+
+	// 5.检出，commitID 为空时检出刚拉下来的分支
+	if commitID == "" {
+		target = "FETCH_HEAD"
+	}
+	if err := runGit(workDir, "-c", "advice.detachedHead=false", "checkout", "-q", target); err != nil {
+		return err
+	}
+
+	// 6.子模块用同样的深度拉取
+	if opts.Submodules {
+		args := []string{"submodule", "update", "--init", "--recursive"}
+		if opts.Depth > 0 {
+			args = append(args, fmt.Sprintf("--depth=%d", opts.Depth))
+		}
+		if err := runGit(workDir, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchCommit 按 SHA 浅拉取一个提交；服务端没有开启 uploadpack.allowReachableSHA1InWant 时
+// 会报 not our ref，这时改成拉取整个分支，再确认提交在不在里面
+func fetchCommit(workDir, ref, target string, depth int) error {
+	args := []string{"fetch", "-q", "--no-tags"}
+	if depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", depth))
+	}
+	err := runGit(workDir, append(args, "origin", target)...)
+	if err == nil || ref == "" || ref == target {
+		return err
+	}
+	log.Printf("⚠️ 按提交拉取失败，改为拉取 %s: %v", ref, err)
+
+	// 推送之后分支可能又有了新提交，浅拉取的深度不一定够，直接拉完整的分支历史
+	if err := runGit(workDir, "fetch", "-q", "--no-tags", "origin", ref); err != nil {
+		return err
+	}
+	if err := runGit(workDir, "cat-file", "-e", target+"^{commit}"); err != nil {
+		return fmt.Errorf("commit %s is not on %s", target, ref)
+	}
+	return nil
+}
+
+// updateMirror 创建或增量更新仓库的裸镜像，返回镜像路径
+// 远端地址每次在命令行上传入，不写进镜像的配置文件，避免令牌落盘
+func updateMirror(repoURL, mirrorDir string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repo url: %v", err)
+	}
+	name := strings.Trim(filepath.Clean("/"+u.Path), "/")
+	if name == "" {
+		return "", fmt.Errorf("invalid repo url: %s", redactURL(repoURL))
+	}
+	path, err := filepath.Abs(filepath.Join(mirrorDir, u.Host, name))
+	if err != nil {
+		return "", err
+	}
+
+	mu := mirrorLock(path)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return "", err
+		}
+		if err := runGit(path, "init", "-q", "--bare"); err != nil {
+			return "", err
+		}
+		fmt.Printf("🪞 已创建镜像缓存: %s\n", path)
+	}
+	err = runGit(path, "fetch", "-q", "--prune", "--no-tags", repoURL,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// redactOutput 隐藏 git 输出里的仓库地址密码
+func redactOutput(out string) string {
+	fields := strings.Fields(out)
+	for _, f := range fields {
+		f = strings.Trim(f, "'\".,:")
+		if strings.Contains(f, "://") && strings.Contains(f, "@") {
+			out = strings.ReplaceAll(out, f, redactURL(f))
+		}
+	}
+	return strings.TrimSpace(out)
+}
@@ -1,9 +1,16 @@
 package pipeline
 
+import "github.com/chanslights/DevNexus/pkg/types"
+
 // PipelineConfig 对应 .devnexus.yaml 的顶层结构
 type PipelineConfig struct {
-	Name   string  `yaml:"name"`   // 流水线名字
-	Stages []Stage `yaml:"stages"` // 包含哪些阶段
+	Name   string   `yaml:"name"`   // 流水线名字
+	On     []string `yaml:"on"`     // 触发流水线的事件：push、release，不写时只在 push 时触发
+	Stages []Stage  `yaml:"stages"` // 包含哪些阶段
+
+	// Artifacts 流水线成功后保留的制品，相对仓库根目录的 glob，例如 dist/*.tar.gz
+	// 发布时可以把它们添加为发布的附件
+	Artifacts []string `yaml:"artifacts"`
 }
 
 type Stage struct {
@@ -11,7 +18,30 @@ type Stage struct {
 	Type   string   `yaml:"type"`
 	Image  string   `yaml:"image"`  // TODO：指定用哪个Docker镜像跑
 	Script []string `yaml:"script"` // 要执行的Shell命令列表
+	On     []string `yaml:"on"`     // 只在这些事件时执行，不写时每次都执行
 
 	Target   string `yaml:"target"`
 	NewImage string `yaml:"new_image"`
 }
+
+// Triggers 事件是否触发流水线
+func (c *PipelineConfig) Triggers(event string) bool {
+	if len(c.On) == 0 {
+		return event == types.EventPush
+	}
+	return contains(c.On, event)
+}
+
+// RunsOn 阶段在这个事件触发的流水线里是否执行
+func (s *Stage) RunsOn(event string) bool {
+	return len(s.On) == 0 || contains(s.On, event)
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
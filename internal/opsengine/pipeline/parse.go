@@ -1,18 +1,23 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
 
+// ErrNoConfig 仓库里没有 .devnexus.yaml
+var ErrNoConfig = errors.New("repo missing .devnexus.yaml")
+
 // FetchAndParse 核心函数：拉取代码并解析配置
-// repoURL: http://localhost:8080/demo.git
+// repoURL: http://localhost:8080/alice/demo.git
+// ref: 推送的分支，例如 refs/heads/main
 // commitID: 刚才 Webhook 传过来的 ID
-func FetchAndParse(repoURL string, commitID string) (*PipelineConfig, string, error) {
+func FetchAndParse(repoURL, ref, commitID string, opts CheckoutOptions) (*PipelineConfig, string, error) {
 	// 1.创建临时目录，用于存放代码
 	// 类似于：/tmp/devnexus-build-123456
 	workDir, err := os.MkdirTemp("", "devexus-build-*")
@@ -23,28 +28,19 @@ func FetchAndParse(repoURL string, commitID string) (*PipelineConfig, string, er
 	// 这里为了方便你调试观察，我们先保留目录，不删除
 	fmt.Printf("📂 工作空间已创建: %s\n", workDir)
 
-	// 2.Clone代码
+	// 2.拉取代码并检出到指定的Commit ID，保证我们要构建的是用户刚刚Push的那个版本
 	// 这一步证明CodeVault在工作，OpsEngine像一个普通用户一样去拉取代码
-	fmt.Printf("⬇️ 正在从 %s 拉取代码...\n", repoURL)
-	cmd := exec.Command("git", "clone", repoURL, workDir)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return nil, workDir, fmt.Errorf("git clone failed: %s, output: %s", err, out)
-	}
-
-	// 3.（可选）Checkout到指定的Commit ID,保证我们要构建的是用户刚刚Push的那个版本
-	if commitID != "" {
-		checkoutCmd := exec.Command("git", "checkout", commitID)
-		checkoutCmd.Dir = workDir
-		if err := checkoutCmd.Run(); err != nil {
-			return nil, workDir, fmt.Errorf("git checkout failed: %v", err)
-		}
+	// 只拉取这一个提交（加上镜像缓存），大仓库不用每次都克隆完整历史
+	fmt.Printf("⬇️ 正在从 %s 拉取代码...\n", redactURL(repoURL))
+	if err := Checkout(repoURL, ref, commitID, workDir, opts); err != nil {
+		return nil, workDir, fmt.Errorf("checkout failed: %v", err)
 	}
 
 	// 4.读取.devnexus.yaml
 	configPath := filepath.Join(workDir, ".devnexus.yaml")
 	data, err := os.ReadFile(configPath)
 	if os.IsNotExist(err) {
-		return nil, workDir, fmt.Errorf("repo missing .devnexus.yaml")
+		return nil, workDir, ErrNoConfig
 	} else if err != nil {
 		return nil, workDir, fmt.Errorf("failed to read config: %v", err)
 	}
@@ -55,3 +51,12 @@ func FetchAndParse(repoURL string, commitID string) (*PipelineConfig, string, er
 	}
 	return &config, workDir, nil
 }
+
+// redactURL 隐藏地址里的密码/令牌，避免打到日志里
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
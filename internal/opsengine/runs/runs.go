@@ -0,0 +1,208 @@
+package runs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// 运行状态，和上报给 CodeVault 的提交状态一致
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailure = "failure"
+	StateError   = "error"
+)
+
+var (
+	// ErrNotFound 运行或制品不存在
+	ErrNotFound = errors.New("run not found")
+
+	idPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// Run 一次流水线运行
+type Run struct {
+	ID         string     `json:"id"`
+	Repo       string     `json:"repo"`
+	Event      string     `json:"event"`
+	Ref        string     `json:"ref"`
+	Commit     string     `json:"commit"`
+	State      string     `json:"state"`
+	Artifacts  []Artifact `json:"artifacts"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Artifact 流水线成功后保留下来的文件
+type Artifact struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Store 运行记录和制品：<dir>/<id>/run.json，制品在 <dir>/<id>/artifacts/<name>
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore 创建存储
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run dir: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create 记录一次新的运行
+func (s *Store) Create(repo, event, ref, commit string) (*Run, error) {
+	run := &Run{
+		ID:        utils.RandomID(8),
+		Repo:      repo,
+		Event:     event,
+		Ref:       ref,
+		Commit:    commit,
+		State:     StatePending,
+		Artifacts: []Artifact{},
+		CreatedAt: time.Now(),
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, run.ID), 0755); err != nil {
+		return nil, err
+	}
+	return run, s.save(run)
+}
+
+// Finish 记录运行结果
+func (s *Store) Finish(run *Run, state string) error {
+	now := time.Now()
+	run.State = state
+	run.FinishedAt = &now
+	return s.save(run)
+}
+
+// Get 查询运行
+func (s *Store) Get(id string) (*Run, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(filepath.Join(s.dir, id, "run.json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// OpenArtifact 打开制品用于下载，调用方负责关闭
+func (s *Store) OpenArtifact(id, name string) (*os.File, error) {
+	run, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range run.Artifacts {
+		if a.Name == name {
+			return os.Open(filepath.Join(s.dir, id, "artifacts", a.Name))
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Collect 把工作区里匹配 patterns 的文件复制出来作为制品
+// 只收集普通文件，不跟随指向工作区外面的符号链接；制品按文件名保存，重名时后面的跳过
+func (s *Store) Collect(run *Run, workDir string, patterns []string) error {
+	root, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(s.dir, run.ID, "artifacts")
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		if filepath.IsAbs(pattern) {
+			return fmt.Errorf("artifact pattern %q must be relative to the repository", pattern)
+		}
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return fmt.Errorf("invalid artifact pattern %q: %v", pattern, err)
+		}
+		for _, match := range matches {
+			path, err := filepath.EvalSymlinks(match)
+			if err != nil || !strings.HasPrefix(path, root+string(filepath.Separator)) {
+				continue
+			}
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			name := filepath.Base(match)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			a, err := copyArtifact(path, filepath.Join(dest, name))
+			if err != nil {
+				return fmt.Errorf("failed to collect artifact %s: %v", name, err)
+			}
+			a.Name = name
+			run.Artifacts = append(run.Artifacts, a)
+		}
+	}
+	return s.save(run)
+}
+
+// copyArtifact 复制文件并计算大小和 sha256
+func copyArtifact(src, dst string) (Artifact, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return Artifact{}, err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return Artifact{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// save 写 run.json，先写临时文件再改名
+func (s *Store) save(run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, run.ID, "run.json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chanslights/DevNexus/pkg/types"
+	"github.com/chanslights/DevNexus/pkg/utils"
+)
+
+// ErrNoSecret 没有配置密钥，也没有显式允许不签名的请求
+var ErrNoSecret = errors.New("webhook secret is not configured")
+
+// Guard 校验 CodeVault 发来的 Webhook：签名、时间戳以及重放
+type Guard struct {
+	secret    string
+	tolerance time.Duration // 允许的时间偏差，超出即视为过期请求
+
+	// AllowUnsigned 没有密钥时放行所有请求，只用于本地调试；默认拒绝
+	AllowUnsigned bool
+
+	mu   sync.Mutex
+	seen map[string]time.Time // 已经处理过的签名 -> 时间戳，用于拒绝重放
+}
+
+// NewGuard 创建校验器，secret 为空时拒绝所有请求，除非设置了 AllowUnsigned
+func NewGuard(secret string) *Guard {
+	return &Guard{
+		secret:    secret,
+		tolerance: 5 * time.Minute,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Verify 校验请求头与请求体，返回 nil 表示可以放行
+func (g *Guard) Verify(r *http.Request, body []byte) error {
+	if g.secret == "" {
+		return g.unsigned()
+	}
+
+	// 1. 时间戳必须在容忍窗口内
+	ts, err := strconv.ParseInt(r.Header.Get(types.HeaderTimestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s header", types.HeaderTimestamp)
+	}
+	sentAt := time.Unix(ts, 0)
+	if d := time.Since(sentAt); d > g.tolerance || d < -g.tolerance {
+		return fmt.Errorf("timestamp outside of tolerance window")
+	}
+
+	// 2. 签名校验
+	signature := r.Header.Get(types.HeaderSignature)
+	if !utils.VerifySignature(g.secret, signature, ts, body) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	// 3. 同一个签名只接受一次
+	// 重投时 CodeVault 会用新的时间戳重新签名，所以正常重试不会被拦截
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune()
+	if _, ok := g.seen[signature]; ok {
+		return fmt.Errorf("replayed request")
+	}
+	g.seen[signature] = sentAt
+	return nil
+}
+
+// unsigned 没有密钥时的处理
+func (g *Guard) unsigned() error {
+	if g.AllowUnsigned {
+		return nil
+	}
+	return ErrNoSecret
+}
+
+// VerifyRequest 校验 CodeVault 拉取运行和制品的 GET 请求，签名内容是 "方法 路径"
+// GET 请求没有副作用，只校验签名和时间戳，不做重放检查
+func (g *Guard) VerifyRequest(r *http.Request) error {
+	if g.secret == "" {
+		return g.unsigned()
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(types.HeaderTimestamp), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s header", types.HeaderTimestamp)
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > g.tolerance || d < -g.tolerance {
+		return fmt.Errorf("timestamp outside of tolerance window")
+	}
+	expected := utils.SignRequest(g.secret, ts, r.Method, r.URL.EscapedPath())
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(types.HeaderSignature))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// prune 清理已经超出容忍窗口的签名，超出窗口的请求本来就会被时间戳校验拒绝
+func (g *Guard) prune() {
+	for sig, sentAt := range g.seen {
+		if time.Since(sentAt) > g.tolerance {
+			delete(g.seen, sig)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package types
+
+import "strings"
+
+// ZeroSHA 新建或删除引用时，git 用全 0 表示不存在的一端
+const ZeroSHA = "0000000000000000000000000000000000000000"
+
+// RefUpdate git push 时客户端发来的一条引用更新命令
+// 格式：<old-sha> <new-sha> <ref-name>
+type RefUpdate struct {
+	OldSHA string `json:"old_sha"`
+	NewSHA string `json:"new_sha"`
+	Ref    string `json:"ref"`
+}
+
+// IsCreate 引用是否是新建的
+func (u RefUpdate) IsCreate() bool { return u.OldSHA == ZeroSHA }
+
+// IsDelete 引用是否被删除
+func (u RefUpdate) IsDelete() bool { return u.NewSHA == ZeroSHA }
+
+// IsBranch 是否是分支
+func (u RefUpdate) IsBranch() bool { return strings.HasPrefix(u.Ref, "refs/heads/") }
+
+// IsTag 是否是标签
+func (u RefUpdate) IsTag() bool { return strings.HasPrefix(u.Ref, "refs/tags/") }
+
+// ShortName 去掉 refs/heads/ 或 refs/tags/ 前缀后的名字
+func (u RefUpdate) ShortName() string {
+	return strings.TrimPrefix(strings.TrimPrefix(u.Ref, "refs/heads/"), "refs/tags/")
+}
@@ -1,9 +1,50 @@
 package types
 
-// Web
+// Webhook 相关的 HTTP 头
+const (
+	HeaderSignature = "X-DevNexus-Signature" // sha256=<hex>，对 "时间戳.请求体" 的 HMAC
+	HeaderTimestamp = "X-DevNexus-Timestamp" // 发送时的 Unix 时间戳（秒）
+	HeaderDelivery  = "X-DevNexus-Delivery"  // 投递 ID，重投时保持不变
+	HeaderEvent     = "X-DevNexus-Event"     // 事件类型，例如 push
+)
+
+// Webhook 事件类型
+const (
+	EventPush         = "push"          // 分支有新的提交（包含新建分支）
+	EventTag          = "tag"           // 标签创建或删除
+	EventBranchCreate = "branch_create" // 新建分支
+	EventBranchDelete = "branch_delete" // 删除分支
+	EventRepoCreate   = "repo_create"   // 新建仓库
+	EventRepoCorrupt  = "repo_corrupt"  // 定期 fsck 发现仓库损坏
+	EventRelease      = "release"       // 发布版本或删除发布
+)
+
+// release 事件的动作
+const (
+	ReleasePublished = "published"
+	ReleaseDeleted   = "deleted"
+)
+
+// WebhookPayload CodeVault 推送给 OpsEngine 等订阅方的事件
 type WebhookPayload struct {
-	RepoName string `json:"repo_name"` // 仓库名
-	Branch   string `json:"branch"`    // 分支
-	CommitID string `json:"commit_id"` // 最新的Commit SHA
-	Pusher   string `json:"pusher"`    // 推送人
+	Event    string `json:"event"`             // 事件类型
+	RepoName string `json:"repo_name"`         // 仓库名
+	Ref      string `json:"ref,omitempty"`     // 完整引用名，例如 refs/heads/main
+	Branch   string `json:"branch"`            // 分支
+	Tag      string `json:"tag,omitempty"`     // 标签名（tag 事件）
+	Before   string `json:"before,omitempty"`  // 更新前的 SHA
+	CommitID string `json:"commit_id"`         // 最新的Commit SHA
+	Created  bool   `json:"created,omitempty"` // 引用是否是新建的
+	Deleted  bool   `json:"deleted,omitempty"` // 引用是否被删除
+	Pusher   string `json:"pusher"`            // 推送人
+
+	Action  string       `json:"action,omitempty"`  // release 事件的动作：published / deleted
+	Release *ReleaseInfo `json:"release,omitempty"` // release 事件的发布信息
+}
+
+// ReleaseInfo release 事件里的发布信息，标签和提交在 Tag / CommitID 里
+type ReleaseInfo struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Prerelease bool   `json:"prerelease"`
 }
@@ -0,0 +1,11 @@
+package utils
+
+import "os"
+
+// GetEnv 读取环境变量，未设置时返回默认值
+func GetEnv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
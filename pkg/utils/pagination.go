@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Pagination 解析 ?page=&per_page=，默认第 1 页每页 30 条，最多 100 条
+func Pagination(r *http.Request) (page, perPage int) {
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ = strconv.Atoi(r.URL.Query().Get("per_page"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 30
+	}
+	return page, min(perPage, 100)
+}
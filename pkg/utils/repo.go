@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ownerPattern 用户名和组织名的格式，它们会成为 URL 和磁盘路径的第一级
+var ownerPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,38}$`)
+
+// reservedOwners 和顶层路由冲突的名字，不能用作用户名或组织名
+var reservedOwners = map[string]bool{"api": true}
+
+// ValidateOwner 检查用户名或组织名能否作为仓库的所有者
+// 以 .git 结尾的名字和老的 /demo.git/... 地址分不开，也不允许
+func ValidateOwner(name string) error {
+	if !ownerPattern.MatchString(name) || strings.HasSuffix(name, ".git") || reservedOwners[strings.ToLower(name)] {
+		return fmt.Errorf("invalid owner name: %q", name)
+	}
+	return nil
+}
+
+// NormalizeRepoName 统一仓库名格式：API 里既可以写 demo 也可以写 demo.git，磁盘上统一是 demo.git
+// 仓库名带所有者时是 owner/demo.git
+func NormalizeRepoName(name string) string {
+	name = strings.Trim(name, "/")
+	if !strings.HasSuffix(name, ".git") {
+		name += ".git"
+	}
+	return name
+}
+
+// RepoOwner 仓库名里的所有者（用户或组织），没有所有者的老仓库返回空
+func RepoOwner(name string) string {
+	owner, _, ok := strings.Cut(strings.Trim(name, "/"), "/")
+	if !ok {
+		return ""
+	}
+	return owner
+}
+
+// RepoFromPath 从路由里的 {owner}/{repo} 取出完整的仓库名
+func RepoFromPath(r *http.Request) string {
+	return NormalizeRepoName(r.PathValue("owner") + "/" + r.PathValue("repo"))
+}
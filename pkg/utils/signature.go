@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// SignPayload 使用共享密钥对 "时间戳.请求体" 计算 HMAC-SHA256 签名
+// 返回值形如 sha256=<hex>，放在 X-DevNexus-Signature 头里
+func SignPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature 校验签名，使用常量时间比较防止时序攻击
+func VerifySignature(secret, signature string, timestamp int64, body []byte) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	expected := SignPayload(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// RandomID 生成 n 字节随机数的十六进制字符串，用作投递 ID 等
+func RandomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SignRequest 对没有请求体的请求（例如 OpsEngine 的制品下载）签名，签名内容是 "方法 路径"
+func SignRequest(secret string, timestamp int64, method, path string) string {
+	return SignPayload(secret, timestamp, []byte(method+" "+path))
+}